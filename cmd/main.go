@@ -1,16 +1,103 @@
 package main
 
 import (
-	"time"
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"example.com/card-server/pkg"
 )
 
 func main() {
-	server := pkg.NewServer()
-	server.RegisterHandler(pkg.NewQueueManager())
-	server.RegisterHandler(pkg.NewGameManager(30 * time.Second))
-	server.RegisterHandler(pkg.NewMatchManager(30 * time.Second))
+	config, err := pkg.LoadConfig(os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	server.Listen("0.0.0.0:8080")
+	logger, err := pkg.NewLoggerWithConfig(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pkg.SetDefaultLogger(logger)
+
+	if err := pkg.LoadCards(config.CardsFile); err != nil {
+		log.Fatal("Could not load cards: ", err)
+	}
+
+	games := pkg.NewGameManagerWithConfig(config)
+	queue := pkg.NewQueueManagerWithConfig(config)
+
+	server := pkg.NewServerWithConfig(config)
+	server.Use(pkg.Timing(pkg.LogSlowEvents(pkg.SLOW_EVENT)))
+	server.RegisterHandler(queue)
+	server.RegisterHandler(games)
+	server.RegisterHandler(pkg.NewMatchManagerWithConfig(config))
+
+	cluster, err := pkg.NewClusterWithConfig(config)
+	if err != nil {
+		log.Fatal("Could not open store: ", err)
+	}
+	server.Join(cluster)
+	logger.With(pkg.Fields{"instance": cluster.Instance(), "store": config.Store}).Info("joined cluster")
+
+	go queue.Matchmake(server.ProcessEvent)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		<-stop
+		logger.Info("shutting down")
+
+		snapshots, err := os.Create(config.SnapshotFile)
+		if err != nil {
+			logger.With(pkg.Fields{"error": err}).Error("could not create snapshot file")
+		} else {
+			defer snapshots.Close()
+			games.SetSnapshotWriter(snapshots)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+		defer cancel()
+
+		if err := server.Shutdown(ctx); err != nil {
+			logger.With(pkg.Fields{"error": err}).Error("shutdown")
+		}
+	}()
+
+	listening := 0
+	errors := make(chan error)
+
+	if config.Addr != "" {
+		listening++
+		go func() {
+			errors <- server.Listen(config.Addr)
+		}()
+	}
+
+	if config.TLSAddr != "" {
+		certs, err := pkg.NewCertReloader(config.TLSCert, config.TLSKey, config.CertReloadInterval)
+		if err != nil {
+			log.Fatal("Could not load certificate: ", err)
+		}
+
+		listening++
+		go func() {
+			errors <- server.ListenTLS(config.TLSAddr, certs)
+		}()
+	}
+
+	for ; listening > 0; listening-- {
+		if err := <-errors; err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// listeners return as soon as shutdown starts, wait for games to drain
+	<-done
 }
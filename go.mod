@@ -3,7 +3,7 @@ module example.com/card-server
 go 1.17
 
 require (
-	github.com/google/uuid v1.3.0 // indirect
-	github.com/gorilla/websocket v1.5.0 // indirect
-	github.com/mitchellh/mapstructure v1.5.0 // indirect
+	github.com/google/uuid v1.3.0
+	github.com/gorilla/websocket v1.5.0
+	github.com/mitchellh/mapstructure v1.5.0
 )
@@ -0,0 +1,296 @@
+package pkg
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Path the admin API is served under
+const ADMIN_PREFIX = "/admin/"
+
+type GameSummary struct {
+	Id       uuid.UUID     `json:"id"`
+	Finished bool          `json:"finished"`
+	Current  uuid.UUID     `json:"current,omitempty"`
+	TurnLeft time.Duration `json:"turn_left"`
+	Players  []uuid.UUID   `json:"players"`
+}
+
+type SocketSummary struct {
+	Id       uuid.UUID `json:"id"`
+	Session  uuid.UUID `json:"session"`
+	Protocol int       `json:"protocol"`
+}
+
+type EndGamePayload struct {
+	Winner uuid.UUID `json:"winner"`
+}
+
+type adminErrorPayload struct {
+	Error string    `json:"error"`
+	Code  ErrorCode `json:"code"`
+}
+
+// Admin API to look into and act on live games, matches, the queue and
+// connections. Every request needs the admin token as a bearer token, the
+// API is not served at all without one
+func (s *Server) HandleAdmin(w http.ResponseWriter, r *http.Request) {
+	if s.adminToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorizeAdmin(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		writeAdmin(w, http.StatusUnauthorized, adminErrorPayload{Error: "Invalid admin token"})
+		return
+	}
+
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, ADMIN_PREFIX), "/"), "/")
+	route := r.Method + " " + path[0]
+	if len(path) > 1 {
+		route += "/:id"
+	}
+	if len(path) > 2 {
+		route += "/" + strings.Join(path[2:], "/")
+	}
+
+	logger := DefaultLogger().With(Fields{"admin": route, "path": r.URL.Path, "remote": r.RemoteAddr})
+
+	var result interface{}
+	var err error
+
+	switch route {
+	case "GET games":
+		result = s.adminGames()
+	case "GET games/:id":
+		result, err = s.adminGame(path[1])
+	case "POST games/:id/end":
+		logger.Info("ending game")
+		result, err = s.adminEndGame(path[1], r)
+	case "GET matches":
+		result, err = s.adminMatches()
+	case "GET queue":
+		result, err = s.adminQueue()
+	case "DELETE queue/:id":
+		logger.Info("removing player from queue")
+		result, err = s.adminDequeue(path[1])
+	case "GET sockets":
+		result = s.adminSockets()
+	case "DELETE sockets/:id":
+		logger.Info("kicking socket")
+		result, err = s.adminKick(path[1])
+	default:
+		writeAdmin(w, http.StatusNotFound, adminErrorPayload{Error: "Unknown admin route " + route})
+		return
+	}
+
+	if err != nil {
+		logger.With(Fields{"error": err}).Warn("admin request failed")
+		writeAdminError(w, err)
+		return
+	}
+	writeAdmin(w, http.StatusOK, result)
+}
+
+func (s *Server) authorizeAdmin(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(header, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) == 1
+}
+
+func (s *Server) adminGames() []GameSummary {
+	games := []GameSummary{}
+
+	manager := s.gameManager()
+	if manager == nil {
+		return games
+	}
+
+	for _, game := range manager.Games() {
+		games = append(games, game.Summary())
+	}
+	return games
+}
+
+func (s *Server) adminGame(id string) (GameSnapshot, error) {
+	game, err := s.findGame(id)
+	if err != nil {
+		return GameSnapshot{}, err
+	}
+	return game.Snapshot(), nil
+}
+
+func (s *Server) adminEndGame(id string, r *http.Request) (GameSummary, error) {
+	game, err := s.findGame(id)
+	if err != nil {
+		return GameSummary{}, err
+	}
+
+	var payload EndGamePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return GameSummary{}, NewProtocolError(InvalidPayload, "Expected a winner player id")
+	}
+	if err := game.End(payload.Winner); err != nil {
+		return GameSummary{}, err
+	}
+	return game.Summary(), nil
+}
+
+func (s *Server) adminMatches() ([]MatchSummary, error) {
+	matches := s.matchManager()
+	if matches == nil {
+		return nil, NewProtocolError(MatchNotFound, "Matches are not handled by this server")
+	}
+	return matches.Matches(), nil
+}
+
+func (s *Server) adminQueue() ([]SocketSummary, error) {
+	queue := s.queueManager()
+	if queue == nil {
+		return nil, NewProtocolError(NotQueued, "Queue is not handled by this server")
+	}
+
+	players := []SocketSummary{}
+	for _, socket := range queue.Players() {
+		players = append(players, socket.Summary())
+	}
+	return players, nil
+}
+
+func (s *Server) adminDequeue(id string) (SocketSummary, error) {
+	queue := s.queueManager()
+	if queue == nil {
+		return SocketSummary{}, NewProtocolError(NotQueued, "Queue is not handled by this server")
+	}
+
+	socketId, err := parseId(id, "socket id")
+	if err != nil {
+		return SocketSummary{}, err
+	}
+
+	for _, socket := range queue.Players() {
+		if socket.Id == socketId {
+			if err := queue.RemoveFromQueue(socket); err != nil {
+				return SocketSummary{}, err
+			}
+			socket.Send(Response{Type: Dequeued})
+			return socket.Summary(), nil
+		}
+	}
+	return SocketSummary{}, NewProtocolError(NotQueued, "Not in queue", socketId)
+}
+
+func (s *Server) adminSockets() []SocketSummary {
+	sockets := []SocketSummary{}
+	for _, socket := range s.Sockets() {
+		sockets = append(sockets, socket.Summary())
+	}
+	return sockets
+}
+
+// Closes a connection, the player can come back like after any disconnect
+func (s *Server) adminKick(id string) (SocketSummary, error) {
+	socketId, err := parseId(id, "socket id")
+	if err != nil {
+		return SocketSummary{}, err
+	}
+
+	for _, socket := range s.Sockets() {
+		if socket.Id == socketId {
+			socket.Close(Response{Type: Kicked})
+			return socket.Summary(), nil
+		}
+	}
+	return SocketSummary{}, NewProtocolError(PlayerNotFound, "Socket not found", socketId)
+}
+
+func (s *Server) findGame(id string) (*Game, error) {
+	manager := s.gameManager()
+	if manager == nil {
+		return nil, NewProtocolError(GameNotFound, "Games are not handled by this server")
+	}
+	return manager.findGame(id)
+}
+
+func (s *Server) gameManager() *GameManager {
+	for _, handler := range s.bus.Handlers() {
+		if games, ok := handler.(*GameManager); ok {
+			return games
+		}
+	}
+	return nil
+}
+
+func (s *Server) matchManager() *MatchManager {
+	for _, handler := range s.bus.Handlers() {
+		if matches, ok := handler.(*MatchManager); ok {
+			return matches
+		}
+	}
+	return nil
+}
+
+func (s *Server) queueManager() *QueueManager {
+	for _, handler := range s.bus.Handlers() {
+		if queue, ok := handler.(*QueueManager); ok {
+			return queue
+		}
+	}
+	return nil
+}
+
+// Short view of a game, Snapshot has everything
+func (g *Game) Summary() GameSummary {
+	snapshot := g.Snapshot()
+
+	summary := GameSummary{
+		Id:       g.Id,
+		Current:  snapshot.Current,
+		TurnLeft: snapshot.TurnLeft,
+		Players:  []uuid.UUID{},
+	}
+	for _, player := range snapshot.Players {
+		summary.Players = append(summary.Players, player.Id)
+	}
+
+	select {
+	case <-g.Done():
+		summary.Finished = true
+	default:
+	}
+	return summary
+}
+
+func (s *Socket) Summary() SocketSummary {
+	return SocketSummary{Id: s.Id, Session: s.Session, Protocol: s.Protocol()}
+}
+
+func writeAdminError(w http.ResponseWriter, err error) {
+	status := http.StatusConflict
+	switch ErrorCodeOf(err) {
+	case InvalidPayload:
+		status = http.StatusBadRequest
+	case GameNotFound, MatchNotFound, PlayerNotFound, NotQueued:
+		status = http.StatusNotFound
+	case Internal:
+		status = http.StatusInternalServerError
+	}
+
+	protocolError := AsProtocolError(err)
+	writeAdmin(w, status, adminErrorPayload{Error: protocolError.Message, Code: protocolError.Code})
+}
+
+func writeAdmin(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(payload)
+}
@@ -0,0 +1,210 @@
+package pkg
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const TEST_ADMIN_TOKEN = "secret"
+
+func NewAdminServer() (*Server, *GameManager, *QueueManager) {
+	config := DefaultConfig()
+	config.AdminToken = TEST_ADMIN_TOKEN
+
+	server := NewServerWithConfig(config)
+	games := NewGameManager(time.Second)
+	queue := NewQueueManager()
+
+	server.RegisterHandler(queue)
+	server.RegisterHandler(games)
+	server.RegisterHandler(NewMatchManager(time.Second))
+
+	return server, games, queue
+}
+
+// Sends an admin request, decoding the response into result if given
+func AdminRequest(t *testing.T, server *Server, method, path, body string, result interface{}) int {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+TEST_ADMIN_TOKEN)
+
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, request)
+
+	if result != nil {
+		if err := json.NewDecoder(recorder.Body).Decode(result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return recorder.Code
+}
+
+func TestAdmin(t *testing.T) {
+	t.Run("requires token", func(t *testing.T) {
+		server, _, _ := NewAdminServer()
+
+		for _, header := range []string{"", "Bearer wrong", TEST_ADMIN_TOKEN} {
+			request := httptest.NewRequest(http.MethodGet, "/admin/games", nil)
+			request.Header.Set("Authorization", header)
+
+			recorder := httptest.NewRecorder()
+			server.Handler().ServeHTTP(recorder, request)
+
+			if recorder.Code != http.StatusUnauthorized {
+				t.Errorf("Expected %v, got %v", http.StatusUnauthorized, recorder.Code)
+			}
+		}
+	})
+
+	t.Run("disabled without token", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		NewServer().Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin/games", nil))
+
+		if recorder.Code != http.StatusNotFound {
+			t.Errorf("Expected %v, got %v", http.StatusNotFound, recorder.Code)
+		}
+	})
+
+	t.Run("lists and dumps games", func(t *testing.T) {
+		server, games, _ := NewAdminServer()
+
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+		game := games.CreateGame([]*Socket{p1, p2})
+		game.StartTurn()
+
+		var summaries []GameSummary
+		if status := AdminRequest(t, server, http.MethodGet, "/admin/games", "", &summaries); status != http.StatusOK {
+			t.Fatalf("Expected %v, got %v", http.StatusOK, status)
+		}
+		if len(summaries) != 1 || summaries[0].Id != game.Id || len(summaries[0].Players) != 2 {
+			t.Errorf("Expected game %v with 2 players, got %v", game.Id, summaries)
+		}
+
+		// cards are interfaces, the dump is read generically
+		var snapshot struct {
+			Current  string
+			TurnLeft time.Duration `json:"turn_left"`
+			Players  []struct {
+				Hand  []map[string]interface{}
+				Board []map[string]interface{}
+			}
+		}
+		AdminRequest(t, server, http.MethodGet, "/admin/games/"+game.Id.String(), "", &snapshot)
+
+		current := game.GetPlayers()[p1]
+		if snapshot.Current != current.Id.String() || snapshot.TurnLeft <= 0 {
+			t.Errorf("Expected current player %v with time left, got %v", current.Id, snapshot)
+		}
+		if len(snapshot.Players) != 2 || len(snapshot.Players[0].Hand) == 0 {
+			t.Errorf("Expected players with hands, got %v", snapshot.Players)
+		}
+
+		if status := AdminRequest(t, server, http.MethodGet, "/admin/games/not-an-id", "", nil); status != http.StatusBadRequest {
+			t.Errorf("Expected %v, got %v", http.StatusBadRequest, status)
+		}
+	})
+
+	t.Run("ends games", func(t *testing.T) {
+		server, games, _ := NewAdminServer()
+
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+		game := games.CreateGame([]*Socket{p1, p2})
+		winner := game.GetPlayers()[p2]
+
+		path := "/admin/games/" + game.Id.String() + "/end"
+		if status := AdminRequest(t, server, http.MethodPost, path, `{"winner": "`+p1.Id.String()+`"}`, nil); status != http.StatusNotFound {
+			t.Errorf("Expected %v for unknown player, got %v", http.StatusNotFound, status)
+		}
+
+		var summary GameSummary
+		if status := AdminRequest(t, server, http.MethodPost, path, `{"winner": "`+winner.Id.String()+`"}`, &summary); status != http.StatusOK {
+			t.Fatalf("Expected %v, got %v", http.StatusOK, status)
+		}
+		if !summary.Finished {
+			t.Error("Expected game to be finished")
+		}
+
+		ReadOutgoing(t, p2, Win)
+		ReadOutgoing(t, p1, Loss)
+	})
+
+	t.Run("lists matches", func(t *testing.T) {
+		server, _, _ := NewAdminServer()
+
+		p1 := NewTestSocket()
+		server.ProcessEvent(Event{Type: QueueUp, Player: p1})
+		server.ProcessEvent(Event{Type: QueueUp, Player: NewTestSocket()})
+
+		var matches []MatchSummary
+		AdminRequest(t, server, http.MethodGet, "/admin/matches", "", &matches)
+
+		if len(matches) != 1 || len(matches[0].Players) != 2 || matches[0].Players[0] != p1.Id {
+			t.Errorf("Expected a match with %v, got %v", p1.Id, matches)
+		}
+	})
+
+	t.Run("removes players from queue", func(t *testing.T) {
+		server, _, queue := NewAdminServer()
+
+		socket := NewTestSocket()
+		server.ProcessEvent(Event{Type: QueueUp, Player: socket})
+		<-socket.Outgoing // wait for match
+
+		var queued []SocketSummary
+		AdminRequest(t, server, http.MethodGet, "/admin/queue", "", &queued)
+		if len(queued) != 1 || queued[0].Id != socket.Id {
+			t.Errorf("Expected %v queued, got %v", socket.Id, queued)
+		}
+
+		if status := AdminRequest(t, server, http.MethodDelete, "/admin/queue/"+socket.Id.String(), "", nil); status != http.StatusOK {
+			t.Fatalf("Expected %v, got %v", http.StatusOK, status)
+		}
+		if queue.InQueueCount() != 0 {
+			t.Errorf("Expected empty queue, got %v", queue.InQueueCount())
+		}
+		ReadOutgoing(t, socket, Dequeued)
+
+		if status := AdminRequest(t, server, http.MethodDelete, "/admin/queue/"+socket.Id.String(), "", nil); status != http.StatusNotFound {
+			t.Errorf("Expected %v, got %v", http.StatusNotFound, status)
+		}
+	})
+
+	t.Run("kicks sockets", func(t *testing.T) {
+		server, _, _ := NewAdminServer()
+
+		socket := NewTestSocket()
+		server.mutex.Lock()
+		server.sockets[socket] = true
+		server.mutex.Unlock()
+
+		if status := AdminRequest(t, server, http.MethodDelete, "/admin/sockets/"+socket.Id.String(), "", nil); status != http.StatusOK {
+			t.Fatalf("Expected %v, got %v", http.StatusOK, status)
+		}
+
+		select {
+		case message := <-socket.closing:
+			if message.Type != Kicked {
+				t.Errorf("Expected %v, got %v", Kicked, message.Type)
+			}
+		default:
+			t.Error("Expected socket to be closed")
+		}
+
+		if status := AdminRequest(t, server, http.MethodDelete, "/admin/sockets/"+NewTestSocket().Id.String(), "", nil); status != http.StatusNotFound {
+			t.Errorf("Expected %v, got %v", http.StatusNotFound, status)
+		}
+	})
+
+	t.Run("unknown routes", func(t *testing.T) {
+		server, _, _ := NewAdminServer()
+
+		if status := AdminRequest(t, server, http.MethodPost, "/admin/games", "", nil); status != http.StatusNotFound {
+			t.Errorf("Expected %v, got %v", http.StatusNotFound, status)
+		}
+	})
+}
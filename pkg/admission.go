@@ -0,0 +1,126 @@
+package pkg
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// AdmissionError is a rejected connection attempt, carrying the HTTP status
+// the client gets back
+type AdmissionError struct {
+	Status  int
+	Message string
+}
+
+func (e *AdmissionError) Error() string {
+	return e.Message
+}
+
+// Admission decides which connections are accepted before upgrading them,
+// checking their origin and how many connections are already open
+type Admission struct {
+	mutex     *sync.Mutex
+	origins   map[string]bool
+	anyOrigin bool
+	maxTotal  int
+	maxPerIP  int
+	total     int
+	perIP     map[string]int
+}
+
+// Creates an admission policy from config, an empty origin list only allows
+// same origin requests and zero limits mean unlimited
+func NewAdmission(config Config) *Admission {
+	admission := &Admission{
+		mutex:    new(sync.Mutex),
+		origins:  make(map[string]bool),
+		maxTotal: config.MaxConnections,
+		maxPerIP: config.MaxConnectionsPerIP,
+		perIP:    make(map[string]int),
+	}
+
+	for _, origin := range config.AllowedOrigins {
+		if origin == "*" {
+			admission.anyOrigin = true
+		}
+		admission.origins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+
+	return admission
+}
+
+// Requests without an origin don't come from browsers and are allowed,
+// otherwise the origin must be allowed or match the requested host
+func (a *Admission) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || a.anyOrigin {
+		return true
+	}
+	if a.origins[strings.ToLower(origin)] {
+		return true
+	}
+
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return len(a.origins) == 0 && strings.EqualFold(parsed.Host, r.Host)
+}
+
+// Reserves a connection slot for the request, release must be called once
+// the connection is closed
+func (a *Admission) Admit(r *http.Request) (func(), error) {
+	if !a.CheckOrigin(r) {
+		return nil, &AdmissionError{http.StatusForbidden, "Origin not allowed"}
+	}
+
+	ip := remoteIP(r)
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.maxTotal > 0 && a.total >= a.maxTotal {
+		return nil, &AdmissionError{http.StatusServiceUnavailable, "Too many connections"}
+	}
+	if a.maxPerIP > 0 && a.perIP[ip] >= a.maxPerIP {
+		return nil, &AdmissionError{http.StatusTooManyRequests, "Too many connections from this address"}
+	}
+
+	a.total++
+	a.perIP[ip]++
+
+	released := false
+	return func() {
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+
+		if released {
+			return
+		}
+		released = true
+
+		a.total--
+		if a.perIP[ip]--; a.perIP[ip] == 0 {
+			delete(a.perIP, ip)
+		}
+	}, nil
+}
+
+// Number of admitted connections still open
+func (a *Admission) Connections() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.total
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,135 @@
+package pkg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func NewAdmissionRequest(origin, remoteAddr string) *http.Request {
+	r := httptest.NewRequest("GET", "http://game.example.com/", nil)
+	r.RemoteAddr = remoteAddr
+	if origin != "" {
+		r.Header.Set("Origin", origin)
+	}
+	return r
+}
+
+func TestAdmission(t *testing.T) {
+	t.Run("same origin by default", func(t *testing.T) {
+		admission := NewAdmission(DefaultConfig())
+
+		if !admission.CheckOrigin(NewAdmissionRequest("http://game.example.com", "1.1.1.1:1000")) {
+			t.Error("Should allow same origin")
+		}
+		if admission.CheckOrigin(NewAdmissionRequest("http://evil.com", "1.1.1.1:1000")) {
+			t.Error("Should not allow other origins")
+		}
+		if !admission.CheckOrigin(NewAdmissionRequest("", "1.1.1.1:1000")) {
+			t.Error("Should allow requests without origin")
+		}
+	})
+
+	t.Run("allowed origins", func(t *testing.T) {
+		config := DefaultConfig()
+		config.AllowedOrigins = []string{"https://play.example.com/"}
+		admission := NewAdmission(config)
+
+		if !admission.CheckOrigin(NewAdmissionRequest("https://PLAY.example.com", "1.1.1.1:1000")) {
+			t.Error("Should allow listed origin")
+		}
+		if admission.CheckOrigin(NewAdmissionRequest("http://game.example.com", "1.1.1.1:1000")) {
+			t.Error("Should only allow listed origins")
+		}
+
+		_, err := admission.Admit(NewAdmissionRequest("http://evil.com", "1.1.1.1:1000"))
+		if err == nil || err.(*AdmissionError).Status != http.StatusForbidden {
+			t.Errorf("Expected %v, got %v", http.StatusForbidden, err)
+		}
+	})
+
+	t.Run("any origin", func(t *testing.T) {
+		config := DefaultConfig()
+		config.AllowedOrigins = []string{"*"}
+		admission := NewAdmission(config)
+
+		if !admission.CheckOrigin(NewAdmissionRequest("http://anything.com", "1.1.1.1:1000")) {
+			t.Error("Should allow any origin")
+		}
+	})
+
+	t.Run("limits connections per ip", func(t *testing.T) {
+		config := DefaultConfig()
+		config.MaxConnectionsPerIP = 1
+		admission := NewAdmission(config)
+
+		release, err := admission.Admit(NewAdmissionRequest("", "1.1.1.1:1000"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = admission.Admit(NewAdmissionRequest("", "1.1.1.1:2000"))
+		if err == nil || err.(*AdmissionError).Status != http.StatusTooManyRequests {
+			t.Errorf("Expected %v, got %v", http.StatusTooManyRequests, err)
+		}
+
+		if _, err := admission.Admit(NewAdmissionRequest("", "2.2.2.2:1000")); err != nil {
+			t.Errorf("Should admit other addresses, got %v", err)
+		}
+
+		release()
+		release()
+
+		if _, err := admission.Admit(NewAdmissionRequest("", "1.1.1.1:3000")); err != nil {
+			t.Errorf("Should admit after release, got %v", err)
+		}
+	})
+
+	t.Run("limits total connections", func(t *testing.T) {
+		config := DefaultConfig()
+		config.MaxConnections = 2
+		admission := NewAdmission(config)
+
+		admission.Admit(NewAdmissionRequest("", "1.1.1.1:1000"))
+		admission.Admit(NewAdmissionRequest("", "2.2.2.2:1000"))
+
+		_, err := admission.Admit(NewAdmissionRequest("", "3.3.3.3:1000"))
+		if err == nil || err.(*AdmissionError).Status != http.StatusServiceUnavailable {
+			t.Errorf("Expected %v, got %v", http.StatusServiceUnavailable, err)
+		}
+		if admission.Connections() != 2 {
+			t.Errorf("Expected %v, got %v", 2, admission.Connections())
+		}
+	})
+
+	t.Run("rejects before upgrading", func(t *testing.T) {
+		config := DefaultConfig()
+		config.MaxConnectionsPerIP = 1
+		server := NewServerWithConfig(config)
+
+		listener := httptest.NewServer(http.HandlerFunc(server.HandleConnection))
+		defer listener.Close()
+
+		url := "ws" + strings.TrimPrefix(listener.URL, "http")
+
+		header := http.Header{"Origin": []string{"http://evil.com"}}
+		_, res, err := websocket.DefaultDialer.Dial(url, header)
+		if err == nil || res.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected %v status, got %v", http.StatusForbidden, res)
+		}
+
+		socket, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer socket.Close()
+
+		_, res, err = websocket.DefaultDialer.Dial(url, nil)
+		if err == nil || res.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("Expected %v status, got %v", http.StatusTooManyRequests, res)
+		}
+	})
+}
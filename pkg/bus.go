@@ -0,0 +1,151 @@
+package pkg
+
+import (
+	"sort"
+	"sync"
+)
+
+// How many events a single event may lead to before the chain is considered
+// a loop and dropped
+const MAX_EVENT_CHAIN = 64
+
+// Handlers that only care about some events, the bus won't offer them others
+type EventRouter interface {
+	Handles() []EventType
+}
+
+type subscription struct {
+	handler  EventHandler
+	priority int
+	order    int
+}
+
+// EventBus routes events to the handlers subscribed to their type, highest
+// priority first. Events returned by handlers are queued and processed once
+// every handler got the current one, instead of recursing
+type EventBus struct {
+	mutex      *sync.RWMutex
+	routes     map[EventType][]subscription
+	all        []subscription
+	middleware []Middleware
+	count      int
+	maxChain   int
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{
+		mutex:      new(sync.RWMutex),
+		routes:     make(map[EventType][]subscription),
+		all:        []subscription{},
+		middleware: []Middleware{},
+		maxChain:   MAX_EVENT_CHAIN,
+	}
+}
+
+// Subscribes handler to the given types, or to every event if none is given.
+// Handlers with the same priority are called in subscription order
+func (b *EventBus) Subscribe(handler EventHandler, priority int, types ...EventType) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.count++
+	entry := subscription{handler: handler, priority: priority, order: b.count}
+
+	if len(types) == 0 {
+		b.all = append(b.all, entry)
+		return
+	}
+	for _, eventType := range types {
+		b.routes[eventType] = append(b.routes[eventType], entry)
+	}
+}
+
+// Wraps every handler with middleware, after the ones already in use
+func (b *EventBus) Use(middleware ...Middleware) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.middleware = append(b.middleware, middleware...)
+}
+
+// Middleware every delivery goes through, recovery is always outermost so
+// a panic only fails the event for that handler
+func (b *EventBus) chain() Middleware {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	middleware := append([]Middleware{Recovery()}, b.middleware...)
+	return Chain(middleware...)
+}
+
+// Every subscribed handler once, in subscription order
+func (b *EventBus) Handlers() []EventHandler {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	byOrder := make(map[int]EventHandler)
+	for _, entry := range b.all {
+		byOrder[entry.order] = entry.handler
+	}
+	for _, entries := range b.routes {
+		for _, entry := range entries {
+			byOrder[entry.order] = entry.handler
+		}
+	}
+
+	handlers := []EventHandler{}
+	for order := 1; order <= b.count; order++ {
+		if handler, ok := byOrder[order]; ok {
+			handlers = append(handlers, handler)
+		}
+	}
+	return handlers
+}
+
+// Handlers for eventType in the order they should be called
+func (b *EventBus) handlers(eventType EventType) []subscription {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	handlers := append([]subscription{}, b.routes[eventType]...)
+	handlers = append(handlers, b.all...)
+
+	sort.Slice(handlers, func(i, j int) bool {
+		if handlers[i].priority != handlers[j].priority {
+			return handlers[i].priority > handlers[j].priority
+		}
+		return handlers[i].order < handlers[j].order
+	})
+	return handlers
+}
+
+// Offers event to its handlers, then the events they return in turn, until
+// there is nothing left or the chain gets too long
+func (b *EventBus) Publish(event Event) {
+	queue := []Event{event}
+	chain := b.chain()
+
+	for processed := 0; len(queue) > 0; processed++ {
+		if processed == b.maxChain {
+			DefaultLogger().With(event.Fields()).With(Fields{"dropped": len(queue)}).Error("event chain too long, handlers are looping")
+			return
+		}
+
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, entry := range b.handlers(current.Type) {
+			if next := chain(entry.handler).Process(current); next != nil {
+				queue = append(queue, *next)
+			}
+		}
+	}
+}
+
+// Types handler asked to receive, none meaning every event
+func HandledEvents(handler EventHandler) []EventType {
+	if router, ok := handler.(EventRouter); ok {
+		return router.Handles()
+	}
+	return nil
+}
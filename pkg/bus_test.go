@@ -0,0 +1,151 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Records the events it gets and returns whatever next gives back
+type RecordingHandler struct {
+	name     string
+	received *[]string
+	types    []EventType
+	next     func(event Event) *Event
+}
+
+func (r *RecordingHandler) Handles() []EventType {
+	return r.types
+}
+
+func (r *RecordingHandler) Process(event Event) *Event {
+	*r.received = append(*r.received, r.name+" "+string(event.Type))
+	if r.next != nil {
+		return r.next(event)
+	}
+	return nil
+}
+
+type PanicHandler struct{}
+
+func (p PanicHandler) Process(event Event) *Event {
+	panic("broken handler")
+}
+
+func TestEventBus(t *testing.T) {
+	t.Run("routes by type", func(t *testing.T) {
+		received := []string{}
+		bus := NewEventBus()
+
+		queue := &RecordingHandler{name: "queue", received: &received, types: []EventType{QueueUp}}
+		bus.Subscribe(queue, 0, HandledEvents(queue)...)
+
+		games := &RecordingHandler{name: "games", received: &received, types: []EventType{EndTurn}}
+		bus.Subscribe(games, 0, HandledEvents(games)...)
+
+		bus.Publish(Event{Type: QueueUp})
+		bus.Publish(Event{Type: EndTurn})
+		bus.Publish(Event{Type: Dequeue})
+
+		expected := []string{"queue queue", "games end_turn"}
+		if !reflect.DeepEqual(expected, received) {
+			t.Errorf("Expected %v, got %v", expected, received)
+		}
+	})
+
+	t.Run("calls higher priorities first", func(t *testing.T) {
+		received := []string{}
+		bus := NewEventBus()
+
+		bus.Subscribe(&RecordingHandler{name: "low", received: &received}, -1)
+		bus.Subscribe(&RecordingHandler{name: "first", received: &received}, 0, QueueUp)
+		bus.Subscribe(&RecordingHandler{name: "high", received: &received}, 10, QueueUp)
+		bus.Subscribe(&RecordingHandler{name: "second", received: &received}, 0)
+
+		bus.Publish(Event{Type: QueueUp})
+
+		expected := []string{"high queue", "first queue", "second queue", "low queue"}
+		if !reflect.DeepEqual(expected, received) {
+			t.Errorf("Expected %v, got %v", expected, received)
+		}
+	})
+
+	t.Run("queues returned events", func(t *testing.T) {
+		received := []string{}
+		bus := NewEventBus()
+
+		bus.Subscribe(&RecordingHandler{
+			name:     "queue",
+			received: &received,
+			types:    []EventType{QueueUp},
+			next: func(event Event) *Event {
+				return &Event{Type: CreateMatch}
+			},
+		}, 0, QueueUp)
+		bus.Subscribe(&RecordingHandler{name: "all", received: &received}, 0)
+
+		bus.Publish(Event{Type: QueueUp})
+
+		// every handler gets an event before the ones it led to
+		expected := []string{"queue queue", "all queue", "all create_match"}
+		if !reflect.DeepEqual(expected, received) {
+			t.Errorf("Expected %v, got %v", expected, received)
+		}
+	})
+
+	t.Run("stops loops", func(t *testing.T) {
+		received := []string{}
+		bus := NewEventBus()
+
+		bus.Subscribe(&RecordingHandler{
+			name:     "loop",
+			received: &received,
+			next: func(event Event) *Event {
+				return &event
+			},
+		}, 0)
+
+		bus.Publish(Event{Type: CreateMatch})
+
+		if len(received) != MAX_EVENT_CHAIN {
+			t.Errorf("Expected %v events, got %v", MAX_EVENT_CHAIN, len(received))
+		}
+	})
+
+	t.Run("isolates panics", func(t *testing.T) {
+		received := []string{}
+		bus := NewEventBus()
+		socket := NewTestSocket()
+
+		bus.Subscribe(PanicHandler{}, 1)
+		bus.Subscribe(&RecordingHandler{name: "after", received: &received}, 0)
+
+		bus.Publish(Event{Type: EndTurn, Player: socket, RequestId: "1"})
+
+		response := <-socket.Outgoing
+		if payload := response.Payload.(*ProtocolError); payload.Code != Internal {
+			t.Errorf("Expected %v, got %v", Internal, payload.Code)
+		}
+		if response.RequestId != "1" {
+			t.Errorf("Expected %v, got %v", "1", response.RequestId)
+		}
+
+		expected := []string{"after end_turn"}
+		if !reflect.DeepEqual(expected, received) {
+			t.Errorf("Expected %v, got %v", expected, received)
+		}
+	})
+
+	t.Run("lists handlers once", func(t *testing.T) {
+		bus := NewEventBus()
+		queue := NewQueueManager()
+		games := NewGameManager(0)
+
+		bus.Subscribe(queue, 0, HandledEvents(queue)...)
+		bus.Subscribe(games, 5, HandledEvents(games)...)
+
+		handlers := bus.Handlers()
+		if len(handlers) != 2 || handlers[0] != queue || handlers[1] != games {
+			t.Errorf("Expected %v and %v, got %v", queue, games, handlers)
+		}
+	})
+}
@@ -33,11 +33,15 @@ type Ability struct {
 }
 
 func (a *Ability) MarshalJSON() ([]byte, error) {
+	// abilities cast when played have no trigger to describe
+	descriptions := []string{}
+	if a.trigger != nil {
+		descriptions = append(descriptions, a.trigger.Description)
+	}
+	descriptions = append(descriptions, a.effect.GetDescription())
+
 	return json.Marshal(map[string]string{
-		"Description": strings.Join([]string{
-			a.trigger.Description,
-			a.effect.GetDescription(),
-		}, ", "),
+		"Description": strings.Join(descriptions, ", "),
 	})
 }
 
@@ -137,6 +141,29 @@ func NewCard(name string, mana, damage, health int) *Minion {
 	}
 }
 
+// Copies the card as it is now, cards in hand change once played
+func (m *Minion) Snapshot() *Minion {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	minion := *m
+	minion.mutex = new(sync.Mutex)
+	return &minion
+}
+
+// Copies cards that may still change, for messages describing a moment in
+// time
+func SnapshotCards(cards []Card) []Card {
+	copies := []Card{}
+	for _, card := range cards {
+		if minion, ok := card.(*Minion); ok {
+			card = minion.Snapshot()
+		}
+		copies = append(copies, card)
+	}
+	return copies
+}
+
 func (c *Minion) GetId() uuid.UUID {
 	return c.Id
 }
@@ -222,6 +249,22 @@ func NewMinion(card *Minion) *ActiveMinion {
 	}
 }
 
+// Copies the minion as it is now, for messages describing a moment in time
+func (m *ActiveMinion) Snapshot() *ActiveMinion {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	minion := *m.Minion
+	minion.mutex = new(sync.Mutex)
+
+	return &ActiveMinion{
+		Minion: &minion,
+		player: m.player,
+		state:  m.state,
+		State:  m.State,
+	}
+}
+
 func (m *ActiveMinion) GetPlayer() *Player {
 	return m.player
 }
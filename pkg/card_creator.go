@@ -2,15 +2,50 @@ package pkg
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"sync"
 )
 
 var cardData []CardData
 
+// Guards cardData and cardsFile, cards are read by games and health checks
+var cardsMutex sync.Mutex
+
+// Cards definition file, relative to the working directory
+var cardsFile = "../cards.json"
+
+// Loads card definitions from filename, replacing the ones loaded before
+func LoadCards(filename string) error {
+	data, err := readCards(filename)
+	if err != nil {
+		return err
+	}
+
+	cardsMutex.Lock()
+	defer cardsMutex.Unlock()
+
+	cardsFile = filename
+	cardData = data
+	return nil
+}
+
+// Makes sure card definitions can be loaded, returning how many there are
+func CheckCards() (int, error) {
+	data, err := loadCards()
+	if err != nil {
+		return 0, err
+	}
+	if len(data) == 0 {
+		return 0, errors.New("no cards defined")
+	}
+	return len(data), nil
+}
+
 func GetCards() []Card {
 	cards := []Card{}
-	data, err := loadCards("../cards.json")
+	data, err := loadCards()
 
 	if err != nil {
 		return cards
@@ -26,22 +61,35 @@ func GetCards() []Card {
 	return cards
 }
 
-func loadCards(filename string) ([]CardData, error) {
+// Cards loaded so far, read from the cards file on first use
+func loadCards() ([]CardData, error) {
+	cardsMutex.Lock()
+	defer cardsMutex.Unlock()
+
 	if len(cardData) > 0 {
 		return cardData, nil
 	}
 
-	contents, err := os.ReadFile(filename)
+	data, err := readCards(cardsFile)
 	if err != nil {
 		return nil, err
 	}
 
-	err = json.Unmarshal(contents, &cardData)
+	cardData = data
+	return cardData, nil
+}
+
+func readCards(filename string) ([]CardData, error) {
+	contents, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
 
-	return cardData, nil
+	var data []CardData
+	if err := json.Unmarshal(contents, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
 }
 
 type CardData struct {
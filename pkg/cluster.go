@@ -0,0 +1,408 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// How often instances check their mailbox
+const POLL_INTERVAL = 20 * time.Millisecond
+
+// A client socket as seen from other instances
+type RemoteSocket struct {
+	Id       uuid.UUID `json:"id"`
+	Session  uuid.UUID `json:"session"`
+	Instance string    `json:"instance"` // where the client is connected
+	Protocol int       `json:"protocol"`
+	Features []Feature `json:"features"`
+}
+
+// Handlers that need to know about the cluster they run in
+type ClusterMember interface {
+	SetCluster(cluster *Cluster)
+}
+
+// Cluster lets server instances sharing a store act as one server. Players
+// are matched from the shared pool, the instance creating a match or game
+// owns it, and events about it are forwarded to the owner wherever its
+// players are connected. Players connected elsewhere are represented on
+// the owner by proxy sockets, relaying everything sent to them back home
+type Cluster struct {
+	instance string
+	store    Store
+	server   *Server
+	logger   *Logger
+
+	mutex   *sync.Mutex
+	local   map[uuid.UUID]*Socket
+	proxies map[uuid.UUID]*Socket
+	remotes map[uuid.UUID]map[string]bool // instances each local socket talks to
+	stop    chan struct{}
+	stopped bool
+}
+
+func NewCluster(instance string, store Store) *Cluster {
+	return &Cluster{
+		instance: instance,
+		store:    store,
+		logger:   DefaultLogger().With(Fields{"instance": instance}),
+		mutex:    new(sync.Mutex),
+		local:    make(map[uuid.UUID]*Socket),
+		proxies:  make(map[uuid.UUID]*Socket),
+		remotes:  make(map[uuid.UUID]map[string]bool),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Opens the configured store, instances are named after the host and
+// process unless given a name
+func NewClusterWithConfig(config Config) (*Cluster, error) {
+	store, err := OpenStore(config)
+	if err != nil {
+		return nil, err
+	}
+
+	instance := config.Instance
+	if instance == "" {
+		host, _ := os.Hostname()
+		instance = fmt.Sprintf("%v-%v", host, os.Getpid())
+	}
+	return NewCluster(instance, store), nil
+}
+
+func (c *Cluster) Instance() string {
+	return c.instance
+}
+
+func (c *Cluster) Store() Store {
+	return c.store
+}
+
+// Delivers messages from other instances until Stop is called
+func (c *Cluster) Run() {
+	ticker := time.NewTicker(POLL_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			envelopes, err := c.store.Receive(c.instance)
+			if err != nil {
+				c.logger.With(Fields{"error": err}).Error("could not read mailbox")
+				continue
+			}
+			for _, envelope := range envelopes {
+				c.deliver(envelope)
+			}
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+func (c *Cluster) Stop() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.stopped {
+		c.stopped = true
+		close(c.stop)
+	}
+}
+
+// Registers a socket connected to this instance
+func (c *Cluster) Attach(socket *Socket) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.local[socket.Id] = socket
+}
+
+// Forgets a local socket, instances owning its games are told it left
+func (c *Cluster) Detach(socket *Socket) {
+	c.mutex.Lock()
+	delete(c.local, socket.Id)
+	remotes := c.remotes[socket.Id]
+	delete(c.remotes, socket.Id)
+	c.mutex.Unlock()
+
+	for instance := range remotes {
+		c.post(instance, ForwardedEvent, c.RemoteOf(socket), forwardedEvent{Type: Disconnected})
+	}
+}
+
+// How other instances reach socket
+func (c *Cluster) RemoteOf(socket *Socket) RemoteSocket {
+	remote := RemoteSocket{
+		Id:       socket.Id,
+		Session:  socket.Session,
+		Instance: c.instance,
+		Protocol: socket.Protocol(),
+		Features: socket.Features(),
+	}
+	if transport, ok := socket.transport.(*remoteTransport); ok {
+		remote.Instance = transport.remote.Instance
+	}
+	return remote
+}
+
+// The socket to talk to remote through, the socket itself if it is
+// connected here and a proxy otherwise
+func (c *Cluster) Resolve(remote RemoteSocket) *Socket {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if remote.Instance == c.instance {
+		if socket, ok := c.local[remote.Id]; ok {
+			return socket
+		}
+	}
+	return c.proxy(remote)
+}
+
+// Must be called with the lock held
+func (c *Cluster) proxy(remote RemoteSocket) *Socket {
+	if socket, ok := c.proxies[remote.Id]; ok {
+		return socket
+	}
+
+	transport := &remoteTransport{
+		cluster: c,
+		remote:  remote,
+		closed:  make(chan struct{}),
+		once:    new(sync.Once),
+	}
+	socket := NewTransportSocket(transport, c.server.config)
+	socket.Id = remote.Id
+	socket.Session = remote.Session
+	socket.SetProtocol(remote.Protocol, remote.Features)
+	c.proxies[remote.Id] = socket
+
+	// proxies disconnect like any socket, when the client left or when
+	// closed here
+	go func() {
+		<-socket.Disconnect
+
+		c.mutex.Lock()
+		if c.proxies[remote.Id] == socket {
+			delete(c.proxies, remote.Id)
+		}
+		c.mutex.Unlock()
+
+		c.server.ProcessEvent(NewDisconnected(socket))
+	}()
+	return socket
+}
+
+// Marks id as owned by this instance
+func (c *Cluster) Claim(id uuid.UUID) {
+	if err := c.store.Claim(id, c.instance); err != nil {
+		c.logger.With(Fields{"id": id, "error": err}).Error("could not claim")
+	}
+}
+
+func (c *Cluster) Release(id uuid.UUID) {
+	if err := c.store.Release(id); err != nil {
+		c.logger.With(Fields{"id": id, "error": err}).Error("could not release")
+	}
+}
+
+// Sends event to the instance owning the match or game it is about,
+// returning false if it should be processed here. payload is the event
+// payload as received, before decoding
+func (c *Cluster) Forward(event Event, payload interface{}) bool {
+	id, ok := EventTarget(event)
+	if !ok {
+		return false
+	}
+
+	owner, err := c.store.Owner(id)
+	if err != nil {
+		c.logger.With(event.Fields()).With(Fields{"error": err}).Error("could not find owner")
+		event.Reply(ErrorMessage(NewProtocolError(Internal, "Could not process event")))
+		return true
+	}
+	if owner == "" || owner == c.instance {
+		return false
+	}
+
+	c.remember(event.Player.Id, owner)
+	err = c.post(owner, ForwardedEvent, c.RemoteOf(event.Player), forwardedEvent{
+		Type:      event.Type,
+		Payload:   payload,
+		RequestId: event.RequestId,
+	})
+	if err != nil {
+		event.Reply(ErrorMessage(NewProtocolError(Internal, "Could not process event")))
+	}
+	return true
+}
+
+// Id of the match or game a decoded event is about
+func EventTarget(event Event) (uuid.UUID, bool) {
+	var id string
+	switch payload := event.Payload.(type) {
+	case IdPayload:
+		id = string(payload)
+	case CardDiscardedPayload:
+		id = payload.GameId
+	case PlayCardPayload:
+		id = payload.GameId
+	case CombatPayload:
+		id = payload.GameId
+	case ResumePayload:
+		id = payload.GameId
+	default:
+		return uuid.Nil, false
+	}
+
+	parsed, err := uuid.Parse(id)
+	return parsed, err == nil
+}
+
+// Records that a local socket has a match or game on instance
+func (c *Cluster) remember(socketId uuid.UUID, instance string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.local[socketId]; !ok {
+		return
+	}
+	if c.remotes[socketId] == nil {
+		c.remotes[socketId] = make(map[string]bool)
+	}
+	c.remotes[socketId][instance] = true
+}
+
+func (c *Cluster) post(instance string, kind EnvelopeKind, socket RemoteSocket, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err == nil {
+		err = c.store.Post(instance, Envelope{Kind: kind, From: c.instance, Socket: socket, Data: encoded})
+	}
+	if err != nil {
+		c.logger.With(Fields{"to": instance, "kind": kind, "error": err}).Error("could not post")
+	}
+	return err
+}
+
+func (c *Cluster) deliver(envelope Envelope) {
+	logger := c.logger.With(Fields{"from": envelope.From, "kind": envelope.Kind, "socket_id": envelope.Socket.Id})
+
+	switch envelope.Kind {
+	case ForwardedEvent:
+		var forwarded forwardedEvent
+		if err := json.Unmarshal(envelope.Data, &forwarded); err != nil {
+			logger.With(Fields{"error": err}).Warn("invalid forwarded event")
+			return
+		}
+		c.handle(envelope.Socket, forwarded)
+	case RelayedResponse, ClosedSocket:
+		var relayed relayedResponse
+		if err := json.Unmarshal(envelope.Data, &relayed); err != nil {
+			logger.With(Fields{"error": err}).Warn("invalid relayed response")
+			return
+		}
+
+		c.mutex.Lock()
+		socket, ok := c.local[envelope.Socket.Id]
+		c.mutex.Unlock()
+
+		if !ok {
+			logger.Debug("socket is gone")
+			return
+		}
+		c.remember(socket.Id, envelope.From)
+
+		response := Response{Type: relayed.Type, Payload: relayed.Payload, RequestId: relayed.RequestId, Seq: relayed.Seq}
+		if envelope.Kind == ClosedSocket {
+			socket.Close(response)
+		} else {
+			socket.Send(response)
+		}
+	default:
+		logger.Warn("unknown envelope")
+	}
+}
+
+// Processes an event a client connected elsewhere sent about a match or
+// game owned here
+func (c *Cluster) handle(remote RemoteSocket, forwarded forwardedEvent) {
+	c.mutex.Lock()
+	socket, known := c.proxies[remote.Id]
+	if !known && forwarded.Type != Disconnected {
+		socket = c.proxy(remote)
+	}
+	c.mutex.Unlock()
+
+	if forwarded.Type == Disconnected {
+		if known {
+			socket.transport.Close()
+		}
+		return
+	}
+
+	event := Event{Type: forwarded.Type, Player: socket, Payload: forwarded.Payload, RequestId: forwarded.RequestId}
+
+	// already validated at home, decoded again to get typed payloads
+	event, err := DecodeEvent(event)
+	if err != nil {
+		event.Reply(ErrorMessage(err))
+		return
+	}
+	c.server.ProcessEvent(event)
+}
+
+type forwardedEvent struct {
+	Type      EventType   `json:"type"`
+	Payload   interface{} `json:"payload"`
+	RequestId string      `json:"request_id,omitempty"`
+}
+
+type relayedResponse struct {
+	Type      ResponseType    `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	RequestId string          `json:"request_id,omitempty"`
+	Seq       uint64          `json:"seq,omitempty"`
+}
+
+var errRemoteClosed = errors.New("remote socket closed")
+
+// Transport of proxy sockets, messages are relayed to the instance the
+// client is connected to
+type remoteTransport struct {
+	cluster *Cluster
+	remote  RemoteSocket
+	closed  chan struct{}
+	once    *sync.Once
+}
+
+// Proxies get their events from the cluster, this only waits for Close
+func (t *remoteTransport) ReadEvent() (Event, error) {
+	<-t.closed
+	return Event{}, errRemoteClosed
+}
+
+func (t *remoteTransport) WriteResponse(response Response) error {
+	return t.cluster.post(t.remote.Instance, RelayedResponse, t.remote, response)
+}
+
+func (t *remoteTransport) Ping() error {
+	return nil
+}
+
+func (t *remoteTransport) CloseWith(response Response) {
+	t.cluster.post(t.remote.Instance, ClosedSocket, t.remote, response)
+}
+
+func (t *remoteTransport) Close() error {
+	t.once.Do(func() {
+		close(t.closed)
+	})
+	return nil
+}
@@ -0,0 +1,189 @@
+package pkg
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Starts an instance sharing store, returning the url clients connect to
+func NewClusterServer(t *testing.T, instance string, store Store) string {
+	config := DefaultConfig()
+	config.DisconnectTimeout = 500 * time.Millisecond
+	config.SessionSecret = "cluster-secret"
+
+	server := NewServerWithConfig(config)
+	server.RegisterHandler(NewQueueManagerWithConfig(config))
+	server.RegisterHandler(NewMatchManagerWithConfig(config))
+	server.RegisterHandler(NewGameManagerWithConfig(config))
+
+	cluster := NewCluster(instance, store)
+	server.Join(cluster)
+
+	listener := httptest.NewServer(server.Handler())
+	t.Cleanup(func() {
+		cluster.Stop()
+		listener.Close()
+	})
+	return "ws" + strings.TrimPrefix(listener.URL, "http")
+}
+
+func DialClusterServer(t *testing.T, url string) *websocket.Conn {
+	socket, _ := DialClusterSession(t, url, "")
+	return socket
+}
+
+// Connects resuming the session of token if given, returning the token of
+// the session started
+func DialClusterSession(t *testing.T, url string, token string) (*websocket.Conn, string) {
+	if token != "" {
+		url += "?token=" + token
+	}
+	socket, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { socket.Close() })
+
+	session := ReadResponse(t, socket, SessionStarted)["payload"].(map[string]interface{})
+	return socket, session["token"].(string)
+}
+
+func TestCluster(t *testing.T) {
+	for name, open := range NewTestStores(t) {
+		t.Run("plays across instances with "+name+" store", func(t *testing.T) {
+			store := open()
+			p1 := DialClusterServer(t, NewClusterServer(t, "a", store))
+			p2 := DialClusterServer(t, NewClusterServer(t, "b", store))
+
+			// both instances match from the same pool
+			p1.WriteJSON(map[string]interface{}{"type": QueueUp})
+			ReadResponse(t, p1, WaitForMatch)
+			p2.WriteJSON(map[string]interface{}{"type": QueueUp})
+			ReadResponse(t, p2, WaitForMatch)
+
+			matchId := ReadResponse(t, p1, ConfirmMatch)["payload"]
+			if got := ReadResponse(t, p2, ConfirmMatch)["payload"]; got != matchId {
+				t.Fatalf("Expected %v, got %v", matchId, got)
+			}
+			if owner, _ := store.Owner(uuid.MustParse(matchId.(string))); owner != "b" {
+				t.Errorf("Expected match owned by %v, got %v", "b", owner)
+			}
+
+			// the confirmation sent to a is played on b
+			p1.WriteJSON(map[string]interface{}{"type": MatchConfirmed, "payload": matchId})
+			ReadResponse(t, p1, WaitOtherPlayers)
+			p2.WriteJSON(map[string]interface{}{"type": MatchConfirmed, "payload": matchId})
+
+			gameId := ReadResponse(t, p1, StartingHand)["payload"].(map[string]interface{})["game_id"]
+			if got := ReadResponse(t, p2, StartingHand)["payload"].(map[string]interface{})["game_id"]; got != gameId {
+				t.Fatalf("Expected %v, got %v", gameId, got)
+			}
+
+			// replies come back to the right client with their request id
+			p1.WriteJSON(map[string]interface{}{
+				"type":       PlayCard,
+				"payload":    map[string]interface{}{"GameId": gameId, "CardId": uuid.New().String()},
+				"request_id": "play-1",
+			})
+			if response := ReadResponse(t, p1, Error); response["request_id"] != "play-1" {
+				t.Errorf("Expected %v, got %v", "play-1", response["request_id"])
+			}
+
+			// the owner learns about players leaving elsewhere
+			p1.Close()
+			ReadResponse(t, p2, Win)
+		})
+	}
+
+	for name, open := range NewTestStores(t) {
+		t.Run("resumes through the other instance with "+name+" store", func(t *testing.T) {
+			store := open()
+			a := NewClusterServer(t, "a", store)
+			b := NewClusterServer(t, "b", store)
+			p1, token := DialClusterSession(t, a, "")
+			p2 := DialClusterServer(t, b)
+
+			p1.WriteJSON(map[string]interface{}{"type": QueueUp})
+			ReadResponse(t, p1, WaitForMatch)
+			p2.WriteJSON(map[string]interface{}{"type": QueueUp})
+
+			matchId := ReadResponse(t, p1, ConfirmMatch)["payload"]
+			ReadResponse(t, p2, ConfirmMatch)
+			p1.WriteJSON(map[string]interface{}{"type": MatchConfirmed, "payload": matchId})
+			ReadResponse(t, p1, WaitOtherPlayers)
+			p2.WriteJSON(map[string]interface{}{"type": MatchConfirmed, "payload": matchId})
+
+			gameId := ReadResponse(t, p1, StartingHand)["payload"].(map[string]interface{})["game_id"]
+			ReadResponse(t, p2, StartingHand)
+
+			// b only accepts the token if it signs like a
+			p1.Close()
+			p1, _ = DialClusterSession(t, b, token)
+
+			// the seat is free once the owner saw the disconnect
+			for {
+				p1.WriteJSON(map[string]interface{}{
+					"type":    Resume,
+					"payload": map[string]interface{}{"GameId": gameId, "LastSeq": 0},
+				})
+
+				var response map[string]interface{}
+				for response == nil || (response["type"] != string(Resumed) && response["type"] != string(Error)) {
+					if err := p1.ReadJSON(&response); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if response["type"] == string(Resumed) {
+					if got := response["payload"].(map[string]interface{})["game_id"]; got != gameId {
+						t.Errorf("Expected %v, got %v", gameId, got)
+					}
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+
+	t.Run("finds event targets", func(t *testing.T) {
+		id := uuid.New()
+
+		events := []Event{
+			{Type: EndTurn, Payload: IdPayload(id.String())},
+			{Type: PlayCard, Payload: PlayCardPayload{GameId: id.String()}},
+			{Type: Resume, Payload: ResumePayload{GameId: id.String()}},
+		}
+		for _, event := range events {
+			if target, ok := EventTarget(event); !ok || target != id {
+				t.Errorf("Expected %v for %v, got %v", id, event.Type, target)
+			}
+		}
+
+		if _, ok := EventTarget(Event{Type: QueueUp, Payload: EmptyPayload{}}); ok {
+			t.Error("Expected no target for queue up")
+		}
+	})
+
+	t.Run("plays locally without other instances", func(t *testing.T) {
+		store := NewMemoryStore()
+		url := NewClusterServer(t, "a", store)
+		p1 := DialClusterServer(t, url)
+		p2 := DialClusterServer(t, url)
+
+		p1.WriteJSON(map[string]interface{}{"type": QueueUp})
+		ReadResponse(t, p1, WaitForMatch)
+		p2.WriteJSON(map[string]interface{}{"type": QueueUp})
+
+		matchId := ReadResponse(t, p1, ConfirmMatch)["payload"]
+		p1.WriteJSON(map[string]interface{}{"type": MatchConfirmed, "payload": matchId})
+		ReadResponse(t, p1, WaitOtherPlayers)
+
+		if envelopes, _ := store.Receive("a"); len(envelopes) != 0 {
+			t.Errorf("Expected nothing forwarded, got %v", envelopes)
+		}
+	})
+}
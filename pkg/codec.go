@@ -0,0 +1,72 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	JSON_ENCODING    = "json"
+	MSGPACK_ENCODING = "msgpack"
+)
+
+// Codec is the wire format of a connection, clients pick one at connect
+// time and every event and response on it uses the same encoding
+type Codec interface {
+	Name() string
+	// Websocket frame type the encoded messages are sent in
+	MessageType() int
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type JSONCodec struct{}
+
+func (c JSONCodec) Name() string {
+	return JSON_ENCODING
+}
+
+func (c JSONCodec) MessageType() int {
+	return websocket.TextMessage
+}
+
+func (c JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (c JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// MsgpackCodec is a compact binary alternative to JSON, messages have the
+// same fields and shapes, only their encoding differs
+type MsgpackCodec struct{}
+
+func (c MsgpackCodec) Name() string {
+	return MSGPACK_ENCODING
+}
+
+func (c MsgpackCodec) MessageType() int {
+	return websocket.BinaryMessage
+}
+
+func (c MsgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return MarshalMsgpack(v)
+}
+
+func (c MsgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return UnmarshalMsgpack(data, v)
+}
+
+// Finds the codec for an encoding name, an empty name means JSON
+func ParseCodec(name string) (Codec, error) {
+	switch name {
+	case "", JSON_ENCODING:
+		return JSONCodec{}, nil
+	case MSGPACK_ENCODING:
+		return MsgpackCodec{}, nil
+	}
+	return nil, fmt.Errorf("Unsupported encoding %q", name)
+}
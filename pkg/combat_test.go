@@ -19,10 +19,12 @@ func TestCombat(t *testing.T) {
 		response := <-p1.Outgoing // start turn
 		payload := response.Payload.(TurnPayload)
 
-		attacker := payload.Cards[0].(*Minion)
+		// messages carry copies, tweak the card actually in hand
+		attacker := game.GetPlayers()[p1].Hand.Find(payload.Cards[0].GetId()).(*Minion)
 		attacker.Mana = 1
 		attacker.Damage = 1
 		attacker.Health = 1
+		attacker.Ability = nil
 
 		game.PlayCard(attacker.Id, p1)
 
@@ -35,10 +37,11 @@ func TestCombat(t *testing.T) {
 		response = <-p2.Outgoing // start turn
 		payload = response.Payload.(TurnPayload)
 
-		defender := payload.Cards[0].(*Minion)
+		defender := game.GetPlayers()[p2].Hand.Find(payload.Cards[0].GetId()).(*Minion)
 		defender.Mana = 1
 		defender.Damage = 1
 		defender.Health = 2
+		defender.Ability = nil
 
 		game.PlayCard(defender.Id, p2)
 		<-p1.Outgoing // card played
@@ -312,8 +315,8 @@ func TestCombat(t *testing.T) {
 			t.Errorf("Expected %v health, got %v", 0, player.Health)
 		}
 
-		if _, ok := manager.games[game.Id]; ok {
-			t.Errorf("Expected game to be removed, got %v", manager.games)
+		if _, err := manager.findGame(game.Id.String()); ErrorCodeOf(err) != GameNotFound {
+			t.Errorf("Expected game to be removed, got %v", manager.Games())
 		}
 
 		select {
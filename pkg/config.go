@@ -0,0 +1,406 @@
+package pkg
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prefix of the environment variables overriding settings, a setting named
+// turn-duration is read from CARD_SERVER_TURN_DURATION
+const ENV_PREFIX = "CARD_SERVER_"
+
+// Config holds every tunable value of the server. Values are layered, from
+// lowest to highest priority: defaults, config file, env vars and flags
+type Config struct {
+	Addr       string
+	CardsFile  string
+	ConfigFile string
+
+	AllowedOrigins      []string
+	MaxConnections      int
+	MaxConnectionsPerIP int
+
+	TLSAddr            string
+	TLSCert            string
+	TLSKey             string
+	CertReloadInterval time.Duration
+
+	MatchSize         int
+	ConfirmTimeout    time.Duration
+	MulliganDuration  time.Duration
+	TurnDuration      time.Duration
+	DisconnectTimeout time.Duration
+	ReplayBuffer      int
+
+	RatingWindow        int
+	RatingWindowGrowth  int
+	MaxRatingWindow     int
+	MatchmakingInterval time.Duration
+
+	SessionSecret string
+	SessionTTL    time.Duration
+
+	AdminToken string
+
+	Store    string
+	StoreDir string
+	Instance string
+
+	Socket     SocketConfig
+	RateLimits RateLimits
+
+	ShutdownTimeout time.Duration
+	SnapshotFile    string
+
+	LogLevel  string
+	LogFormat string
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Addr:      "0.0.0.0:8080",
+		CardsFile: "../cards.json",
+
+		CertReloadInterval: CERT_RELOAD_INTERVAL,
+
+		MatchSize:         NUM_OF_PLAYERS,
+		ConfirmTimeout:    30 * time.Second,
+		MulliganDuration:  30 * time.Second,
+		TurnDuration:      75 * time.Second,
+		DisconnectTimeout: 30 * time.Second,
+		ReplayBuffer:      REPLAY_BUFFER,
+
+		RatingWindow:        100,
+		RatingWindowGrowth:  10,
+		MatchmakingInterval: MATCHMAKING_INTERVAL,
+
+		SessionTTL: SESSION_TTL,
+
+		Socket:     DefaultSocketConfig(),
+		RateLimits: DefaultRateLimits(),
+
+		ShutdownTimeout: 2 * time.Minute,
+		SnapshotFile:    "games.snapshot.json",
+
+		Store: MEMORY_STORE,
+
+		LogLevel:  "info",
+		LogFormat: "text",
+	}
+}
+
+type setting struct {
+	name  string
+	usage string
+	bind  func(config *Config) flag.Value
+}
+
+// Settings known to the server, each one can be set from the config file
+// (with underscores), env vars and flags
+var settings = []setting{
+	{"addr", "address to listen on, empty to only serve TLS", func(c *Config) flag.Value { return (*stringValue)(&c.Addr) }},
+	{"allowed-origins", "comma separated origins allowed to connect, * for any, same origin if empty", func(c *Config) flag.Value { return (*listValue)(&c.AllowedOrigins) }},
+	{"max-connections", "maximum concurrent connections, 0 for unlimited", func(c *Config) flag.Value { return (*intValue)(&c.MaxConnections) }},
+	{"max-connections-per-ip", "maximum concurrent connections per address, 0 for unlimited", func(c *Config) flag.Value { return (*intValue)(&c.MaxConnectionsPerIP) }},
+	{"tls-addr", "address to listen on with TLS, empty to disable", func(c *Config) flag.Value { return (*stringValue)(&c.TLSAddr) }},
+	{"tls-cert", "path to the TLS certificate", func(c *Config) flag.Value { return (*stringValue)(&c.TLSCert) }},
+	{"tls-key", "path to the TLS private key", func(c *Config) flag.Value { return (*stringValue)(&c.TLSKey) }},
+	{"cert-reload-interval", "how often TLS files are checked for rotation", func(c *Config) flag.Value { return (*durationValue)(&c.CertReloadInterval) }},
+	{"cards-file", "path to the cards definition file", func(c *Config) flag.Value { return (*stringValue)(&c.CardsFile) }},
+	{"match-size", "players per match, only 2 is supported", func(c *Config) flag.Value { return (*intValue)(&c.MatchSize) }},
+	{"confirm-timeout", "time players have to confirm a match", func(c *Config) flag.Value { return (*durationValue)(&c.ConfirmTimeout) }},
+	{"mulligan-duration", "time players have to discard their starting hand", func(c *Config) flag.Value { return (*durationValue)(&c.MulliganDuration) }},
+	{"turn-duration", "duration of each turn", func(c *Config) flag.Value { return (*durationValue)(&c.TurnDuration) }},
+	{"disconnect-timeout", "time a disconnected player has to come back", func(c *Config) flag.Value { return (*durationValue)(&c.DisconnectTimeout) }},
+	{"replay-buffer", "messages kept per player for replaying to reconnecting clients", func(c *Config) flag.Value { return (*intValue)(&c.ReplayBuffer) }},
+	{"rating-window", "rating difference accepted between players right away", func(c *Config) flag.Value { return (*intValue)(&c.RatingWindow) }},
+	{"rating-window-growth", "rating difference accepted on top for every second waited", func(c *Config) flag.Value { return (*intValue)(&c.RatingWindowGrowth) }},
+	{"max-rating-window", "largest rating difference ever accepted, 0 for no limit", func(c *Config) flag.Value { return (*intValue)(&c.MaxRatingWindow) }},
+	{"matchmaking-interval", "how often waiting players are matched again as their window grows", func(c *Config) flag.Value { return (*durationValue)(&c.MatchmakingInterval) }},
+	{"session-secret", "secret used to sign session tokens, random if empty, required by the file store so every instance accepts the same tokens", func(c *Config) flag.Value { return (*stringValue)(&c.SessionSecret) }},
+	{"session-ttl", "how long session tokens are valid", func(c *Config) flag.Value { return (*durationValue)(&c.SessionTTL) }},
+	{"admin-token", "bearer token for the admin API, disabled if empty", func(c *Config) flag.Value { return (*stringValue)(&c.AdminToken) }},
+	{"store", "where matchmaking and game ownership are kept, memory or file to share them between instances", func(c *Config) flag.Value { return (*stringValue)(&c.Store) }},
+	{"store-dir", "directory of the file store, shared by every instance using it", func(c *Config) flag.Value { return (*stringValue)(&c.StoreDir) }},
+	{"instance", "name of this instance in the store, host and pid if empty", func(c *Config) flag.Value { return (*stringValue)(&c.Instance) }},
+	{"ping-interval", "interval between websocket pings", func(c *Config) flag.Value { return (*durationValue)(&c.Socket.PingInterval) }},
+	{"pong-wait", "time to wait for a pong before dropping a client", func(c *Config) flag.Value { return (*durationValue)(&c.Socket.PongWait) }},
+	{"write-wait", "time allowed to write a message", func(c *Config) flag.Value { return (*durationValue)(&c.Socket.WriteWait) }},
+	{"send-buffer", "messages queued per client before applying the slow consumer policy", func(c *Config) flag.Value { return (*intValue)(&c.Socket.SendBuffer) }},
+	{"slow-consumer", "drop, coalesce or disconnect", func(c *Config) flag.Value { return (*policyValue)(&c.Socket.SlowConsumer) }},
+	{"rate-limit", "events per second and burst allowed per client, as rate/burst", func(c *Config) flag.Value { return (*rateValue)(&c.RateLimits.Overall) }},
+	{"event-rate-limits", "per event type budgets, as type=rate/burst separated by commas", func(c *Config) flag.Value { return (*rateMapValue)(&c.RateLimits.Events) }},
+	{"max-strikes", "throttled events before a client is disconnected, 0 to never disconnect", func(c *Config) flag.Value { return (*intValue)(&c.RateLimits.MaxStrikes) }},
+	{"strike-window", "quiet time after which strikes are forgiven", func(c *Config) flag.Value { return (*durationValue)(&c.RateLimits.StrikeWindow) }},
+	{"shutdown-timeout", "time running games have to finish on shutdown", func(c *Config) flag.Value { return (*durationValue)(&c.ShutdownTimeout) }},
+	{"snapshot-file", "where unfinished games are persisted on shutdown", func(c *Config) flag.Value { return (*stringValue)(&c.SnapshotFile) }},
+	{"log-level", "debug, info, warn or error", func(c *Config) flag.Value { return (*stringValue)(&c.LogLevel) }},
+	{"log-format", "text or json", func(c *Config) flag.Value { return (*stringValue)(&c.LogFormat) }},
+}
+
+// Builds the configuration from the command line arguments and environment,
+// the config file is given by the -config flag or CARD_SERVER_CONFIG
+func LoadConfig(args []string, getenv func(string) string) (Config, error) {
+	config := DefaultConfig()
+
+	// parse flags into a scratch config first, they are applied last so
+	// they win over the file and env vars
+	scratch := DefaultConfig()
+	flags := flag.NewFlagSet("card-server", flag.ContinueOnError)
+	flags.StringVar(&config.ConfigFile, "config", getenv(ENV_PREFIX+"CONFIG"), "path to a JSON config file")
+	for _, setting := range settings {
+		flags.Var(setting.bind(&scratch), setting.name, setting.usage)
+	}
+	if err := flags.Parse(args); err != nil {
+		return config, err
+	}
+
+	if config.ConfigFile != "" {
+		if err := config.loadFile(config.ConfigFile); err != nil {
+			return config, err
+		}
+	}
+
+	for _, setting := range settings {
+		if value := getenv(envName(setting.name)); value != "" {
+			if err := setting.bind(&config).Set(value); err != nil {
+				return config, fmt.Errorf("invalid %v: %v", envName(setting.name), err)
+			}
+		}
+	}
+
+	var err error
+	flags.Visit(func(f *flag.Flag) {
+		for _, setting := range settings {
+			if setting.name == f.Name && err == nil {
+				err = setting.bind(&config).Set(f.Value.String())
+			}
+		}
+	})
+	if err != nil {
+		return config, err
+	}
+
+	return config, config.Validate()
+}
+
+func (c *Config) loadFile(filename string) error {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]interface{}{}
+	if err := json.Unmarshal(contents, &values); err != nil {
+		return fmt.Errorf("invalid config file %v: %v", filename, err)
+	}
+
+	for key, value := range values {
+		setting, ok := findSetting(strings.ReplaceAll(key, "_", "-"))
+		if !ok {
+			return fmt.Errorf("unknown setting %q in %v", key, filename)
+		}
+		// lists may be given as JSON arrays
+		if list, ok := value.([]interface{}); ok {
+			items := []string{}
+			for _, item := range list {
+				items = append(items, fmt.Sprint(item))
+			}
+			value = strings.Join(items, ",")
+		}
+		if err := setting.bind(c).Set(fmt.Sprint(value)); err != nil {
+			return fmt.Errorf("invalid %v in %v: %v", key, filename, err)
+		}
+	}
+	return nil
+}
+
+func (c Config) Validate() error {
+	if c.Addr == "" && c.TLSAddr == "" {
+		return fmt.Errorf("addr or tls-addr is required")
+	}
+	if c.TLSAddr != "" && (c.TLSCert == "" || c.TLSKey == "") {
+		return fmt.Errorf("tls-cert and tls-key are required to serve TLS")
+	}
+	// games and matches only know how to handle two players so far
+	if c.MatchSize != NUM_OF_PLAYERS {
+		return fmt.Errorf("match-size must be %v, got %v", NUM_OF_PLAYERS, c.MatchSize)
+	}
+	if c.MaxConnections < 0 || c.MaxConnectionsPerIP < 0 {
+		return fmt.Errorf("connection limits cannot be negative")
+	}
+	if c.ReplayBuffer < 0 {
+		return fmt.Errorf("replay-buffer cannot be negative, got %v", c.ReplayBuffer)
+	}
+	if c.RatingWindow < 0 || c.RatingWindowGrowth < 0 || c.MaxRatingWindow < 0 {
+		return fmt.Errorf("rating windows cannot be negative")
+	}
+	if c.MatchmakingInterval <= 0 {
+		return fmt.Errorf("matchmaking-interval must be positive, got %v", c.MatchmakingInterval)
+	}
+	if c.Socket.SendBuffer < 1 {
+		return fmt.Errorf("send-buffer must be positive, got %v", c.Socket.SendBuffer)
+	}
+	if c.Socket.PingInterval >= c.Socket.PongWait {
+		return fmt.Errorf("ping-interval must be shorter than pong-wait")
+	}
+	switch c.Store {
+	case MEMORY_STORE:
+	case FILE_STORE:
+		if c.StoreDir == "" {
+			return fmt.Errorf("store-dir is required for the file store")
+		}
+		if c.SessionSecret == "" {
+			return fmt.Errorf("session-secret is required for the file store")
+		}
+	default:
+		return fmt.Errorf("unknown store %q, expected memory or file", c.Store)
+	}
+	if _, err := NewLoggerWithConfig(c); err != nil {
+		return err
+	}
+	return nil
+}
+
+func findSetting(name string) (setting, bool) {
+	for _, setting := range settings {
+		if setting.name == name {
+			return setting, true
+		}
+	}
+	return setting{}, false
+}
+
+func envName(name string) string {
+	return ENV_PREFIX + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+type stringValue string
+
+func (v *stringValue) Set(value string) error {
+	*v = stringValue(value)
+	return nil
+}
+
+func (v *stringValue) String() string {
+	return string(*v)
+}
+
+type listValue []string
+
+func (v *listValue) Set(value string) error {
+	*v = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v = append(*v, item)
+		}
+	}
+	return nil
+}
+
+func (v *listValue) String() string {
+	return strings.Join(*v, ",")
+}
+
+type intValue int
+
+func (v *intValue) Set(value string) error {
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	*v = intValue(parsed)
+	return nil
+}
+
+func (v *intValue) String() string {
+	return strconv.Itoa(int(*v))
+}
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(value string) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*v = durationValue(parsed)
+	return nil
+}
+
+func (v *durationValue) String() string {
+	return time.Duration(*v).String()
+}
+
+type rateValue RateLimit
+
+func (v *rateValue) Set(value string) error {
+	limit, err := ParseRateLimit(value)
+	if err != nil {
+		return err
+	}
+	*v = rateValue(limit)
+	return nil
+}
+
+func (v *rateValue) String() string {
+	return RateLimit(*v).String()
+}
+
+// Replaces the budgets of the given event types, others keep their default
+type rateMapValue map[EventType]RateLimit
+
+func (v *rateMapValue) Set(value string) error {
+	limits := make(map[EventType]RateLimit)
+	for eventType, limit := range *v {
+		limits[eventType] = limit
+	}
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid event rate limit %q, expected type=rate/burst", item)
+		}
+		limit, err := ParseRateLimit(parts[1])
+		if err != nil {
+			return err
+		}
+		limits[EventType(strings.TrimSpace(parts[0]))] = limit
+	}
+
+	*v = limits
+	return nil
+}
+
+func (v *rateMapValue) String() string {
+	items := []string{}
+	for eventType, limit := range *v {
+		items = append(items, fmt.Sprintf("%v=%v", eventType, limit))
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+type policyValue SlowConsumerPolicy
+
+func (v *policyValue) Set(value string) error {
+	switch policy := SlowConsumerPolicy(value); policy {
+	case DropMessages, CoalesceUpdates, DisconnectClient:
+		*v = policyValue(policy)
+		return nil
+	}
+	return fmt.Errorf("unknown policy %q", value)
+}
+
+func (v *policyValue) String() string {
+	return string(*v)
+}
@@ -0,0 +1,146 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfig(t *testing.T) {
+	noEnv := func(string) string { return "" }
+
+	t.Run("defaults", func(t *testing.T) {
+		config, err := LoadConfig(nil, noEnv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.TurnDuration != 75*time.Second {
+			t.Errorf("Expected %v, got %v", 75*time.Second, config.TurnDuration)
+		}
+		if config.Addr != "0.0.0.0:8080" {
+			t.Errorf("Expected %v, got %v", "0.0.0.0:8080", config.Addr)
+		}
+	})
+
+	t.Run("layers", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "config.json")
+		contents := `{"turn_duration": "10s", "mulligan_duration": "5s", "addr": ":9000", "send_buffer": 32}`
+		if err := os.WriteFile(filename, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		env := map[string]string{
+			"CARD_SERVER_CONFIG":            filename,
+			"CARD_SERVER_MULLIGAN_DURATION": "7s",
+			"CARD_SERVER_ADDR":              ":9001",
+		}
+		args := []string{"-addr", ":9002"}
+
+		config, err := LoadConfig(args, func(key string) string { return env[key] })
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// file over defaults
+		if config.TurnDuration != 10*time.Second {
+			t.Errorf("Expected %v, got %v", 10*time.Second, config.TurnDuration)
+		}
+		if config.Socket.SendBuffer != 32 {
+			t.Errorf("Expected %v, got %v", 32, config.Socket.SendBuffer)
+		}
+		// env over file
+		if config.MulliganDuration != 7*time.Second {
+			t.Errorf("Expected %v, got %v", 7*time.Second, config.MulliganDuration)
+		}
+		// flags over env
+		if config.Addr != ":9002" {
+			t.Errorf("Expected %v, got %v", ":9002", config.Addr)
+		}
+		// untouched settings keep their default
+		if config.ConfirmTimeout != 30*time.Second {
+			t.Errorf("Expected %v, got %v", 30*time.Second, config.ConfirmTimeout)
+		}
+	})
+
+	t.Run("unknown setting in file", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(filename, []byte(`{"turn_length": "10s"}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := LoadConfig([]string{"-config", filename}, noEnv); err == nil {
+			t.Error("Expected error for unknown setting")
+		}
+	})
+
+	t.Run("lists", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "config.json")
+		contents := `{"allowed_origins": ["https://a.com", "https://b.com"]}`
+		if err := os.WriteFile(filename, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		config, err := LoadConfig([]string{"-config", filename}, noEnv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(config.AllowedOrigins) != 2 || config.AllowedOrigins[1] != "https://b.com" {
+			t.Errorf("Expected %v, got %v", []string{"https://a.com", "https://b.com"}, config.AllowedOrigins)
+		}
+
+		config, err = LoadConfig([]string{"-allowed-origins", "https://c.com, *"}, noEnv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(config.AllowedOrigins) != 2 || config.AllowedOrigins[1] != "*" {
+			t.Errorf("Expected %v, got %v", []string{"https://c.com", "*"}, config.AllowedOrigins)
+		}
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		if _, err := LoadConfig([]string{"-turn-duration", "soon"}, noEnv); err == nil {
+			t.Error("Expected error for invalid duration")
+		}
+		if _, err := LoadConfig([]string{"-slow-consumer", "ignore"}, noEnv); err == nil {
+			t.Error("Expected error for invalid policy")
+		}
+		if _, err := LoadConfig([]string{"-match-size", "1"}, noEnv); err == nil {
+			t.Error("Expected error for invalid match size")
+		}
+		if _, err := LoadConfig([]string{"-match-size", "4"}, noEnv); err == nil {
+			t.Error("Expected error for unsupported match size")
+		}
+		if _, err := LoadConfig([]string{"-log-level", "loud"}, noEnv); err == nil {
+			t.Error("Expected error for invalid log level")
+		}
+		if _, err := LoadConfig([]string{"-log-format", "xml"}, noEnv); err == nil {
+			t.Error("Expected error for invalid log format")
+		}
+		if _, err := LoadConfig([]string{"-store", "redis"}, noEnv); err == nil {
+			t.Error("Expected error for invalid store")
+		}
+		if _, err := LoadConfig([]string{"-store", "file"}, noEnv); err == nil {
+			t.Error("Expected error for file store without directory")
+		}
+		if _, err := LoadConfig([]string{"-store", "file", "-store-dir", t.TempDir()}, noEnv); err == nil {
+			t.Error("Expected error for file store without session secret")
+		}
+	})
+
+	t.Run("feeds managers", func(t *testing.T) {
+		config := DefaultConfig()
+		config.TurnDuration = 5 * time.Second
+		config.MulliganDuration = 2 * time.Second
+
+		manager := NewGameManagerWithConfig(config)
+		game := manager.CreateGame([]*Socket{NewTestSocket(), NewTestSocket()})
+
+		if game.turnDuration != config.TurnDuration {
+			t.Errorf("Expected %v, got %v", config.TurnDuration, game.turnDuration)
+		}
+		if manager.mulligan != config.MulliganDuration {
+			t.Errorf("Expected %v, got %v", config.MulliganDuration, manager.mulligan)
+		}
+	})
+}
@@ -55,13 +55,14 @@ func (d *Deck) Pop() Card {
 	return card.(Card)
 }
 
+// Takes up to qty cards from the top, fewer if the deck runs out
 func (d *Deck) Draw(qty int) *list.List {
-	if d.cards.Len() == 0 {
-		return nil
-	}
 	cards := list.New()
 	for i := 0; i < qty; i++ {
 		card := d.Pop()
+		if card == nil {
+			break
+		}
 		cards.PushBack(card)
 	}
 	return cards
@@ -0,0 +1,141 @@
+package pkg
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/google/uuid"
+	"github.com/mitchellh/mapstructure"
+)
+
+// Payload is the typed body of a client event
+type Payload interface {
+	Validate() error
+}
+
+// Schemas of the events clients are allowed to send, events without a
+// schema are internal and rejected when coming from a socket
+var schemas = map[EventType]func() Payload{
+	Hello:          func() Payload { return &HelloPayload{} },
+	QueueUp:        func() Payload { return &EmptyPayload{} },
+	Dequeue:        func() Payload { return &EmptyPayload{} },
+	MatchConfirmed: func() Payload { return new(IdPayload) },
+	MatchDeclined:  func() Payload { return new(IdPayload) },
+	CardDiscarded:  func() Payload { return &CardDiscardedPayload{} },
+	EndTurn:        func() Payload { return new(IdPayload) },
+	PlayCard:       func() Payload { return &PlayCardPayload{} },
+	Attack:         func() Payload { return &CombatPayload{} },
+	AttackPlayer:   func() Payload { return &CombatPayload{} },
+	Reconnected:    func() Payload { return new(IdPayload) },
+	RequestState:   func() Payload { return new(IdPayload) },
+	Resume:         func() Payload { return &ResumePayload{} },
+}
+
+// Validates an event coming from a client against its schema and replaces
+// its payload with the decoded one
+func DecodeEvent(event Event) (Event, error) {
+	schema, ok := schemas[event.Type]
+	if !ok {
+		return event, NewProtocolError(InvalidPayload, fmt.Sprintf("Unknown event type %q", event.Type))
+	}
+
+	payload := schema()
+	if err := DecodePayload(event, payload); err != nil {
+		return event, err
+	}
+
+	event.Payload = reflect.ValueOf(payload).Elem().Interface()
+	return event, nil
+}
+
+// Strictly decodes an event payload into out, unknown fields and mismatched
+// types are rejected instead of being ignored or panicking
+func DecodePayload(event Event, out Payload) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		ErrorUnused: true,
+		Result:      out,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := decoder.Decode(event.Payload); err != nil {
+		return NewProtocolError(InvalidPayload, fmt.Sprintf("Invalid %v payload: %v", event.Type, err))
+	}
+
+	if err := out.Validate(); err != nil {
+		return NewProtocolError(InvalidPayload, fmt.Sprintf("Invalid %v payload: %v", event.Type, err))
+	}
+	return nil
+}
+
+// Handlers get events decoded by DecodeEvent, whether they came from a
+// client or were forwarded by another instance. Anything else is refused
+func UndecodedPayload(event Event) error {
+	return NewProtocolError(InvalidPayload, fmt.Sprintf("Invalid %v payload: %T", event.Type, event.Payload))
+}
+
+// EmptyPayload is used by events that carry no data
+type EmptyPayload struct{}
+
+func (p EmptyPayload) Validate() error {
+	return nil
+}
+
+// IdPayload is a bare id, used by events that only reference an entity
+type IdPayload string
+
+func (p IdPayload) Validate() error {
+	return validateId(string(p), "id")
+}
+
+// Parsed id, only meaningful after the payload was validated
+func (p IdPayload) Id() uuid.UUID {
+	id, _ := uuid.Parse(string(p))
+	return id
+}
+
+// Versions are checked when negotiating, refused with their own code
+func (p HelloPayload) Validate() error {
+	return nil
+}
+
+func (p CardDiscardedPayload) Validate() error {
+	if err := validateId(p.GameId, "GameId"); err != nil {
+		return err
+	}
+	for _, cardId := range p.Cards {
+		if err := validateId(cardId, "Cards"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p PlayCardPayload) Validate() error {
+	if err := validateId(p.GameId, "GameId"); err != nil {
+		return err
+	}
+	return validateId(p.CardId, "CardId")
+}
+
+func (p ResumePayload) Validate() error {
+	return validateId(p.GameId, "GameId")
+}
+
+func (p CombatPayload) Validate() error {
+	if err := validateId(p.GameId, "GameId"); err != nil {
+		return err
+	}
+	if err := validateId(p.Attacker, "Attacker"); err != nil {
+		return err
+	}
+	return validateId(p.Defender, "Defender")
+}
+
+func validateId(id string, field string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("'%v' must be a valid uuid, got %q", field, id)
+	}
+	return nil
+}
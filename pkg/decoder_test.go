@@ -0,0 +1,87 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestDecodeEvent(t *testing.T) {
+	t.Run("decodes client payloads", func(t *testing.T) {
+		gameId := uuid.NewString()
+		cardId := uuid.NewString()
+
+		event, err := DecodeEvent(Event{
+			Type: PlayCard,
+			Payload: map[string]interface{}{
+				"GameId": gameId,
+				"CardId": cardId,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		payload := event.Payload.(PlayCardPayload)
+		if payload.GameId != gameId || payload.CardId != cardId {
+			t.Errorf("Expected %v/%v, got %+v", gameId, cardId, payload)
+		}
+	})
+
+	t.Run("decodes bare ids", func(t *testing.T) {
+		gameId := uuid.New()
+
+		event, err := DecodeEvent(Event{Type: EndTurn, Payload: gameId.String()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.Payload.(IdPayload).Id() != gameId {
+			t.Errorf("Expected %v, got %v", gameId, event.Payload)
+		}
+	})
+
+	t.Run("accepts events without payload", func(t *testing.T) {
+		if _, err := DecodeEvent(Event{Type: QueueUp}); err != nil {
+			t.Error(err)
+		}
+	})
+
+	invalid := map[string]Event{
+		"wrong type":       {Type: MatchConfirmed, Payload: 42.0},
+		"invalid uuid":     {Type: EndTurn, Payload: "not-an-id"},
+		"missing field":    {Type: PlayCard, Payload: map[string]interface{}{"GameId": uuid.NewString()}},
+		"unknown field":    {Type: QueueUp, Payload: map[string]interface{}{"rank": "gold"}},
+		"wrong field type": {Type: Attack, Payload: map[string]interface{}{"GameId": 1.0}},
+		"wrong list item":  {Type: CardDiscarded, Payload: map[string]interface{}{"GameId": uuid.NewString(), "Cards": []interface{}{1.0}}},
+		"internal event":   {Type: CreateGame, Payload: []interface{}{}},
+		"fake disconnect":  {Type: Disconnected},
+		"unknown event":    {Type: "play_sound"},
+	}
+
+	for name, event := range invalid {
+		t.Run("rejects "+name, func(t *testing.T) {
+			_, err := DecodeEvent(event)
+			if ErrorCodeOf(err) != InvalidPayload {
+				t.Errorf("Expected %v, got %v", InvalidPayload, err)
+			}
+		})
+	}
+}
+
+func TestMalformedPayloadDoesNotPanic(t *testing.T) {
+	player := NewTestSocket()
+	manager := NewMatchManager(time.Second)
+
+	// a number instead of a match id used to panic on type assertion
+	manager.Process(Event{Type: MatchConfirmed, Player: player, Payload: 42.0})
+
+	select {
+	case <-time.After(100 * time.Millisecond):
+		t.Error("Expected error response")
+	case response := <-player.Outgoing:
+		if code := response.Payload.(*ProtocolError).Code; code != InvalidPayload {
+			t.Errorf("Expected %v, got %v", InvalidPayload, code)
+		}
+	}
+}
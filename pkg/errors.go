@@ -0,0 +1,73 @@
+package pkg
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+type ErrorCode string
+
+const (
+	Internal            ErrorCode = "internal"
+	InvalidPayload      ErrorCode = "invalid_payload"
+	UnsupportedProtocol ErrorCode = "unsupported_protocol"
+	HandshakeDone       ErrorCode = "handshake_done"
+	SlowConsumer        ErrorCode = "slow_consumer"
+	ServerShuttingDown  ErrorCode = "server_shutting_down"
+	RateLimited         ErrorCode = "rate_limited"
+	AlreadyQueued       ErrorCode = "already_queued"
+	NotQueued           ErrorCode = "not_queued"
+	MatchNotFound       ErrorCode = "match_not_found"
+	NotInMatch          ErrorCode = "not_in_match"
+	AlreadyConfirmed    ErrorCode = "already_confirmed"
+	GameNotFound        ErrorCode = "game_not_found"
+	NotInGame           ErrorCode = "not_in_game"
+	NotYourTurn         ErrorCode = "not_your_turn"
+	AlreadyReady        ErrorCode = "already_ready"
+	CardNotFound        ErrorCode = "card_not_found"
+	NotEnoughMana       ErrorCode = "not_enough_mana"
+	BoardFull           ErrorCode = "board_full"
+	MinionNotFound      ErrorCode = "minion_not_found"
+	MinionExhausted     ErrorCode = "minion_exhausted"
+	TargetNotFound      ErrorCode = "target_not_found"
+	PlayerNotFound      ErrorCode = "player_not_found"
+	CannotAttackSelf    ErrorCode = "cannot_attack_self"
+	DefenderHasMinions  ErrorCode = "defender_has_minions"
+	NoPlayerToReconnect ErrorCode = "no_player_to_reconnect"
+	SessionMismatch     ErrorCode = "session_mismatch"
+)
+
+// ProtocolError is a rejected client action, sent as the payload of error
+// responses so clients can react to the code instead of the message
+type ProtocolError struct {
+	Code    ErrorCode   `json:"code"`
+	Message string      `json:"message"`
+	Ids     []uuid.UUID `json:"ids,omitempty"` // offending entities, if any
+}
+
+func NewProtocolError(code ErrorCode, message string, ids ...uuid.UUID) *ProtocolError {
+	return &ProtocolError{
+		Code:    code,
+		Message: message,
+		Ids:     ids,
+	}
+}
+
+func (e *ProtocolError) Error() string {
+	return e.Message
+}
+
+// Converts any error into a protocol error, unknown errors are internal
+func AsProtocolError(err error) *ProtocolError {
+	var protocolError *ProtocolError
+	if errors.As(err, &protocolError) {
+		return protocolError
+	}
+	return NewProtocolError(Internal, err.Error())
+}
+
+// Returns the code of a protocol error or internal for unknown errors
+func ErrorCodeOf(err error) ErrorCode {
+	return AsProtocolError(err).Code
+}
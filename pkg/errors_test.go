@@ -0,0 +1,44 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestProtocolError(t *testing.T) {
+	t.Run("keeps protocol errors", func(t *testing.T) {
+		cardId := uuid.New()
+		err := fmt.Errorf("wrapped: %w", NewProtocolError(CardNotFound, "Card not found in hand", cardId))
+
+		got := AsProtocolError(err)
+		if got.Code != CardNotFound {
+			t.Errorf("Expected %v, got %v", CardNotFound, got.Code)
+		}
+		if len(got.Ids) != 1 || got.Ids[0] != cardId {
+			t.Errorf("Expected %v ids, got %v", []uuid.UUID{cardId}, got.Ids)
+		}
+	})
+
+	t.Run("wraps unknown errors", func(t *testing.T) {
+		got := AsProtocolError(errors.New("boom"))
+		if got.Code != Internal {
+			t.Errorf("Expected %v, got %v", Internal, got.Code)
+		}
+		if got.Message != "boom" {
+			t.Errorf("Expected %v, got %v", "boom", got.Message)
+		}
+	})
+
+	t.Run("downgrades for legacy clients", func(t *testing.T) {
+		socket := NewTestSocket()
+		socket.features = make(map[Feature]bool)
+
+		response := socket.Downgrade(ErrorMessage(NewProtocolError(NotEnoughMana, "Not enough mana")))
+		if response.Payload != "Not enough mana" {
+			t.Errorf("Expected %v, got %v", "Not enough mana", response.Payload)
+		}
+	})
+}
@@ -7,9 +7,17 @@ import (
 )
 
 type Event struct {
-	Type    EventType   `json:"type"`
-	Player  *Socket     `json:"player"`
-	Payload interface{} `json:"payload"`
+	Type      EventType   `json:"type"`
+	Player    *Socket     `json:"player"`
+	Payload   interface{} `json:"payload"`
+	RequestId string      `json:"request_id,omitempty"` // optional, set by clients
+}
+
+// Sends a direct reply to the player who sent this event, echoing its
+// request id so clients can match replies to their actions
+func (e Event) Reply(response Response) {
+	response.RequestId = e.RequestId
+	e.Player.Send(response)
 }
 
 type EventHandler interface {
@@ -32,11 +40,23 @@ const (
 	AttackPlayer   EventType = "attack_player"
 	Disconnected   EventType = "disconnected"
 	Reconnected    EventType = "reconnected"
+	Hello          EventType = "hello"
+	RequestState   EventType = "request_state"
+	Resume         EventType = "resume"
 )
 
 type Response struct {
-	Type    ResponseType `json:"type"`
-	Payload interface{}  `json:"payload"`
+	Type      ResponseType `json:"type"`
+	Payload   interface{}  `json:"payload"`
+	RequestId string       `json:"request_id,omitempty"`
+	Seq       uint64       `json:"seq,omitempty"` // position in the player's game stream
+}
+
+func ErrorMessage(err error) Response {
+	return Response{
+		Type:    Error,
+		Payload: AsProtocolError(err),
+	}
 }
 
 type ResponseType string
@@ -59,6 +79,14 @@ const (
 	PlayerDamageTaken ResponseType = "player_damage_taken"
 	Win               ResponseType = "win"
 	Loss              ResponseType = "loss"
+	SessionStarted    ResponseType = "session"
+	Welcome           ResponseType = "welcome"
+	ServerShutdown    ResponseType = "shutdown"
+	StateDiff         ResponseType = "state_diff"
+	FullState         ResponseType = "state"
+	Resumed           ResponseType = "resumed"
+	Kicked            ResponseType = "kicked"
+	Dequeued          ResponseType = "dequeued"
 )
 
 type StartingHandPayload struct {
@@ -93,6 +121,20 @@ type CombatPayload struct {
 	Defender string
 }
 
+// Sent by a client coming back to a game, with the last sequence it saw
+type ResumePayload struct {
+	GameId  string
+	LastSeq uint64
+}
+
+// Tells a resumed client whether the messages it missed follow, otherwise
+// it gets the whole game again like on a plain reconnect
+type ResumedPayload struct {
+	GameId   uuid.UUID `json:"game_id"`
+	LastSeq  uint64    `json:"last_seq"`
+	Replayed bool      `json:"replayed"`
+}
+
 type MinionDamagedPayload struct {
 	Attacker *ActiveMinion
 	Defender *ActiveMinion
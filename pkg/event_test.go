@@ -1,6 +1,9 @@
 package pkg
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestGainManaEvent(t *testing.T) {
 	socket := NewTestSocket()
@@ -15,7 +18,7 @@ func TestGainManaEvent(t *testing.T) {
 		if response.Type != ManaChanged {
 			t.Errorf("Expected %v type, got %v", ManaChanged, response.Type)
 		}
-		if response.Payload.(*Player) != player {
+		if response.Payload.(*Player).Id != player.Id {
 			t.Error("wrong player")
 		}
 	}
@@ -36,8 +39,37 @@ func TestAttributeChangedEvent(t *testing.T) {
 		if response.Type != AttributeChanged {
 			t.Errorf("Expected %v type, got %v", AttributeChanged, response.Type)
 		}
-		if response.Payload.(*ActiveMinion) != minion {
+		if response.Payload.(*ActiveMinion).Id != minion.Id {
 			t.Error("wrong minion")
 		}
 	}
 }
+
+func TestMessagesKeepStateWhenSent(t *testing.T) {
+	socket := NewTestSocket()
+	player := NewPlayer(socket)
+	minion := NewMinion(NewCard("test", 1, 1, 1))
+	minion.SetPlayer(player)
+	player.Board.Place(minion)
+
+	dispatcher := NewGameDispatcher()
+	dispatcher.Subscribe(DamageIncreasedEvent, player.NotifyAttributeChanges)
+	dispatcher.Subscribe(TurnStartedEvent, player.NotifyTurnStarted)
+
+	dispatcher.Dispatch(&DamageIncreased{Minion: minion})
+	dispatcher.Dispatch(NewTurnStartedEvent(player, time.Second))
+
+	// the game goes on while messages wait to be written
+	minion.SetState(Active{})
+	player.Board.Place(NewMinion(NewCard("other", 1, 1, 1)))
+
+	response := <-socket.Outgoing
+	if state := response.Payload.(*ActiveMinion).State; state != "Exhausted" {
+		t.Errorf("Expected %v, got %v", "Exhausted", state)
+	}
+
+	response = <-socket.Outgoing
+	if board := response.Payload.(TurnPayload).Board; len(board) != 1 {
+		t.Errorf("Expected %v minion, got %v", 1, len(board))
+	}
+}
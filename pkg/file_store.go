@@ -0,0 +1,212 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	STORE_STATE_FILE = "state.json"
+	STORE_LOCK_FILE  = "state.lock"
+
+	// Locks older than this are left by a crashed instance and broken
+	STALE_LOCK   = 10 * time.Second
+	LOCK_TIMEOUT = 5 * time.Second
+)
+
+var ErrStoreLocked = errors.New("store is locked")
+
+// FileStore keeps the shared state in a JSON file, so instances on the same
+// machine can share it by pointing at the same directory. Every operation
+// takes a lock file for the read, modify and write of the whole state, it
+// is meant for local setups rather than heavy traffic
+type FileStore struct {
+	dir string
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (f *FileStore) Enqueue(entry QueueEntry) error {
+	return f.update(func(state *storeState) error {
+		return state.enqueue(entry)
+	})
+}
+
+func (f *FileStore) Dequeue(socketId uuid.UUID) error {
+	return f.update(func(state *storeState) error {
+		return state.dequeue(socketId)
+	})
+}
+
+func (f *FileStore) Queued() ([]QueueEntry, error) {
+	var entries []QueueEntry
+	err := f.view(func(state *storeState) {
+		entries = state.Queue
+	})
+	return entries, err
+}
+
+func (f *FileStore) TakeMatch(size int, rule MatchRule) ([]QueueEntry, error) {
+	var entries []QueueEntry
+	err := f.update(func(state *storeState) error {
+		entries = state.takeMatch(size, rule, time.Now())
+		return nil
+	})
+	return entries, err
+}
+
+func (f *FileStore) Claim(id uuid.UUID, instance string) error {
+	return f.update(func(state *storeState) error {
+		state.Owners[id] = instance
+		return nil
+	})
+}
+
+func (f *FileStore) Owner(id uuid.UUID) (string, error) {
+	var owner string
+	err := f.view(func(state *storeState) {
+		owner = state.Owners[id]
+	})
+	return owner, err
+}
+
+func (f *FileStore) Release(id uuid.UUID) error {
+	return f.update(func(state *storeState) error {
+		delete(state.Owners, id)
+		return nil
+	})
+}
+
+func (f *FileStore) Post(instance string, envelope Envelope) error {
+	return f.update(func(state *storeState) error {
+		state.post(instance, envelope, time.Now())
+		return nil
+	})
+}
+
+// Polled all the time, the state is only written when messages were taken
+func (f *FileStore) Receive(instance string) ([]Envelope, error) {
+	var envelopes []Envelope
+	err := f.locked(func() error {
+		state, err := f.read()
+		if err != nil {
+			return err
+		}
+		if envelopes = state.receive(instance); len(envelopes) == 0 {
+			return nil
+		}
+		return f.write(state)
+	})
+	return envelopes, err
+}
+
+func (f *FileStore) Rating(player uuid.UUID) (float64, error) {
+	var rating float64
+	err := f.view(func(state *storeState) {
+		rating = state.rating(player)
+	})
+	return rating, err
+}
+
+func (f *FileStore) SetRatings(ratings map[uuid.UUID]float64) error {
+	return f.update(func(state *storeState) error {
+		state.setRatings(ratings)
+		return nil
+	})
+}
+
+func (f *FileStore) view(read func(state *storeState)) error {
+	return f.locked(func() error {
+		state, err := f.read()
+		if err != nil {
+			return err
+		}
+		read(state)
+		return nil
+	})
+}
+
+// Runs change on the current state and saves it, nothing is saved if
+// change fails
+func (f *FileStore) update(change func(state *storeState) error) error {
+	return f.locked(func() error {
+		state, err := f.read()
+		if err != nil {
+			return err
+		}
+		if err := change(state); err != nil {
+			return err
+		}
+		return f.write(state)
+	})
+}
+
+func (f *FileStore) locked(do func() error) error {
+	lock := filepath.Join(f.dir, STORE_LOCK_FILE)
+	deadline := time.Now().Add(LOCK_TIMEOUT)
+
+	for {
+		file, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			file.Close()
+			break
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > STALE_LOCK {
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return ErrStoreLocked
+		}
+		time.Sleep(time.Millisecond)
+	}
+	defer os.Remove(lock)
+
+	return do()
+}
+
+func (f *FileStore) read() (*storeState, error) {
+	state := newStoreState()
+
+	contents, err := os.ReadFile(filepath.Join(f.dir, STORE_STATE_FILE))
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(contents, state); err != nil {
+		return nil, fmt.Errorf("invalid store state: %v", err)
+	}
+	return state, nil
+}
+
+// Writes to a temporary file first, so the state is never seen half written
+func (f *FileStore) write(state *storeState) error {
+	contents, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	temporary := filepath.Join(f.dir, STORE_STATE_FILE+".tmp")
+	if err := os.WriteFile(temporary, contents, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(temporary, filepath.Join(f.dir, STORE_STATE_FILE))
+}
@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"runtime/debug"
 	"sync"
 	"time"
 
@@ -30,6 +31,7 @@ func (t *Timer) Start(duration time.Duration) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
+	t.stop()
 	t.start = time.Now()
 	t.duration = duration
 	t.timer.Reset(duration)
@@ -39,7 +41,18 @@ func (t *Timer) Stop() {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
-	t.timer.Stop()
+	t.stop()
+}
+
+// Stops the timer and drops an expiration nobody read yet, so a stopped
+// timer never fires. Only safe while nobody else reads Done
+func (t *Timer) stop() {
+	if !t.timer.Stop() {
+		select {
+		case <-t.timer.C:
+		default:
+		}
+	}
 }
 
 func (t *Timer) Done() <-chan time.Time {
@@ -54,20 +67,27 @@ func (t *Timer) Left() time.Duration {
 	return time.Duration(t.duration.Nanoseconds() - ellapsed)
 }
 
+// Game owns a loop which runs player commands, timer expirations and the
+// events they cause one at a time, in the order they arrive. Its state must
+// only be touched from that loop, exported methods hand their work to it
 type Game struct {
-	Id          uuid.UUID
-	StopTimer   chan bool
-	Reconnected chan *Socket
+	Id uuid.UUID
 
-	disconnected int
+	commands     chan func()
+	reconnects   map[int]*time.Timer // seats waiting for their player
+	finished     chan struct{}
+	finish       *sync.Once
 	timer        *Timer
 	turnDuration time.Duration
 	current      int
 	sockets      []*Socket
 	ready        []*Player
-	mutex        *sync.Mutex
 	players      map[*Socket]*Player
 	dispatcher   Dispatcher
+	logger       *Logger
+	turnStarted  time.Time
+	observeTurn  func(elapsed time.Duration)
+	observeEnd   func(winner *Player, losers []*Player)
 }
 
 func StartingHandMessage(gameId uuid.UUID, duration time.Duration, hand *Hand) Response {
@@ -75,7 +95,7 @@ func StartingHandMessage(gameId uuid.UUID, duration time.Duration, hand *Hand) R
 		Type: StartingHand,
 		Payload: StartingHandPayload{
 			Duration: duration,
-			Hand:     hand.GetCards(),
+			Hand:     SnapshotCards(hand.GetCards()),
 			GameId:   gameId,
 		},
 	}
@@ -107,56 +127,115 @@ func NewGame(sockets []*Socket, turnDuration time.Duration) *Game {
 	}
 
 	game := &Game{
-		Id:          uuid.New(),
-		StopTimer:   make(chan bool),
-		Reconnected: make(chan *Socket),
+		Id: uuid.New(),
 
+		commands:     make(chan func()),
 		timer:        NewTimer(),
+		finished:     make(chan struct{}),
+		finish:       new(sync.Once),
 		turnDuration: turnDuration,
-		disconnected: -1,
+		reconnects:   make(map[int]*time.Timer),
 		current:      -1,
 		sockets:      sockets,
 		players:      players,
-		mutex:        new(sync.Mutex),
 		dispatcher:   dispatcher,
 	}
 
 	dispatcher.Subscribe(CardPlayedEvent, game.HandleAbilities)
 
+	// every player follows the game from their own point of view
+	seats := []*Player{}
+	for _, socket := range sockets {
+		seats = append(seats, players[socket])
+	}
+	playerIds := []uuid.UUID{}
+	for _, player := range seats {
+		player.state = NewStateTracker(game.Id, player, seats)
+		playerIds = append(playerIds, player.Id)
+	}
+
+	game.logger = DefaultLogger().With(Fields{"game_id": game.Id})
+	game.logger.With(Fields{"players": playerIds}).Info("game created")
+
+	go game.run()
+
 	return game
 }
 
-func (g *Game) ChooseStartingHand(duration time.Duration) {
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
+// Processes commands and timers until the game is over
+func (g *Game) run() {
+	// a broken command or timer ends its own game, not the whole server
+	defer func() {
+		if err := recover(); err != nil {
+			g.logger.With(Fields{"panic": err, "stack": string(debug.Stack())}).Error("game crashed")
+			g.abort()
+		}
+	}()
 
-	for _, player := range g.players {
-		// draw a starting hand for each player
-		player.DrawCards(INITIAL_HAND_LENGTH)
+	for {
+		select {
+		case command := <-g.commands:
+			command()
+		case <-g.timer.Done():
+			// mulligan or turn is over
+			g.logger.Debug("turn timed out")
+			g.startTurn()
+		}
 
-		// return starting hand responses to each player
-		go player.Send(StartingHandMessage(g.Id, duration, player.GetHand()))
+		select {
+		case <-g.finished:
+			g.timer.Stop()
+			return
+		default:
+		}
 	}
-
-	// start timer
-	go g.StartTimer(duration)
 }
 
-func (g *Game) StartTimer(duration time.Duration) {
-	g.timer.Start(duration)
+// Runs command on the game loop and waits for it to finish, returns false
+// without running it if the game is already over
+func (g *Game) do(command func()) bool {
+	done := make(chan struct{})
+	run := func() {
+		defer close(done)
+		command()
+	}
 
 	select {
-	case <-g.StopTimer:
-		g.timer.Stop()
-	case <-g.timer.Done():
-		// change game state to avoid discarding again?
-		g.StartTurn()
+	case g.commands <- run:
+		<-done
+		return true
+	case <-g.finished:
+		return false
 	}
 }
 
+func (g *Game) ChooseStartingHand(duration time.Duration) {
+	g.do(func() {
+		for _, socket := range g.sockets {
+			player := g.players[socket]
+
+			// draw a starting hand for each player
+			player.DrawCards(INITIAL_HAND_LENGTH)
+
+			// return starting hand responses to each player
+			player.Send(StartingHandMessage(g.Id, duration, player.GetHand()))
+		}
+
+		// turns start when everyone is ready or time runs out
+		g.timer.Start(duration)
+	})
+}
+
 func (g *Game) StartTurn() {
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
+	g.do(g.startTurn)
+}
+
+func (g *Game) startTurn() {
+	// starting hands are not a turn
+	if g.current != -1 && g.observeTurn != nil {
+		g.observeTurn(time.Since(g.turnStarted))
+	}
+	g.turnStarted = time.Now()
 
 	current := g.NextPlayer()
 
@@ -164,14 +243,15 @@ func (g *Game) StartTurn() {
 	current.RefillMana()
 
 	for _, minion := range current.Board.ActivateAll() {
-		go g.dispatcher.Dispatch(NewStateChangedEvent(minion))
+		g.dispatcher.Dispatch(NewStateChangedEvent(minion))
 	}
 
 	current.DrawCards(1)
 
-	go g.StartTimer(g.turnDuration)
+	g.timer.Start(g.turnDuration)
 
-	go g.dispatcher.Dispatch(NewTurnStartedEvent(current, g.turnDuration))
+	g.logger.With(current.Fields()).Debug("turn started")
+	g.dispatcher.Dispatch(NewTurnStartedEvent(current, g.turnDuration))
 }
 
 func (g *Game) NextPlayer() *Player {
@@ -193,86 +273,145 @@ func (g *Game) OtherPlayers(current *Socket) []*Player {
 }
 
 func (g *Game) HasPlayer(player *Socket) bool {
-	_, exists := g.players[player]
+	exists := false
+	g.do(func() {
+		_, exists = g.players[player]
+	})
 	return exists
 }
 
-func (g *Game) Discard(cardIds []uuid.UUID, socket *Socket) {
-	g.mutex.Lock()
+func (g *Game) Discard(cardIds []uuid.UUID, socket *Socket) error {
+	var err error
+	if !g.do(func() { err = g.discard(cardIds, socket) }) {
+		return g.over()
+	}
+	return err
+}
 
-	if player, ok := g.players[socket]; ok {
-		for _, cardId := range cardIds {
-			// remove card from player's hand
-			discarded := player.Discard(cardId)
+func (g *Game) discard(cardIds []uuid.UUID, socket *Socket) error {
+	player, ok := g.players[socket]
+	if !ok {
+		return NewProtocolError(NotInGame, "Player is not part of this game", g.Id)
+	}
 
-			// add a new card to hand
-			player.DrawCards(1)
+	if g.current != -1 || g.isReady(player) {
+		return NewProtocolError(AlreadyReady, "Starting hand already chosen")
+	}
 
-			// add card back to player's deck
-			player.AddToDeck(discarded)
+	// every discarded card must be in hand before touching anything
+	missing := []uuid.UUID{}
+	for _, cardId := range cardIds {
+		if player.Hand.Find(cardId) == nil {
+			missing = append(missing, cardId)
 		}
+	}
+	if len(missing) > 0 {
+		return NewProtocolError(CardNotFound, "Card not found in hand", missing...)
+	}
 
-		// mark player as ready
-		g.ready = append(g.ready, player)
+	for _, cardId := range cardIds {
+		// remove card from player's hand
+		discarded := player.Discard(cardId)
 
-		// return wait other players response
-		go player.Send(Response{
-			Type:    WaitOtherPlayers,
-			Payload: player.GetHand().GetCards(),
-		})
+		// add a new card to hand
+		player.DrawCards(1)
+
+		// add card back to player's deck
+		player.AddToDeck(discarded)
 	}
 
-	g.mutex.Unlock()
+	// mark player as ready
+	g.ready = append(g.ready, player)
+
+	// return wait other players response
+	player.Send(Response{
+		Type:    WaitOtherPlayers,
+		Payload: SnapshotCards(player.GetHand().GetCards()),
+	})
 
 	// if both players are ready, start turns
 	if len(g.ready) == len(g.players) {
-		g.StopTimer <- true
-		g.StartTurn()
+		g.startTurn()
 	}
+
+	return nil
 }
 
+// Checks if player already chose their starting hand
+func (g *Game) isReady(player *Player) bool {
+	for _, ready := range g.ready {
+		if ready == player {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if it's socket's turn to play
+func (g *Game) IsCurrent(socket *Socket) bool {
+	current := false
+	g.do(func() {
+		current = g.current != -1 && g.sockets[g.current] == socket
+	})
+	return current
+}
+
+// Ends whoever's turn it is
 func (g *Game) EndTurn() {
-	g.StopTimer <- true
-	g.StartTurn()
+	g.do(g.startTurn)
 }
 
-func (g *Game) PlayCard(cardId uuid.UUID, socket *Socket) {
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
+// Ends socket's turn, unless it's no longer theirs by the time the
+// command runs
+func (g *Game) EndTurnOf(socket *Socket) error {
+	var err error
+	ran := g.do(func() {
+		if _, err = g.currentPlayer(socket); err == nil {
+			g.startTurn()
+		}
+	})
+	if !ran {
+		return g.over()
+	}
+	return err
+}
 
-	if g.sockets[g.current] != socket {
-		return
+func (g *Game) PlayCard(cardId uuid.UUID, socket *Socket) error {
+	var err error
+	ran := g.do(func() {
+		var played ActiveCard
+		if played, err = g.playCard(cardId, socket); err == nil {
+			g.logger.With(g.players[socket].Fields()).With(Fields{"card_id": cardId}).Debug("card played")
+			g.dispatcher.Dispatch(NewCardPlayedEvent(played))
+		}
+	})
+	if !ran {
+		return g.over()
 	}
+	return err
+}
 
-	current := g.players[socket]
+func (g *Game) playCard(cardId uuid.UUID, socket *Socket) (ActiveCard, error) {
+	current, err := g.currentPlayer(socket)
+	if err != nil {
+		return nil, err
+	}
 
 	// check if card exists on player's hand
 	card := current.Hand.Find(cardId)
 	if card == nil {
-		go current.Send(Response{
-			Type:    Error,
-			Payload: "Card not found in hand",
-		})
-		return
+		return nil, NewProtocolError(CardNotFound, "Card not found in hand", cardId)
 	}
 
 	// check if player has enough mana to play card
 	if current.GetMana() < card.GetMana() {
-		go current.Send(Response{
-			Type:    Error,
-			Payload: "Not enough mana",
-		})
-		return
+		return nil, NewProtocolError(NotEnoughMana, "Not enough mana", cardId)
 	}
 
 	// play card
 	played, err := current.PlayCard(card)
 	if err != nil {
-		go current.Send(Response{
-			Type:    Error,
-			Payload: err.Error(),
-		})
-		return
+		return nil, err
 	}
 
 	// remove card from hand now
@@ -281,22 +420,20 @@ func (g *Game) PlayCard(cardId uuid.UUID, socket *Socket) {
 	// link card and player
 	played.SetPlayer(current)
 
-	// dispatch card played event
-	go g.dispatcher.Dispatch(NewCardPlayedEvent(played))
+	return played, nil
 }
 
+// Casts the ability of a played card, or waits for its trigger. Runs as a
+// listener, so events it causes are queued after the current one
 func (g *Game) HandleAbilities(event GameEvent) bool {
 	if card, ok := event.GetData().(ActiveCard); ok {
-		g.mutex.Lock()
-		defer g.mutex.Unlock()
-
 		if card.HasAbility() {
 			ability := card.GetAbility()
 			if ability.trigger != nil {
-				go g.dispatcher.Subscribe(ability.trigger.event, func(event GameEvent) bool {
+				g.dispatcher.Subscribe(ability.trigger.event, func(event GameEvent) bool {
 					if ability.trigger.condition == nil || ability.trigger.condition(card, event) {
 						if event := card.CastAbility(); event != nil {
-							go g.dispatcher.Dispatch(event)
+							g.dispatcher.Dispatch(event)
 						}
 					}
 
@@ -306,7 +443,7 @@ func (g *Game) HandleAbilities(event GameEvent) bool {
 				})
 			} else {
 				if event := card.CastAbility(); event != nil {
-					go g.dispatcher.Dispatch(event)
+					g.dispatcher.Dispatch(event)
 				}
 			}
 		}
@@ -314,73 +451,96 @@ func (g *Game) HandleAbilities(event GameEvent) bool {
 	return false
 }
 
-func (g *Game) Attack(attackerId, defenderId uuid.UUID, socket *Socket) {
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
+func (g *Game) Attack(attackerId, defenderId uuid.UUID, socket *Socket) error {
+	var err error
+	if !g.do(func() { err = g.attack(attackerId, defenderId, socket) }) {
+		return g.over()
+	}
+	return err
+}
 
-	current := g.players[socket]
+func (g *Game) attack(attackerId, defenderId uuid.UUID, socket *Socket) error {
+	current, err := g.currentPlayer(socket)
+	if err != nil {
+		return err
+	}
 
 	// check if attacker exists in attacking player's board
-	if attacker, ok := current.Board.GetMinion(attackerId); ok {
-		if attacker.CanAttack() {
-			// check if defender exists in defending player's board
-			if defender, player := g.FindMinion(defenderId); defender != nil {
-				// deal damage to defender
-				survived := defender.RemoveHealth(attacker.GetDamage())
-
-				// send damage taken message to players
-				g.dispatcher.Dispatch(NewDamageEvent(attacker, defender))
-
-				if survived {
-					// if it survives, counter-attack
-					if defender.CanCounterAttack() {
-						attackerSurvived := attacker.RemoveHealth(defender.GetDamage())
-
-						// send damage taken message to players
-						g.dispatcher.Dispatch(NewDamageEvent(defender, attacker))
-
-						if !attackerSurvived {
-							// remove from its board
-							current.Board.Remove(attacker)
-
-							// send minion destroyed message to players
-							g.dispatcher.Dispatch(NewDestroyedEvent(attacker))
-						} else {
-							// after attacking, minion gets exhausted
-							attacker.SetState(Exhausted{})
-
-							g.dispatcher.Dispatch(NewStateChangedEvent(attacker))
-						}
-					}
-				} else {
-					// remove from its board
-					player.Board.Remove(defender)
+	attacker, ok := current.Board.GetMinion(attackerId)
+	if !ok {
+		return NewProtocolError(MinionNotFound, "Minion not found on board", attackerId)
+	}
+	if !attacker.CanAttack() {
+		return NewProtocolError(MinionExhausted, "Minion cannot attack this turn", attackerId)
+	}
 
-					// send minion destroyed message to players
-					g.dispatcher.Dispatch(NewDestroyedEvent(defender))
+	// check if defender exists in defending player's board
+	defender, player := g.FindMinion(defenderId)
+	if defender == nil {
+		return NewProtocolError(TargetNotFound, "Target not found on opponent's board", defenderId)
+	}
 
-					// after attacking, minion gets exhausted
-					attacker.SetState(Exhausted{})
+	// deal damage to defender
+	survived := defender.RemoveHealth(attacker.GetDamage())
 
-					g.dispatcher.Dispatch(NewStateChangedEvent(attacker))
-				}
+	// send damage taken message to players
+	g.dispatcher.Dispatch(NewDamageEvent(attacker, defender))
+
+	if survived {
+		// if it survives, counter-attack
+		if defender.CanCounterAttack() {
+			attackerSurvived := attacker.RemoveHealth(defender.GetDamage())
+
+			// send damage taken message to players
+			g.dispatcher.Dispatch(NewDamageEvent(defender, attacker))
+
+			if !attackerSurvived {
+				// remove from its board
+				current.Board.Remove(attacker)
+
+				// send minion destroyed message to players
+				g.dispatcher.Dispatch(NewDestroyedEvent(attacker))
+			} else {
+				// after attacking, minion gets exhausted
+				attacker.SetState(Exhausted{})
+
+				g.dispatcher.Dispatch(NewStateChangedEvent(attacker))
 			}
 		}
+	} else {
+		// remove from its board
+		player.Board.Remove(defender)
+
+		// send minion destroyed message to players
+		g.dispatcher.Dispatch(NewDestroyedEvent(defender))
+
+		// after attacking, minion gets exhausted
+		attacker.SetState(Exhausted{})
+
+		g.dispatcher.Dispatch(NewStateChangedEvent(attacker))
 	}
+
+	return nil
 }
 
-func (g *Game) AttackPlayer(attackerId, playerId uuid.UUID, socket *Socket) bool {
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
+// Attacks a player directly and returns whether the game is over
+func (g *Game) AttackPlayer(attackerId, playerId uuid.UUID, socket *Socket) (bool, error) {
+	var over bool
+	var err error
+	if !g.do(func() { over, err = g.attackPlayer(attackerId, playerId, socket) }) {
+		return false, g.over()
+	}
+	return over, err
+}
 
+func (g *Game) attackPlayer(attackerId, playerId uuid.UUID, socket *Socket) (bool, error) {
 	// validate player
-	current := g.players[socket]
+	current, err := g.currentPlayer(socket)
+	if err != nil {
+		return false, err
+	}
 	if current.Id == playerId {
-		go current.Send(Response{
-			Type:    Error,
-			Payload: "You cannot attack yourself...",
-		})
-		return false
+		return false, NewProtocolError(CannotAttackSelf, "You cannot attack yourself...", playerId)
 	}
 
 	// get player
@@ -392,127 +552,364 @@ func (g *Game) AttackPlayer(attackerId, playerId uuid.UUID, socket *Socket) bool
 		}
 	}
 	if player == nil {
-		go current.Send(Response{
-			Type:    Error,
-			Payload: "Player not found",
-		})
-		return false
+		return false, NewProtocolError(PlayerNotFound, "Player not found", playerId)
 	}
 
 	// check if player has minions on board
-	if player.Board.MinionsCount() == 0 {
-		// get minion
-		attacker, ok := current.Board.GetMinion(attackerId)
-		if !ok {
-			go current.Send(Response{
-				Type:    Error,
-				Payload: "Minion not found on board",
-			})
-			return false
-		}
+	if player.Board.MinionsCount() != 0 {
+		return false, NewProtocolError(
+			DefenderHasMinions,
+			"Cannot attack a player with minions on board",
+			playerId,
+		)
+	}
 
-		if attacker.CanAttack() {
-			// reduce player's health
-			player.ReduceHealth(attacker.GetDamage())
+	// get minion
+	attacker, ok := current.Board.GetMinion(attackerId)
+	if !ok {
+		return false, NewProtocolError(MinionNotFound, "Minion not found on board", attackerId)
+	}
+	if !attacker.CanAttack() {
+		return false, NewProtocolError(MinionExhausted, "Minion cannot attack this turn", attackerId)
+	}
 
-			// send player damage event
-			g.dispatcher.Dispatch(NewPlayerDamagedEvent(player, attacker))
+	// reduce player's health
+	player.ReduceHealth(attacker.GetDamage())
 
-			// after attacking, minion gets exhausted
-			attacker.SetState(Exhausted{})
+	// send player damage event
+	g.dispatcher.Dispatch(NewPlayerDamagedEvent(player, attacker))
 
-			g.dispatcher.Dispatch(NewStateChangedEvent(attacker))
+	// after attacking, minion gets exhausted
+	attacker.SetState(Exhausted{})
 
-			// check if dead
-			if player.GetHealth() <= 0 {
-				g.GameOver(current, player)
-				return true
-			}
-		}
+	g.dispatcher.Dispatch(NewStateChangedEvent(attacker))
+
+	// check if dead
+	if player.GetHealth() <= 0 {
+		g.GameOver(current, player)
+		return true, nil
 	}
 
-	return false
+	return false, nil
 }
 
+// Ends the game, the loop stops once the current command is done
 func (g *Game) GameOver(winner, loser *Player) {
-	g.StopTimer <- true
+	fields := Fields{"winner": winner.Id}
+	if loser != nil {
+		fields["loser"] = loser.Id
+	}
+	g.logger.With(fields).Info("game over")
+
+	g.timer.Stop()
+	g.stopReconnects()
+	g.finish.Do(func() {
+		close(g.finished)
+
+		if g.observeEnd != nil {
+			losers := []*Player{}
+			for _, socket := range g.sockets {
+				if player := g.players[socket]; player != winner {
+					losers = append(losers, player)
+				}
+			}
+			g.observeEnd(winner, losers)
+		}
+	})
 
 	// winner gets win message
-	go winner.Send(Response{
+	winner.Send(Response{
 		Type: Win,
 	})
 
 	// loser gets loss message
 	if loser != nil {
-		go loser.Send(Response{
+		loser.Send(Response{
 			Type: Loss,
 		})
 	}
 }
 
-func (g *Game) Disconnect(player *Socket, duration time.Duration) {
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
+// Ends the game without a result, players are told it can't go on
+func (g *Game) abort() {
+	g.timer.Stop()
+	g.stopReconnects()
+	g.finish.Do(func() {
+		close(g.finished)
+	})
 
-	for idx, socket := range g.sockets {
-		if socket == player {
-			g.disconnected = idx
-			break
+	for _, player := range g.players {
+		player.Send(ErrorMessage(NewProtocolError(Internal, "Game ended unexpectedly", g.Id)))
+	}
+}
+
+// Ends the game right away with the given player as the winner, everyone
+// else loses
+func (g *Game) End(winnerId uuid.UUID) error {
+	var err error
+	ran := g.do(func() {
+		var winner *Player
+		for _, player := range g.players {
+			if player.Id == winnerId {
+				winner = player
+			}
+		}
+		if winner == nil {
+			err = NewProtocolError(PlayerNotFound, "Player not found", winnerId)
+			return
+		}
+
+		g.GameOver(winner, nil)
+		for _, player := range g.players {
+			if player != winner {
+				player.Send(Response{Type: Loss})
+			}
 		}
+	})
+	if !ran {
+		return g.over()
 	}
+	return err
+}
 
-	// start a 30s timer
-	timer := time.NewTimer(duration)
+// Closed once the game has a winner
+func (g *Game) Done() <-chan struct{} {
+	return g.finished
+}
 
-	go func() {
-		select {
-		case <-g.Reconnected:
-			if !timer.Stop() {
-				<-timer.C
+// Error for commands arriving after the game ended
+func (g *Game) over() error {
+	return NewProtocolError(GameNotFound, "Game is over", g.Id)
+}
+
+func (g *Game) Disconnect(player *Socket, duration time.Duration) {
+	g.do(func() {
+		seat, ok := g.players[player]
+		if !ok {
+			return
+		}
+		g.logger.With(seat.Fields()).With(Fields{"timeout": duration}).Warn("player disconnected")
+
+		for idx, socket := range g.sockets {
+			if socket == player {
+				g.awaitReconnect(idx, duration)
+				break
 			}
-		case <-timer.C:
-			var winner *Player
-			loser := g.players[player]
-			for _, player := range g.players {
-				if player != loser {
-					winner = player
-				}
+		}
+	})
+}
+
+// Gives the player of seat duration to come back before losing the game.
+// Must be called from the game loop
+func (g *Game) awaitReconnect(seat int, duration time.Duration) {
+	if previous, ok := g.reconnects[seat]; ok {
+		previous.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(duration, func() {
+		g.do(func() {
+			// a stopped timer may have fired already
+			if g.reconnects[seat] == timer {
+				g.walkover(seat)
 			}
-			g.GameOver(winner, nil)
+		})
+	})
+	g.reconnects[seat] = timer
+}
+
+// Must be called from the game loop
+func (g *Game) stopReconnects() {
+	for idx, timer := range g.reconnects {
+		timer.Stop()
+		delete(g.reconnects, idx)
+	}
+}
+
+// The player of the seat took too long to come back, others win
+func (g *Game) walkover(seat int) {
+	delete(g.reconnects, seat)
+
+	var winner *Player
+	loser := g.players[g.sockets[seat]]
+	g.logger.With(loser.Fields()).Info("player did not come back")
+	for _, player := range g.players {
+		if player != loser {
+			winner = player
 		}
-	}()
+	}
+	g.GameOver(winner, nil)
+}
+
+func (g *Game) Reconnect(socket *Socket) error {
+	var err error
+	if !g.do(func() { err = g.reconnectPlayer(socket) }) {
+		return g.over()
+	}
+	return err
+}
+
+// Reconnects socket and replays the messages sent after lastSeq, or the
+// whole game if they are no longer kept
+func (g *Game) Resume(socket *Socket, lastSeq uint64) error {
+	var err error
+	if !g.do(func() { err = g.resume(socket, lastSeq) }) {
+		return g.over()
+	}
+	return err
+}
+
+func (g *Game) reconnectPlayer(socket *Socket) error {
+	player, err := g.takeSeat(socket)
+	if err != nil {
+		return err
+	}
+
+	g.sendGame(player)
+	return nil
 }
 
-func (g *Game) Reconnect(socket *Socket) {
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
+func (g *Game) resume(socket *Socket, lastSeq uint64) error {
+	player, err := g.takeSeat(socket)
+	if err != nil {
+		return err
+	}
+
+	missed, ok := player.journal.Since(lastSeq)
+	g.logger.With(player.Fields()).With(Fields{"last_seq": lastSeq, "replayed": ok}).Info("player resumed")
+	socket.Send(Response{
+		Type: Resumed,
+		Payload: ResumedPayload{
+			GameId:   g.Id,
+			LastSeq:  player.journal.Seq(),
+			Replayed: ok,
+		},
+	})
+
+	if !ok {
+		g.sendGame(player)
+		return nil
+	}
+
+	// replayed messages keep their numbers, they were already recorded
+	for _, message := range missed {
+		socket.Send(message)
+	}
+	return nil
+}
+
+// Gives the disconnected seat back to its player on a new socket
+func (g *Game) takeSeat(socket *Socket) (*Player, error) {
+	if len(g.reconnects) == 0 {
+		return nil, NewProtocolError(NoPlayerToReconnect, "No player to reconnect", g.Id)
+	}
+
+	// only the original player can resume their seat
+	seat := -1
+	for idx := range g.reconnects {
+		if g.players[g.sockets[idx]].OwnedBy(socket) {
+			seat = idx
+		}
+	}
+	if seat == -1 {
+		return nil, NewProtocolError(SessionMismatch, "Session does not belong to disconnected player", g.Id)
+	}
 
 	// stop timer
-	g.Reconnected <- socket
+	g.reconnects[seat].Stop()
+	delete(g.reconnects, seat)
 
 	// grab reference to disconnected socket
-	disconnected := g.sockets[g.disconnected]
-	g.sockets[g.disconnected] = socket
+	disconnected := g.sockets[seat]
+	g.sockets[seat] = socket
 
 	// replace disconnect player with new player
 	player := g.players[disconnected]
 	player.socket = socket
 	g.players[socket] = player
 
+	delete(g.players, disconnected)
+
+	g.logger.With(player.Fields()).Info("player reconnected")
+
+	return player, nil
+}
+
+// Sends a player everything needed to pick the game up again
+func (g *Game) sendGame(player *Player) {
+	socket := player.socket
+
 	// send the new player game data
 	socket.Send(Response{
 		Type: "reconnected",
 		Payload: map[string]interface{}{
-			"Player":   g.players[socket],
-			"Opponent": g.OtherPlayers(socket)[0],
+			"Player":   player.Copy(),
+			"Opponent": g.OtherPlayers(socket)[0].Copy(),
 		},
 	})
 
-	current := g.players[g.sockets[g.current]]
-	player.NotifyTurnStarted(NewTurnStartedEvent(current, g.timer.Left()))
+	// a new connection knows nothing of the game, diffs restart from here
+	if socket.Supports(StateDiffs) {
+		player.ResyncState()
+	}
 
-	delete(g.players, disconnected)
-	g.disconnected = -1
+	// nobody is playing while starting hands are chosen
+	if g.current != -1 {
+		current := g.players[g.sockets[g.current]]
+		player.NotifyTurnStarted(NewTurnStartedEvent(current, g.timer.Left()))
+	}
+}
+
+// Sets a function called once with the result when the game ends
+func (g *Game) SetResultObserver(observe func(winner *Player, losers []*Player)) {
+	g.do(func() {
+		g.observeEnd = observe
+	})
+}
+
+// Sets a function called with how long each turn lasted
+func (g *Game) SetTurnObserver(observe func(elapsed time.Duration)) {
+	g.do(func() {
+		g.observeTurn = observe
+	})
+}
+
+// Changes how many messages are kept per player for replaying
+func (g *Game) SetReplayBuffer(size int) {
+	g.do(func() {
+		for _, player := range g.players {
+			player.journal.Resize(size)
+		}
+	})
+}
+
+// Sends the whole game state to a player who lost track of it
+func (g *Game) SendState(socket *Socket) error {
+	var err error
+	ran := g.do(func() {
+		player, ok := g.players[socket]
+		if !ok {
+			err = NewProtocolError(NotInGame, "Player is not part of this game", g.Id)
+			return
+		}
+		player.ResyncState()
+	})
+	if !ran {
+		return g.over()
+	}
+	return err
+}
+
+// Returns socket's player if it's their turn
+func (g *Game) currentPlayer(socket *Socket) (*Player, error) {
+	player, ok := g.players[socket]
+	if !ok {
+		return nil, NewProtocolError(NotInGame, "Player is not part of this game", g.Id)
+	}
+	if g.current == -1 || g.sockets[g.current] != socket {
+		return nil, NewProtocolError(NotYourTurn, "It's not your turn")
+	}
+	return player, nil
 }
 
 // Searches for a minion on all players board, except current player
@@ -527,15 +924,19 @@ func (g *Game) FindMinion(minionId uuid.UUID) (*ActiveMinion, *Player) {
 }
 
 func (g *Game) GetPlayers() map[*Socket]*Player {
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
-
-	return g.players
+	players := make(map[*Socket]*Player)
+	g.do(func() {
+		for socket, player := range g.players {
+			players[socket] = player
+		}
+	})
+	return players
 }
 
 func (g *Game) GetSockets() []*Socket {
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
-
-	return g.sockets
+	var sockets []*Socket
+	g.do(func() {
+		sockets = append(sockets, g.sockets...)
+	})
+	return sockets
 }
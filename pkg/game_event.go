@@ -29,9 +29,14 @@ type Dispatcher interface {
 	Subscribe(event GameEventType, listener Listener)
 }
 
+// GameDispatcher delivers events to listeners one at a time: events
+// dispatched by a listener are queued until the current one reached all of
+// its listeners, and listeners subscribed meanwhile only get later events
 type GameDispatcher struct {
-	mutex     *sync.Mutex
-	listeners map[GameEventType]*list.List
+	mutex       *sync.Mutex
+	listeners   map[GameEventType]*list.List
+	queue       []GameEvent
+	dispatching bool
 }
 
 func NewGameDispatcher() *GameDispatcher {
@@ -53,18 +58,58 @@ func (d *GameDispatcher) Subscribe(event GameEventType, listener Listener) {
 
 func (d *GameDispatcher) Dispatch(event GameEvent) {
 	d.mutex.Lock()
-	defer d.mutex.Unlock()
+	d.queue = append(d.queue, event)
+	if d.dispatching {
+		d.mutex.Unlock()
+		return
+	}
+	d.dispatching = true
+	d.mutex.Unlock()
 
-	if listeners := d.listeners[event.GetType()]; listeners != nil {
-		for cur := listeners.Front(); cur != nil; cur = cur.Next() {
+	for {
+		event, listeners, ok := d.next()
+		if !ok {
+			return
+		}
+
+		for _, cur := range listeners {
 			listener := cur.Value.(Listener)
 			if listener(event) {
-				listeners.Remove(cur)
+				d.remove(event.GetType(), cur)
 			}
 		}
 	}
 }
 
+// Pops the next queued event along with its current listeners
+func (d *GameDispatcher) next() (GameEvent, []*list.Element, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if len(d.queue) == 0 {
+		d.dispatching = false
+		return nil, nil, false
+	}
+
+	event := d.queue[0]
+	d.queue = d.queue[1:]
+
+	listeners := []*list.Element{}
+	if subscribed := d.listeners[event.GetType()]; subscribed != nil {
+		for cur := subscribed.Front(); cur != nil; cur = cur.Next() {
+			listeners = append(listeners, cur)
+		}
+	}
+	return event, listeners, true
+}
+
+func (d *GameDispatcher) remove(event GameEventType, listener *list.Element) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.listeners[event].Remove(listener)
+}
+
 type GameEvent interface {
 	GetData() interface{}
 	GetType() GameEventType
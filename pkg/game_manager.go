@@ -1,116 +1,413 @@
 package pkg
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/mitchellh/mapstructure"
 )
 
 type GameManager struct {
+	mutex      *sync.Mutex
 	games      map[uuid.UUID]*Game
 	disconnect time.Duration
+	mulligan   time.Duration
+	turn       time.Duration
+	replay     int
+	snapshots  io.Writer
+	turns      *Histogram
+	ratings    RatingStore
+	cluster    *Cluster
+	draining   bool
 }
 
 func NewGameManager(duration time.Duration) *GameManager {
+	config := DefaultConfig()
+	config.DisconnectTimeout = duration
+
+	return NewGameManagerWithConfig(config)
+}
+
+func NewGameManagerWithConfig(config Config) *GameManager {
 	return &GameManager{
-		disconnect: duration,
+		mutex:      new(sync.Mutex),
+		disconnect: config.DisconnectTimeout,
+		mulligan:   config.MulliganDuration,
+		turn:       config.TurnDuration,
+		replay:     config.ReplayBuffer,
 		games:      make(map[uuid.UUID]*Game),
+		turns:      NewHistogram("", TURN_BUCKETS),
+		ratings:    DefaultRatings(),
+	}
+}
+
+func (g *GameManager) RegisterMetrics(metrics *Metrics) {
+	metrics.Register("card_server_active_games", "Games still being played", GaugeFunc(func() float64 {
+		return float64(g.ActiveGameCount())
+	}))
+	metrics.Register("card_server_turn_duration_seconds", "How long turns last", g.turns)
+}
+
+// Claims games created here so players elsewhere get routed to them
+func (g *GameManager) SetCluster(cluster *Cluster) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.cluster = cluster
+	g.ratings = cluster.Store()
+}
+
+// Sets where ratings are updated when games end, the queue manager should
+// read them from there
+func (g *GameManager) SetRatings(ratings RatingStore) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.ratings = ratings
+}
+
+func (g *GameManager) recordResult(game *Game, winner *Player, losers []*Player) {
+	g.mutex.Lock()
+	ratings := g.ratings
+	g.mutex.Unlock()
+
+	sessions := []uuid.UUID{}
+	for _, loser := range losers {
+		sessions = append(sessions, loser.session)
+	}
+
+	logger := DefaultLogger().With(Fields{"game_id": game.Id})
+
+	updated, err := RecordResult(ratings, winner.session, sessions)
+	if err != nil {
+		logger.With(Fields{"error": err}).Error("could not update ratings")
+		return
+	}
+	logger.With(Fields{"ratings": updated}).Debug("ratings updated")
+}
+
+// Sets where unfinished games are persisted when draining
+func (g *GameManager) SetSnapshotWriter(writer io.Writer) {
+	g.snapshots = writer
+}
+
+// Waits for running games to finish, games still running when ctx is done
+// are persisted to the snapshot writer instead
+func (g *GameManager) Drain(ctx context.Context) error {
+	g.mutex.Lock()
+	g.draining = true
+	g.mutex.Unlock()
+
+	for _, game := range g.Games() {
+		select {
+		case <-game.Done():
+		case <-ctx.Done():
+			return g.persist()
+		}
+	}
+	return nil
+}
+
+func (g *GameManager) Draining() bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return g.draining
+}
+
+func (g *GameManager) persist() error {
+	snapshots := []GameSnapshot{}
+	for _, game := range g.Games() {
+		select {
+		case <-game.Done():
+		default:
+			snapshots = append(snapshots, game.Snapshot())
+		}
+	}
+
+	if g.snapshots == nil || len(snapshots) == 0 {
+		return nil
+	}
+	return json.NewEncoder(g.snapshots).Encode(snapshots)
+}
+
+func (g *GameManager) Handles() []EventType {
+	return []EventType{
+		CreateGame,
+		CardDiscarded,
+		EndTurn,
+		PlayCard,
+		Attack,
+		AttackPlayer,
+		Disconnected,
+		Reconnected,
+		RequestState,
+		Resume,
 	}
 }
 
 func (g *GameManager) Process(event Event) *Event {
+	var err error
+
 	switch event.Type {
 	case CreateGame:
 		players := event.Payload.([]*Socket)
-		game := g.CreateGame(players)
-		game.ChooseStartingHand(30 * time.Second)
-	case CardDiscarded:
-		var payload CardDiscardedPayload
-
-		if err := mapstructure.Decode(event.Payload, &payload); err == nil {
-			if gameId, err := uuid.Parse(payload.GameId); err == nil {
-				cards := []uuid.UUID{}
-				for _, cardId := range payload.Cards {
-					if uuid, err := uuid.Parse(cardId); err == nil {
-						cards = append(cards, uuid)
-					}
-				}
-				if game, ok := g.games[gameId]; ok {
-					game.Discard(cards, event.Player)
-				}
+
+		// games started now would be neither waited for nor persisted
+		if g.Draining() {
+			for _, player := range players {
+				player.Send(ErrorMessage(NewProtocolError(ServerShuttingDown, "Server is shutting down")))
 			}
+			return nil
 		}
+
+		game := g.CreateGame(players)
+		game.ChooseStartingHand(g.mulligan)
+	case CardDiscarded:
+		err = g.discard(event)
 	case EndTurn:
-		if gameId, err := uuid.Parse(event.Payload.(string)); err == nil {
-			if game, ok := g.games[gameId]; ok {
-				game.EndTurn()
-			}
-		}
+		err = g.endTurn(event)
 	case PlayCard:
-		var payload PlayCardPayload
-		if err := mapstructure.Decode(event.Payload, &payload); err == nil {
-			if gameId, err := uuid.Parse(payload.GameId); err == nil {
-				if game, ok := g.games[gameId]; ok {
-					if cardId, err := uuid.Parse(payload.CardId); err == nil {
-						game.PlayCard(cardId, event.Player)
-					}
-				}
-			}
-		}
+		err = g.playCard(event)
 	case Attack:
-		var payload CombatPayload
-		if err := mapstructure.Decode(event.Payload, &payload); err == nil {
-			if gameId, err := uuid.Parse(payload.GameId); err == nil {
-				if attacker, err := uuid.Parse(payload.Attacker); err == nil {
-					if defender, err := uuid.Parse(payload.Defender); err == nil {
-						if game, ok := g.games[gameId]; ok {
-							game.Attack(attacker, defender, event.Player)
-						}
-					}
-				}
-			}
-		}
+		err = g.attack(event)
 	case AttackPlayer:
-		var payload CombatPayload
-		if err := mapstructure.Decode(event.Payload, &payload); err == nil {
-			if gameId, err := uuid.Parse(payload.GameId); err == nil {
-				if attacker, err := uuid.Parse(payload.Attacker); err == nil {
-					if defender, err := uuid.Parse(payload.Defender); err == nil {
-						if game, ok := g.games[gameId]; ok {
-							if game.AttackPlayer(attacker, defender, event.Player) {
-								delete(g.games, gameId)
-							}
-						}
-					}
-				}
-			}
-		}
+		err = g.attackPlayer(event)
 	case Disconnected:
 		// check if disconnected player is playing
 		if game := g.FindPlayerGame(event.Player); game != nil {
 			game.Disconnect(event.Player, g.disconnect)
 		}
 	case Reconnected:
-		// find game
-		if gameId, err := uuid.Parse(event.Payload.(string)); err == nil {
-			if game, ok := g.games[gameId]; ok {
-				game.Reconnect(event.Player)
-			}
-		}
+		err = g.reconnect(event)
+	case RequestState:
+		err = g.requestState(event)
+	case Resume:
+		err = g.resume(event)
+	}
+
+	if err != nil {
+		DefaultLogger().With(event.Fields()).With(Fields{"code": ErrorCodeOf(err), "error": err}).Debug("event rejected")
+		event.Reply(ErrorMessage(err))
 	}
 	return nil
 }
 
+func (g *GameManager) discard(event Event) error {
+	payload, ok := event.Payload.(CardDiscardedPayload)
+	if !ok {
+		return UndecodedPayload(event)
+	}
+
+	game, err := g.findGame(payload.GameId)
+	if err != nil {
+		return err
+	}
+
+	cards := []uuid.UUID{}
+	for _, cardId := range payload.Cards {
+		card, err := parseId(cardId, "card id")
+		if err != nil {
+			return err
+		}
+		cards = append(cards, card)
+	}
+
+	return game.Discard(cards, event.Player)
+}
+
+func (g *GameManager) endTurn(event Event) error {
+	payload, ok := event.Payload.(IdPayload)
+	if !ok {
+		return UndecodedPayload(event)
+	}
+
+	game, err := g.findGame(string(payload))
+	if err != nil {
+		return err
+	}
+
+	return game.EndTurnOf(event.Player)
+}
+
+func (g *GameManager) playCard(event Event) error {
+	payload, ok := event.Payload.(PlayCardPayload)
+	if !ok {
+		return UndecodedPayload(event)
+	}
+
+	game, err := g.findGame(payload.GameId)
+	if err != nil {
+		return err
+	}
+
+	cardId, err := parseId(payload.CardId, "card id")
+	if err != nil {
+		return err
+	}
+
+	return game.PlayCard(cardId, event.Player)
+}
+
+func (g *GameManager) attack(event Event) error {
+	payload, ok := event.Payload.(CombatPayload)
+	if !ok {
+		return UndecodedPayload(event)
+	}
+
+	game, err := g.findGame(payload.GameId)
+	if err != nil {
+		return err
+	}
+
+	attacker, err := parseId(payload.Attacker, "attacker id")
+	if err != nil {
+		return err
+	}
+
+	defender, err := parseId(payload.Defender, "defender id")
+	if err != nil {
+		return err
+	}
+
+	return game.Attack(attacker, defender, event.Player)
+}
+
+func (g *GameManager) attackPlayer(event Event) error {
+	payload, ok := event.Payload.(CombatPayload)
+	if !ok {
+		return UndecodedPayload(event)
+	}
+
+	game, err := g.findGame(payload.GameId)
+	if err != nil {
+		return err
+	}
+
+	attacker, err := parseId(payload.Attacker, "attacker id")
+	if err != nil {
+		return err
+	}
+
+	defender, err := parseId(payload.Defender, "defender id")
+	if err != nil {
+		return err
+	}
+
+	// forgotten right away, not only once the game loop stopped
+	over, err := game.AttackPlayer(attacker, defender, event.Player)
+	if over {
+		g.forget(game)
+	}
+	return err
+}
+
+func (g *GameManager) reconnect(event Event) error {
+	payload, ok := event.Payload.(IdPayload)
+	if !ok {
+		return UndecodedPayload(event)
+	}
+
+	game, err := g.findGame(string(payload))
+	if err != nil {
+		return err
+	}
+	return game.Reconnect(event.Player)
+}
+
+func (g *GameManager) resume(event Event) error {
+	payload, ok := event.Payload.(ResumePayload)
+	if !ok {
+		return UndecodedPayload(event)
+	}
+
+	game, err := g.findGame(payload.GameId)
+	if err != nil {
+		return err
+	}
+	return game.Resume(event.Player, payload.LastSeq)
+}
+
+func (g *GameManager) requestState(event Event) error {
+	payload, ok := event.Payload.(IdPayload)
+	if !ok {
+		return UndecodedPayload(event)
+	}
+
+	game, err := g.findGame(string(payload))
+	if err != nil {
+		return err
+	}
+	return game.SendState(event.Player)
+}
+
+func (g *GameManager) findGame(id string) (*Game, error) {
+	gameId, err := parseId(id, "game id")
+	if err != nil {
+		return nil, err
+	}
+
+	g.mutex.Lock()
+	game, ok := g.games[gameId]
+	g.mutex.Unlock()
+
+	if !ok {
+		return nil, NewProtocolError(GameNotFound, "Game not found", gameId)
+	}
+	return game, nil
+}
+
+func parseId(id string, name string) (uuid.UUID, error) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, NewProtocolError(InvalidPayload, fmt.Sprintf("Invalid %v: %q", name, id))
+	}
+	return parsed, nil
+}
+
 func (g *GameManager) CreateGame(players []*Socket) *Game {
-	game := NewGame(players, 75*time.Second)
+	game := NewGame(players, g.turn)
+	game.SetReplayBuffer(g.replay)
+	game.SetTurnObserver(func(elapsed time.Duration) {
+		g.turns.ObserveDuration("", elapsed)
+	})
+	game.SetResultObserver(func(winner *Player, losers []*Player) {
+		g.recordResult(game, winner, losers)
+	})
+
+	g.mutex.Lock()
 	g.games[game.Id] = game
+	cluster := g.cluster
+	g.mutex.Unlock()
 
+	if cluster != nil {
+		cluster.Claim(game.Id)
+	}
+
+	// however it ends, a finished game is no longer listed or routed to
+	go func() {
+		<-game.Done()
+		g.forget(game)
+		if cluster != nil {
+			cluster.Release(game.Id)
+		}
+	}()
 	return game
 }
 
+func (g *GameManager) forget(game *Game) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	delete(g.games, game.Id)
+}
+
 func (g *GameManager) FindPlayerGame(player *Socket) *Game {
-	for _, game := range g.games {
+	for _, game := range g.Games() {
 		if game.HasPlayer(player) {
 			return game
 		}
@@ -118,6 +415,33 @@ func (g *GameManager) FindPlayerGame(player *Socket) *Game {
 	return nil
 }
 
+func (g *GameManager) Games() []*Game {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	games := []*Game{}
+	for _, game := range g.games {
+		games = append(games, game)
+	}
+	return games
+}
+
 func (g *GameManager) GameCount() int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
 	return len(g.games)
 }
+
+// Games without a winner yet
+func (g *GameManager) ActiveGameCount() int {
+	active := 0
+	for _, game := range g.Games() {
+		select {
+		case <-game.Done():
+		default:
+			active++
+		}
+	}
+	return active
+}
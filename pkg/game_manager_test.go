@@ -1,6 +1,9 @@
 package pkg
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -197,6 +200,9 @@ func TestGameManager(t *testing.T) {
 		game := NewGame([]*Socket{p1, p2}, 100*time.Millisecond)
 		game.StartTurn()
 
+		// stop the timer from playing on once the test is over
+		defer game.End(game.GetPlayers()[p1].Id)
+
 		<-p1.Outgoing // start turn
 		<-p2.Outgoing // wait turn
 
@@ -315,8 +321,8 @@ func TestGameManager(t *testing.T) {
 		response := <-p1.Outgoing
 		payload := response.Payload.(TurnPayload)
 
-		// spend some mana
-		payload.Cards[0].(*Minion).Mana = 1
+		// spend some mana, messages carry copies of the cards in hand
+		game.players[p1].Hand.Find(payload.Cards[0].GetId()).(*Minion).Mana = 1
 		game.PlayCard(payload.Cards[0].GetId(), p1)
 
 		// end turn
@@ -367,6 +373,9 @@ func TestGameManager(t *testing.T) {
 		p2 := NewTestSocket()
 		p3 := NewTestSocket()
 
+		// same player on a new connection
+		p3.Session = p2.Session
+
 		manager := NewGameManager(500 * time.Millisecond)
 
 		// create a game
@@ -386,7 +395,7 @@ func TestGameManager(t *testing.T) {
 		go manager.Process(Event{
 			Type:    Reconnected,
 			Player:  p3,
-			Payload: game.Id.String(),
+			Payload: IdPayload(game.Id.String()),
 		})
 
 		// wait timer
@@ -415,6 +424,8 @@ func TestGameManager(t *testing.T) {
 				t.Error("socket should have been removed")
 			}
 		}
+
+		players = game.GetPlayers()
 		if len(players) != 2 {
 			t.Errorf("Expected %v players, got %v", 2, len(game.sockets))
 		}
@@ -425,4 +436,175 @@ func TestGameManager(t *testing.T) {
 			t.Errorf("Expected same player %v, got %v", disconnected, players[p3])
 		}
 	})
+	t.Run("reconnect with another session", func(t *testing.T) {
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+		intruder := NewTestSocket()
+
+		manager := NewGameManager(time.Second)
+
+		// create a game
+		game := manager.CreateGame([]*Socket{p1, p2})
+		game.StartTurn()
+
+		<-p1.Outgoing // start turn
+		<-p2.Outgoing // wait turn
+
+		// disconnect
+		manager.Process(NewDisconnected(p2))
+
+		// try to take over the seat knowing only the game id
+		manager.Process(Event{
+			Type:    Reconnected,
+			Player:  intruder,
+			Payload: IdPayload(game.Id.String()),
+		})
+
+		select {
+		case <-time.After(100 * time.Millisecond):
+			t.Error("Expected error response")
+		case response := <-intruder.Outgoing:
+			if response.Type != Error {
+				t.Errorf("Expected %v, got %v", Error, response.Type)
+			}
+		}
+
+		players := game.GetPlayers()
+		if _, ok := players[intruder]; ok {
+			t.Error("intruder should not have a seat")
+		}
+		waiting := 0
+		game.do(func() { waiting = len(game.reconnects) })
+		if waiting != 1 {
+			t.Error("seat should still be waiting for its player")
+		}
+	})
+	t.Run("forgets finished games", func(t *testing.T) {
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+
+		manager := NewGameManager(time.Second)
+		game := manager.CreateGame([]*Socket{p1, p2})
+
+		// ended from outside, not by an attack
+		go func() {
+			<-p1.Outgoing // win
+			<-p2.Outgoing // loss
+		}()
+		if err := game.End(game.GetPlayers()[p1].Id); err != nil {
+			t.Fatal(err)
+		}
+
+		deadline := time.After(time.Second)
+		for manager.GameCount() != 0 {
+			select {
+			case <-deadline:
+				t.Fatalf("Expected game to be forgotten, got %v", manager.GameCount())
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+		if manager.FindPlayerGame(p1) != nil {
+			t.Error("Expected no game for player")
+		}
+	})
+
+	t.Run("drain waits for games to finish", func(t *testing.T) {
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+
+		manager := NewGameManager(50 * time.Millisecond)
+		game := manager.CreateGame([]*Socket{p1, p2})
+		game.StartTurn()
+
+		<-p1.Outgoing // start turn
+		<-p2.Outgoing // wait turn
+
+		// game ends by walkover
+		manager.Process(NewDisconnected(p1))
+		go func() {
+			<-p2.Outgoing // win
+		}()
+
+		var snapshots bytes.Buffer
+		manager.SetSnapshotWriter(&snapshots)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		if err := manager.Drain(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if ctx.Err() != nil {
+			t.Error("Expected drain to return before deadline")
+		}
+		if snapshots.Len() != 0 {
+			t.Errorf("Expected no snapshots, got %v", snapshots.String())
+		}
+	})
+
+	t.Run("drain rejects new games", func(t *testing.T) {
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+
+		manager := NewGameManager(time.Second)
+		if err := manager.Drain(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		go manager.Process(CreateGameEvent([]*Socket{p1, p2}))
+
+		for _, socket := range []*Socket{p1, p2} {
+			response := <-socket.Outgoing
+			if code := ErrorCodeOf(response.Payload.(*ProtocolError)); code != ServerShuttingDown {
+				t.Errorf("Expected %v, got %v", ServerShuttingDown, code)
+			}
+		}
+		if manager.GameCount() != 0 {
+			t.Errorf("Expected no games, got %v", manager.GameCount())
+		}
+	})
+
+	t.Run("drain persists unfinished games", func(t *testing.T) {
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+
+		manager := NewGameManager(time.Second)
+		game := manager.CreateGame([]*Socket{p1, p2})
+		game.StartTurn()
+
+		<-p1.Outgoing // start turn
+		<-p2.Outgoing // wait turn
+
+		var buffer bytes.Buffer
+		manager.SetSnapshotWriter(&buffer)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		if err := manager.Drain(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		// cards are interfaces, only check the game level fields
+		var snapshots []struct {
+			Id      uuid.UUID
+			Current uuid.UUID
+			Players []interface{}
+		}
+		if err := json.Unmarshal(buffer.Bytes(), &snapshots); err != nil {
+			t.Fatal(err)
+		}
+		if len(snapshots) != 1 {
+			t.Fatalf("Expected %v snapshot, got %v", 1, len(snapshots))
+		}
+		if snapshots[0].Id != game.Id {
+			t.Errorf("Expected %v, got %v", game.Id, snapshots[0].Id)
+		}
+		if snapshots[0].Current != game.players[p1].Id {
+			t.Errorf("Expected %v current, got %v", game.players[p1].Id, snapshots[0].Current)
+		}
+		if len(snapshots[0].Players) != 2 {
+			t.Errorf("Expected %v players, got %v", 2, len(snapshots[0].Players))
+		}
+	})
 }
@@ -0,0 +1,241 @@
+package pkg
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGameLoop(t *testing.T) {
+	t.Run("dispatches nested events in order", func(t *testing.T) {
+		dispatcher := NewGameDispatcher()
+		player := NewPlayer(NewTestSocket())
+		received := []string{}
+
+		dispatcher.Subscribe(ManaGainedEvent, func(event GameEvent) bool {
+			received = append(received, "mana 1")
+
+			// queued until every listener got the current event
+			dispatcher.Dispatch(DamageIncreased{})
+
+			// only gets later events
+			dispatcher.Subscribe(ManaGainedEvent, func(event GameEvent) bool {
+				received = append(received, "late mana")
+				return true
+			})
+			return true
+		})
+		dispatcher.Subscribe(ManaGainedEvent, func(event GameEvent) bool {
+			received = append(received, "mana 2")
+			return true
+		})
+		dispatcher.Subscribe(DamageIncreasedEvent, func(event GameEvent) bool {
+			received = append(received, "damage")
+			return true
+		})
+
+		dispatcher.Dispatch(ManaGained{player})
+		dispatcher.Dispatch(ManaGained{player})
+
+		expected := []string{"mana 1", "mana 2", "damage", "late mana"}
+		if !reflect.DeepEqual(expected, received) {
+			t.Errorf("Expected %v, got %v", expected, received)
+		}
+	})
+
+	t.Run("serializes concurrent commands", func(t *testing.T) {
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+
+		game := NewGame([]*Socket{p1, p2}, time.Minute)
+
+		// drain messages
+		for _, socket := range []*Socket{p1, p2} {
+			go func(socket *Socket) {
+				for range socket.Outgoing {
+				}
+			}(socket)
+		}
+
+		group := new(sync.WaitGroup)
+		for i := 0; i < 20; i++ {
+			group.Add(1)
+			go func() {
+				defer group.Done()
+				game.EndTurn()
+			}()
+		}
+		group.Wait()
+
+		// every turn gains one mana up to the max, ten turns each
+		for _, player := range game.GetPlayers() {
+			if player.GetTotalMana() != MAX_MANA {
+				t.Errorf("Expected %v mana, got %v", MAX_MANA, player.GetTotalMana())
+			}
+		}
+	})
+
+	t.Run("only ends the current player's turn", func(t *testing.T) {
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+
+		game := NewGame([]*Socket{p1, p2}, time.Minute)
+		game.StartTurn()
+
+		<-p1.Outgoing // start turn
+		<-p2.Outgoing // wait turn
+
+		if err := game.EndTurnOf(p2); ErrorCodeOf(err) != NotYourTurn {
+			t.Errorf("Expected %v, got %v", NotYourTurn, err)
+		}
+		if err := game.EndTurnOf(NewTestSocket()); ErrorCodeOf(err) != NotInGame {
+			t.Errorf("Expected %v, got %v", NotInGame, err)
+		}
+		if err := game.EndTurnOf(p1); err != nil {
+			t.Fatal(err)
+		}
+		if !game.IsCurrent(p2) {
+			t.Error("Expected second player's turn")
+		}
+	})
+
+	t.Run("turn timer", func(t *testing.T) {
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+
+		game := NewGame([]*Socket{p1, p2}, 50*time.Millisecond)
+		game.StartTurn()
+
+		// stop the timer from playing on once the test is over
+		defer game.End(game.GetPlayers()[p1].Id)
+
+		<-p1.Outgoing // start turn
+		<-p2.Outgoing // wait turn
+
+		select {
+		case response := <-p2.Outgoing:
+			if response.Type != StartTurn {
+				t.Errorf("Expected %v, got %v", StartTurn, response.Type)
+			}
+		case <-time.After(200 * time.Millisecond):
+			t.Error("Expected turn to time out")
+		}
+
+		// ending a turn restarts the timer instead of stacking another
+		<-p1.Outgoing // wait turn
+		game.EndTurn()
+		<-p1.Outgoing // start turn
+		<-p2.Outgoing // wait turn
+
+		select {
+		case response := <-p1.Outgoing:
+			t.Errorf("Expected a single turn, got %v", response.Type)
+		case <-time.After(30 * time.Millisecond):
+		}
+	})
+
+	t.Run("rejects commands once over", func(t *testing.T) {
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+
+		game := NewGame([]*Socket{p1, p2}, time.Minute)
+		game.StartTurn()
+
+		<-p1.Outgoing // start turn
+		<-p2.Outgoing // wait turn
+
+		game.Disconnect(p1, 10*time.Millisecond)
+		if response := <-p2.Outgoing; response.Type != Win {
+			t.Errorf("Expected %v, got %v", Win, response.Type)
+		}
+		<-game.Done()
+
+		if err := game.EndTurnOf(p1); ErrorCodeOf(err) != GameNotFound {
+			t.Errorf("Expected %v, got %v", GameNotFound, err)
+		}
+		if game.HasPlayer(p1) {
+			t.Error("Finished games should have no players")
+		}
+	})
+
+	t.Run("ends itself when a command panics", func(t *testing.T) {
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+
+		game := NewGame([]*Socket{p1, p2}, time.Minute)
+		game.do(func() {
+			panic("broken command")
+		})
+
+		select {
+		case <-game.Done():
+		case <-time.After(100 * time.Millisecond):
+			t.Fatal("Expected game to end")
+		}
+
+		for _, socket := range []*Socket{p1, p2} {
+			response := <-socket.Outgoing
+			if payload, ok := response.Payload.(*ProtocolError); !ok || payload.Code != Internal {
+				t.Errorf("Expected %v, got %v", Internal, response.Payload)
+			}
+		}
+	})
+
+	t.Run("hands out copies of its players", func(t *testing.T) {
+		p1 := NewTestSocket()
+		game := NewGame([]*Socket{p1, NewTestSocket()}, time.Minute)
+		defer game.End(game.GetPlayers()[p1].Id)
+
+		delete(game.GetPlayers(), p1)
+		if !game.HasPlayer(p1) {
+			t.Error("Expected player to keep their seat")
+		}
+	})
+
+	t.Run("ignores disconnects of other sockets", func(t *testing.T) {
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+		game := NewGame([]*Socket{p1, p2}, time.Minute)
+		defer game.End(game.GetPlayers()[p1].Id)
+
+		game.Disconnect(NewTestSocket(), 10*time.Millisecond)
+
+		select {
+		case response := <-p1.Outgoing:
+			t.Errorf("Expected game to go on, got %v", response.Type)
+		case response := <-p2.Outgoing:
+			t.Errorf("Expected game to go on, got %v", response.Type)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("waits for every disconnected seat", func(t *testing.T) {
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+		game := NewGame([]*Socket{p1, p2}, time.Minute)
+
+		game.Disconnect(p1, time.Minute)
+		game.Disconnect(p2, time.Minute)
+
+		for _, socket := range []*Socket{p1, p2} {
+			back := NewTestSocket()
+			back.Session = socket.Session
+			if err := game.Reconnect(back); err != nil {
+				t.Errorf("Expected %v to take their seat back, got %v", socket.Id, err)
+			}
+		}
+		game.End(game.GetPlayers()[game.GetSockets()[0]].Id)
+	})
+
+	t.Run("draws nothing from an empty deck", func(t *testing.T) {
+		player := NewPlayer(NewTestSocket())
+
+		if drawn := player.DrawCards(MAX_DECK_SIZE + 1); len(drawn) != MAX_DECK_SIZE {
+			t.Errorf("Expected %v cards, got %v", MAX_DECK_SIZE, len(drawn))
+		}
+		if drawn := player.DrawCards(1); len(drawn) != 0 {
+			t.Errorf("Expected no cards, got %v", len(drawn))
+		}
+	})
+}
@@ -56,6 +56,24 @@ func (h *Hand) GetCards() []Card {
 	return cards
 }
 
+// Copies the hand as it is now
+func (h *Hand) Snapshot() *Hand {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	cards := map[uuid.UUID]Card{}
+	for id, card := range h.Cards {
+		if minion, ok := card.(*Minion); ok {
+			card = minion.Snapshot()
+		}
+		cards[id] = card
+	}
+	return &Hand{
+		Cards: cards,
+		mutex: new(sync.Mutex),
+	}
+}
+
 func (h *Hand) Find(cardId uuid.UUID) Card {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
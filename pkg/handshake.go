@@ -0,0 +1,107 @@
+package pkg
+
+import "fmt"
+
+// Protocol revisions the server is able to speak. Clients which never send
+// a hello are assumed to speak the legacy revision
+const PROTOCOL_VERSION = 2
+const MIN_PROTOCOL_VERSION = 1
+const LEGACY_PROTOCOL_VERSION = 1
+
+// Revision that brought feature flags, older clients keep the legacy
+// message shapes whatever features they ask for
+const FEATURES_PROTOCOL_VERSION = 2
+
+// Server build, overridden at link time with -ldflags "-X ..."
+var Build = "dev"
+
+type Feature string
+
+const (
+	SessionResume Feature = "session_resume"
+	RequestIds    Feature = "request_ids"
+	ErrorCodes    Feature = "error_codes"
+	StateDiffs    Feature = "state_diffs"
+)
+
+// Features this build supports, in no particular order
+var ServerFeatures = []Feature{
+	SessionResume,
+	RequestIds,
+	ErrorCodes,
+	StateDiffs,
+}
+
+type HelloPayload struct {
+	Version  int       `json:"version"`
+	Build    string    `json:"build,omitempty"`
+	Features []Feature `json:"features"`
+}
+
+func WelcomeMessage(payload HelloPayload) Response {
+	return Response{
+		Type:    Welcome,
+		Payload: payload,
+	}
+}
+
+// Picks the highest version both sides speak and the features both sides
+// support at that version, fails if the client is too old to be served
+func Negotiate(hello HelloPayload) (HelloPayload, error) {
+	if hello.Version < MIN_PROTOCOL_VERSION {
+		return HelloPayload{}, NewProtocolError(UnsupportedProtocol, fmt.Sprintf(
+			"Unsupported protocol version %v, minimum is %v",
+			hello.Version,
+			MIN_PROTOCOL_VERSION,
+		))
+	}
+
+	version := hello.Version
+	if version > PROTOCOL_VERSION {
+		version = PROTOCOL_VERSION
+	}
+
+	features := []Feature{}
+	if version < FEATURES_PROTOCOL_VERSION {
+		return HelloPayload{Version: version, Build: Build, Features: features}, nil
+	}
+	for _, feature := range hello.Features {
+		for _, supported := range ServerFeatures {
+			if feature == supported {
+				features = append(features, feature)
+				break
+			}
+		}
+	}
+
+	return HelloPayload{
+		Version:  version,
+		Build:    Build,
+		Features: features,
+	}, nil
+}
+
+// Handles the hello event of a socket, downgrading it to the negotiated
+// version and closing the connection when the client cannot be served
+func (s *Server) Handshake(socket *Socket, event Event) {
+	if socket.Negotiated() {
+		event.Reply(ErrorMessage(NewProtocolError(HandshakeDone, "Handshake already done")))
+		return
+	}
+
+	// hello comes before events are decoded, so it is decoded here
+	var hello HelloPayload
+	if err := DecodePayload(event, &hello); err != nil {
+		socket.Close(ErrorMessage(err))
+		return
+	}
+
+	negotiated, err := Negotiate(hello)
+	if err != nil {
+		socket.Close(ErrorMessage(err))
+		return
+	}
+
+	socket.SetProtocol(negotiated.Version, negotiated.Features)
+	socket.Send(WelcomeMessage(negotiated))
+}
@@ -0,0 +1,76 @@
+package pkg
+
+import "testing"
+
+func TestNegotiate(t *testing.T) {
+	t.Run("same version", func(t *testing.T) {
+		negotiated, err := Negotiate(HelloPayload{
+			Version:  PROTOCOL_VERSION,
+			Features: []Feature{SessionResume},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if negotiated.Version != PROTOCOL_VERSION {
+			t.Errorf("Expected %v, got %v", PROTOCOL_VERSION, negotiated.Version)
+		}
+		if len(negotiated.Features) != 1 || negotiated.Features[0] != SessionResume {
+			t.Errorf("Expected %v, got %v", []Feature{SessionResume}, negotiated.Features)
+		}
+		if negotiated.Build != Build {
+			t.Errorf("Expected %v build, got %v", Build, negotiated.Build)
+		}
+	})
+
+	t.Run("downgrades newer clients", func(t *testing.T) {
+		negotiated, err := Negotiate(HelloPayload{Version: PROTOCOL_VERSION + 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if negotiated.Version != PROTOCOL_VERSION {
+			t.Errorf("Expected %v, got %v", PROTOCOL_VERSION, negotiated.Version)
+		}
+	})
+
+	t.Run("keeps older supported clients", func(t *testing.T) {
+		negotiated, err := Negotiate(HelloPayload{Version: MIN_PROTOCOL_VERSION})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if negotiated.Version != MIN_PROTOCOL_VERSION {
+			t.Errorf("Expected %v, got %v", MIN_PROTOCOL_VERSION, negotiated.Version)
+		}
+	})
+
+	t.Run("rejects unsupported clients", func(t *testing.T) {
+		if _, err := Negotiate(HelloPayload{Version: MIN_PROTOCOL_VERSION - 1}); ErrorCodeOf(err) != UnsupportedProtocol {
+			t.Errorf("Expected %v, got %v", UnsupportedProtocol, err)
+		}
+	})
+
+	t.Run("legacy clients get no features", func(t *testing.T) {
+		negotiated, err := Negotiate(HelloPayload{
+			Version:  LEGACY_PROTOCOL_VERSION,
+			Features: []Feature{SessionResume, ErrorCodes},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(negotiated.Features) != 0 {
+			t.Errorf("Expected no features, got %v", negotiated.Features)
+		}
+	})
+
+	t.Run("drops unknown features", func(t *testing.T) {
+		negotiated, err := Negotiate(HelloPayload{
+			Version:  PROTOCOL_VERSION,
+			Features: []Feature{"teleport", SessionResume},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(negotiated.Features) != 1 || negotiated.Features[0] != SessionResume {
+			t.Errorf("Expected %v, got %v", []Feature{SessionResume}, negotiated.Features)
+		}
+	})
+}
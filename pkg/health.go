@@ -0,0 +1,110 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	StatusOk          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Check tells whether something the server needs is working, returning
+// details to report when it is, such as how many cards were loaded
+type Check func() (string, error)
+
+type CheckResult struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type HealthPayload struct {
+	Status string                 `json:"status"`
+	Uptime string                 `json:"uptime"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checks the server runs on readiness, on top of cards and draining
+func (s *Server) AddReadinessCheck(name string, check Check) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.checks = append(s.checks, namedCheck{name, check})
+}
+
+// Liveness, the process is up and serving requests
+func (s *Server) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, HealthPayload{
+		Status: StatusOk,
+		Uptime: s.uptime(),
+	})
+}
+
+// Readiness, whether new players can be taken. Every check is run and
+// reported, any failing one makes the server unavailable
+func (s *Server) HandleReady(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	checks := append([]namedCheck{
+		{"cards", cardsCheck},
+		{"draining", s.drainingCheck},
+	}, s.checks...)
+	s.mutex.Unlock()
+
+	payload := HealthPayload{
+		Status: StatusOk,
+		Uptime: s.uptime(),
+		Checks: make(map[string]CheckResult),
+	}
+
+	for _, entry := range checks {
+		detail, err := entry.check()
+		if err != nil {
+			payload.Status = StatusUnavailable
+			payload.Checks[entry.name] = CheckResult{Status: StatusUnavailable, Error: err.Error()}
+			continue
+		}
+		payload.Checks[entry.name] = CheckResult{Status: StatusOk, Detail: detail}
+	}
+
+	status := http.StatusOK
+	if payload.Status != StatusOk {
+		status = http.StatusServiceUnavailable
+	}
+	writeHealth(w, status, payload)
+}
+
+func cardsCheck() (string, error) {
+	count, err := CheckCards()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%v cards loaded", count), nil
+}
+
+func (s *Server) drainingCheck() (string, error) {
+	if s.Draining() {
+		return "", errors.New("server is shutting down")
+	}
+	return "", nil
+}
+
+func (s *Server) uptime() string {
+	return time.Since(s.started).Round(time.Second).String()
+}
+
+func writeHealth(w http.ResponseWriter, status int, payload HealthPayload) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(payload)
+}
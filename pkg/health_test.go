@@ -0,0 +1,102 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Requests path from server, decoding the health payload
+func GetHealth(t *testing.T, server *Server, path string) (int, HealthPayload) {
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var payload HealthPayload
+	if err := json.NewDecoder(recorder.Body).Decode(&payload); err != nil {
+		t.Fatal(err)
+	}
+	return recorder.Code, payload
+}
+
+func TestHealth(t *testing.T) {
+	t.Run("alive", func(t *testing.T) {
+		status, payload := GetHealth(t, NewServer(), "/healthz")
+
+		if status != http.StatusOK || payload.Status != StatusOk {
+			t.Errorf("Expected %v, got %v %v", StatusOk, status, payload.Status)
+		}
+	})
+
+	t.Run("ready", func(t *testing.T) {
+		status, payload := GetHealth(t, NewServer(), "/readyz")
+
+		if status != http.StatusOK || payload.Status != StatusOk {
+			t.Errorf("Expected %v, got %v %v", StatusOk, status, payload)
+		}
+		if payload.Checks["cards"].Status != StatusOk || payload.Checks["cards"].Detail == "" {
+			t.Errorf("Expected cards to be loaded, got %v", payload.Checks["cards"])
+		}
+		if payload.Checks["draining"].Status != StatusOk {
+			t.Errorf("Expected %v, got %v", StatusOk, payload.Checks["draining"])
+		}
+	})
+
+	t.Run("not ready without cards", func(t *testing.T) {
+		cardsMutex.Lock()
+		data, file := cardData, cardsFile
+		cardData, cardsFile = nil, "missing.json"
+		cardsMutex.Unlock()
+
+		defer func() {
+			cardsMutex.Lock()
+			cardData, cardsFile = data, file
+			cardsMutex.Unlock()
+		}()
+
+		status, payload := GetHealth(t, NewServer(), "/readyz")
+
+		if status != http.StatusServiceUnavailable || payload.Status != StatusUnavailable {
+			t.Errorf("Expected %v, got %v %v", StatusUnavailable, status, payload.Status)
+		}
+		if payload.Checks["cards"].Error == "" {
+			t.Errorf("Expected cards error, got %v", payload.Checks["cards"])
+		}
+	})
+
+	t.Run("not ready while draining", func(t *testing.T) {
+		server := NewServer()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+
+		status, payload := GetHealth(t, server, "/readyz")
+		if status != http.StatusServiceUnavailable || payload.Checks["draining"].Status != StatusUnavailable {
+			t.Errorf("Expected %v, got %v %v", StatusUnavailable, status, payload.Checks["draining"])
+		}
+
+		// still alive though
+		if status, _ := GetHealth(t, server, "/healthz"); status != http.StatusOK {
+			t.Errorf("Expected %v, got %v", http.StatusOK, status)
+		}
+	})
+
+	t.Run("custom checks", func(t *testing.T) {
+		server := NewServer()
+		server.AddReadinessCheck("storage", func() (string, error) {
+			return "", errors.New("unreachable")
+		})
+
+		status, payload := GetHealth(t, server, "/readyz")
+		if status != http.StatusServiceUnavailable {
+			t.Errorf("Expected %v, got %v", http.StatusServiceUnavailable, status)
+		}
+		if result := payload.Checks["storage"]; result.Error != "unreachable" {
+			t.Errorf("Expected %v, got %v", "unreachable", result)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package pkg
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Messages kept per player for replaying to a reconnecting client
+const REPLAY_BUFFER = 256
+
+// Journal numbers the messages sent to a player and keeps the latest ones,
+// so a client coming back can be sent exactly what it missed. Numbers may
+// skip on a live connection when its outbox drops or coalesces messages
+type Journal struct {
+	mutex   *sync.Mutex
+	size    int
+	seq     uint64
+	entries []Response
+}
+
+func NewJournal(size int) *Journal {
+	return &Journal{
+		mutex:   new(sync.Mutex),
+		size:    size,
+		entries: []Response{},
+	}
+}
+
+// Numbers message and keeps it encoded as it is now, dropping the oldest
+// one when full. Replays must not see changes made after it was sent
+func (j *Journal) Record(message Response) Response {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.seq++
+	message.Seq = j.seq
+
+	if j.size == 0 {
+		return message
+	}
+
+	// errors never change once sent and are kept as they are, so replays
+	// can still reshape them for legacy clients
+	kept := message
+	if _, ok := message.Payload.(error); !ok {
+		// msgpack goes through JSON too, so raw JSON replays on any codec
+		payload, err := json.Marshal(message.Payload)
+		if err != nil {
+			// a gap can't be replayed, resuming falls back to the whole game
+			DefaultLogger().With(Fields{"type": message.Type, "error": err}).Warn("could not keep message")
+			j.entries = j.entries[:0]
+			return message
+		}
+		kept.Payload = json.RawMessage(payload)
+	}
+
+	if len(j.entries) == j.size {
+		copy(j.entries, j.entries[1:])
+		j.entries = j.entries[:len(j.entries)-1]
+	}
+	j.entries = append(j.entries, kept)
+
+	return message
+}
+
+// Last number given to a message
+func (j *Journal) Seq() uint64 {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return j.seq
+}
+
+// Messages numbered after seq, false if some of them were already dropped
+// or seq was never given out
+func (j *Journal) Since(seq uint64) ([]Response, bool) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if seq > j.seq {
+		return nil, false
+	}
+
+	missed := j.seq - seq
+	if missed > uint64(len(j.entries)) {
+		return nil, false
+	}
+
+	messages := make([]Response, missed)
+	copy(messages, j.entries[len(j.entries)-int(missed):])
+	return messages, true
+}
+
+// Changes how many messages are kept, dropping the oldest ones
+func (j *Journal) Resize(size int) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.size = size
+	if len(j.entries) > size {
+		j.entries = append([]Response{}, j.entries[len(j.entries)-size:]...)
+	}
+}
@@ -0,0 +1,222 @@
+package pkg
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestJournal(t *testing.T) {
+	t.Run("numbers messages", func(t *testing.T) {
+		journal := NewJournal(2)
+
+		for i := uint64(1); i <= 3; i++ {
+			message := journal.Record(Response{Type: StartTurn})
+			if message.Seq != i {
+				t.Errorf("Expected %v, got %v", i, message.Seq)
+			}
+		}
+		if journal.Seq() != 3 {
+			t.Errorf("Expected %v, got %v", 3, journal.Seq())
+		}
+	})
+
+	t.Run("returns missed messages", func(t *testing.T) {
+		journal := NewJournal(3)
+		for i := 0; i < 5; i++ {
+			journal.Record(Response{Type: StartTurn})
+		}
+
+		missed, ok := journal.Since(3)
+		if !ok {
+			t.Fatal("Expected missed messages to be kept")
+		}
+		if len(missed) != 2 || missed[0].Seq != 4 || missed[1].Seq != 5 {
+			t.Errorf("Expected messages %v and %v, got %v", 4, 5, missed)
+		}
+
+		if missed, ok := journal.Since(5); !ok || len(missed) != 0 {
+			t.Errorf("Expected nothing missed, got %v", missed)
+		}
+	})
+
+	t.Run("fails when messages were dropped", func(t *testing.T) {
+		journal := NewJournal(3)
+		for i := 0; i < 5; i++ {
+			journal.Record(Response{Type: StartTurn})
+		}
+
+		if _, ok := journal.Since(1); ok {
+			t.Error("Expected dropped messages to fail")
+		}
+		if _, ok := journal.Since(6); ok {
+			t.Error("Expected unknown sequence to fail")
+		}
+	})
+
+	t.Run("keeps messages as they were sent", func(t *testing.T) {
+		journal := NewJournal(2)
+		player := &Player{Id: uuid.New(), Health: MAX_HEALTH}
+
+		journal.Record(Response{Type: ManaChanged, Payload: player})
+		player.Health = 1
+
+		missed, _ := journal.Since(0)
+
+		var kept Player
+		if err := json.Unmarshal(missed[0].Payload.(json.RawMessage), &kept); err != nil {
+			t.Fatal(err)
+		}
+		if kept.Health != MAX_HEALTH {
+			t.Errorf("Expected %v health, got %v", MAX_HEALTH, kept.Health)
+		}
+	})
+
+	t.Run("resize", func(t *testing.T) {
+		journal := NewJournal(5)
+		for i := 0; i < 5; i++ {
+			journal.Record(Response{Type: StartTurn})
+		}
+
+		journal.Resize(2)
+		if _, ok := journal.Since(2); ok {
+			t.Error("Expected oldest messages to be dropped")
+		}
+		if missed, ok := journal.Since(3); !ok || len(missed) != 2 {
+			t.Errorf("Expected %v messages, got %v", 2, missed)
+		}
+
+		journal.Resize(0)
+		journal.Record(Response{Type: StartTurn})
+		if _, ok := journal.Since(5); ok {
+			t.Error("Expected nothing to be kept")
+		}
+	})
+
+	t.Run("replays missed messages on resume", func(t *testing.T) {
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+		p3 := NewTestSocket()
+
+		// same player on a new connection
+		p3.Session = p2.Session
+
+		manager := NewGameManager(time.Second)
+		game := manager.CreateGame([]*Socket{p1, p2})
+		game.StartTurn()
+
+		<-p1.Outgoing // start turn
+		seen := (<-p2.Outgoing).Seq
+
+		manager.Process(NewDisconnected(p2))
+
+		// sent while away
+		game.EndTurn()
+		<-p1.Outgoing // wait turn
+
+		manager.Process(Event{
+			Type:    Resume,
+			Player:  p3,
+			Payload: ResumePayload{GameId: game.Id.String(), LastSeq: seen},
+		})
+
+		resumed := ReadOutgoing(t, p3, Resumed).Payload.(ResumedPayload)
+		if !resumed.Replayed || resumed.GameId != game.Id {
+			t.Errorf("Expected replay of %v, got %v", game.Id, resumed)
+		}
+		if resumed.LastSeq != seen+1 {
+			t.Errorf("Expected %v, got %v", seen+1, resumed.LastSeq)
+		}
+
+		replayed := ReadOutgoing(t, p3, StartTurn)
+		if replayed.Seq != seen+1 {
+			t.Errorf("Expected %v, got %v", seen+1, replayed.Seq)
+		}
+
+		// numbering carries on over the new connection
+		game.EndTurn()
+		if response := ReadOutgoing(t, p3, WaitTurn); response.Seq != seen+2 {
+			t.Errorf("Expected %v, got %v", seen+2, response.Seq)
+		}
+	})
+
+	t.Run("replays errors to legacy clients as text", func(t *testing.T) {
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+
+		// same player on a client without error codes
+		p3 := NewTestSocket()
+		p3.Session = p2.Session
+		p3.features = make(map[Feature]bool)
+
+		manager := NewGameManager(time.Second)
+		game := manager.CreateGame([]*Socket{p1, p2})
+		manager.Process(NewDisconnected(p2))
+
+		// sent while away
+		game.do(func() {
+			game.players[p2].Send(ErrorMessage(NewProtocolError(NotYourTurn, "Not your turn", game.Id)))
+		})
+
+		manager.Process(Event{
+			Type:    Resume,
+			Player:  p3,
+			Payload: ResumePayload{GameId: game.Id.String()},
+		})
+
+		ReadOutgoing(t, p3, Resumed)
+		if replayed := ReadOutgoing(t, p3, Error); replayed.Payload != "Not your turn" {
+			t.Errorf("Expected %v, got %v", "Not your turn", replayed.Payload)
+		}
+	})
+
+	t.Run("sends whole game when messages were dropped", func(t *testing.T) {
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+		p3 := NewTestSocket()
+		p3.Session = p2.Session
+
+		manager := NewGameManager(time.Second)
+		game := manager.CreateGame([]*Socket{p1, p2})
+		game.SetReplayBuffer(1)
+		game.StartTurn()
+
+		<-p1.Outgoing // start turn
+		seen := (<-p2.Outgoing).Seq
+
+		manager.Process(NewDisconnected(p2))
+
+		game.EndTurn()
+		game.EndTurn()
+		<-p1.Outgoing // wait turn
+		<-p1.Outgoing // start turn
+
+		manager.Process(Event{
+			Type:    Resume,
+			Player:  p3,
+			Payload: ResumePayload{GameId: game.Id.String(), LastSeq: seen},
+		})
+
+		if resumed := ReadOutgoing(t, p3, Resumed).Payload.(ResumedPayload); resumed.Replayed {
+			t.Error("Expected no replay")
+		}
+		ReadOutgoing(t, p3, "reconnected")
+		ReadOutgoing(t, p3, WaitTurn)
+	})
+
+	t.Run("rejects resume from another session", func(t *testing.T) {
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+		intruder := NewTestSocket()
+
+		manager := NewGameManager(time.Second)
+		game := manager.CreateGame([]*Socket{p1, p2})
+		manager.Process(NewDisconnected(p2))
+
+		if err := game.Resume(intruder, 0); ErrorCodeOf(err) != SessionMismatch {
+			t.Errorf("Expected %v, got %v", SessionMismatch, err)
+		}
+	})
+}
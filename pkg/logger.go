@@ -0,0 +1,249 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type LogLevel int
+
+const (
+	DebugLevel LogLevel = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	case ErrorLevel:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+func ParseLogLevel(value string) (LogLevel, error) {
+	for level := DebugLevel; level <= ErrorLevel; level++ {
+		if strings.EqualFold(value, level.String()) {
+			return level, nil
+		}
+	}
+	return InfoLevel, fmt.Errorf("unknown log level %q", value)
+}
+
+// Context attached to log entries, such as game_id or event
+type Fields map[string]interface{}
+
+type LogEntry struct {
+	Time    time.Time
+	Level   LogLevel
+	Message string
+	Fields  Fields
+}
+
+// LogSink is where entries end up, it must be safe for concurrent use
+type LogSink interface {
+	Write(entry LogEntry)
+}
+
+// Writes entries as key=value lines, keys sorted
+type TextSink struct {
+	mutex  *sync.Mutex
+	writer io.Writer
+}
+
+func NewTextSink(writer io.Writer) *TextSink {
+	return &TextSink{mutex: new(sync.Mutex), writer: writer}
+}
+
+func (s *TextSink) Write(entry LogEntry) {
+	var line strings.Builder
+	fmt.Fprintf(&line, "%v %-5v %v", entry.Time.Format(time.RFC3339), strings.ToUpper(entry.Level.String()), entry.Message)
+
+	keys := make([]string, 0, len(entry.Fields))
+	for key := range entry.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := fmt.Sprint(entry.Fields[key])
+		if strings.ContainsAny(value, " \"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		fmt.Fprintf(&line, " %v=%v", key, value)
+	}
+	line.WriteString("\n")
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	io.WriteString(s.writer, line.String())
+}
+
+// Writes entries as one JSON object per line, fields next to time, level
+// and msg
+type JSONSink struct {
+	mutex  *sync.Mutex
+	writer io.Writer
+}
+
+func NewJSONSink(writer io.Writer) *JSONSink {
+	return &JSONSink{mutex: new(sync.Mutex), writer: writer}
+}
+
+func (s *JSONSink) Write(entry LogEntry) {
+	object := make(map[string]interface{}, len(entry.Fields)+3)
+	for key, value := range entry.Fields {
+		// errors have no exported fields, they would come out empty
+		switch value := value.(type) {
+		case error:
+			object[key] = value.Error()
+		case time.Duration:
+			object[key] = value.String()
+		default:
+			object[key] = value
+		}
+	}
+	object["time"] = entry.Time.Format(time.RFC3339Nano)
+	object["level"] = entry.Level.String()
+	object["msg"] = entry.Message
+
+	data, err := json.Marshal(object)
+	if err != nil {
+		data, _ = json.Marshal(map[string]interface{}{
+			"time":  object["time"],
+			"level": object["level"],
+			"msg":   entry.Message,
+			"error": err.Error(),
+		})
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.writer.Write(append(data, '\n'))
+}
+
+// Logger writes leveled entries to a sink, carrying the fields given to With
+// along to every entry
+type Logger struct {
+	sink   LogSink
+	level  LogLevel
+	fields Fields
+}
+
+func NewLogger(sink LogSink, level LogLevel) *Logger {
+	return &Logger{sink: sink, level: level, fields: Fields{}}
+}
+
+func NewLoggerWithConfig(config Config) (*Logger, error) {
+	level, err := ParseLogLevel(config.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	switch config.LogFormat {
+	case "", "text":
+		return NewLogger(NewTextSink(os.Stderr), level), nil
+	case "json":
+		return NewLogger(NewJSONSink(os.Stderr), level), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", config.LogFormat)
+}
+
+// Logger adding fields to every entry, on top of the current ones
+func (l *Logger) With(fields Fields) *Logger {
+	merged := make(Fields, len(l.fields)+len(fields))
+	for key, value := range l.fields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return &Logger{sink: l.sink, level: l.level, fields: merged}
+}
+
+func (l *Logger) Enabled(level LogLevel) bool {
+	return level >= l.level
+}
+
+func (l *Logger) Log(level LogLevel, message string) {
+	if !l.Enabled(level) {
+		return
+	}
+	l.sink.Write(LogEntry{
+		Time:    time.Now(),
+		Level:   level,
+		Message: message,
+		Fields:  l.fields,
+	})
+}
+
+func (l *Logger) Debug(message string) {
+	l.Log(DebugLevel, message)
+}
+
+func (l *Logger) Info(message string) {
+	l.Log(InfoLevel, message)
+}
+
+func (l *Logger) Warn(message string) {
+	l.Log(WarnLevel, message)
+}
+
+func (l *Logger) Error(message string) {
+	l.Log(ErrorLevel, message)
+}
+
+var defaultLogger = struct {
+	mutex  sync.RWMutex
+	logger *Logger
+}{logger: NewLogger(NewTextSink(os.Stderr), InfoLevel)}
+
+// Logger used by the server, matchmaking and games
+func DefaultLogger() *Logger {
+	defaultLogger.mutex.RLock()
+	defer defaultLogger.mutex.RUnlock()
+
+	return defaultLogger.logger
+}
+
+// Replaces the logger used by the server, matchmaking and games
+func SetDefaultLogger(logger *Logger) {
+	defaultLogger.mutex.Lock()
+	defer defaultLogger.mutex.Unlock()
+
+	defaultLogger.logger = logger
+}
+
+// Context of an event, to be added to every entry logged about it
+func (e Event) Fields() Fields {
+	fields := Fields{"event": e.Type}
+	if e.Player != nil {
+		fields["socket_id"] = e.Player.Id
+		fields["session"] = e.Player.Session
+	}
+	if e.RequestId != "" {
+		fields["request_id"] = e.RequestId
+	}
+	return fields
+}
+
+func (s *Socket) Fields() Fields {
+	return Fields{"socket_id": s.Id, "session": s.Session}
+}
+
+func (p *Player) Fields() Fields {
+	return Fields{"player_id": p.Id, "socket_id": p.socket.Id}
+}
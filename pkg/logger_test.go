@@ -0,0 +1,166 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Keeps entries in memory so tests can look at them
+type MemorySink struct {
+	mutex   *sync.Mutex
+	entries []LogEntry
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{mutex: new(sync.Mutex)}
+}
+
+func (s *MemorySink) Write(entry LogEntry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.entries = append(s.entries, entry)
+}
+
+// First entry with the given message
+func (s *MemorySink) Find(message string) (LogEntry, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, entry := range s.entries {
+		if entry.Message == message {
+			return entry, true
+		}
+	}
+	return LogEntry{}, false
+}
+
+// Sends the default logger to a memory sink for the rest of the test
+func CaptureLogs(t *testing.T) *MemorySink {
+	sink := NewMemorySink()
+	previous := DefaultLogger()
+	SetDefaultLogger(NewLogger(sink, DebugLevel))
+
+	t.Cleanup(func() {
+		SetDefaultLogger(previous)
+	})
+	return sink
+}
+
+func TestLogger(t *testing.T) {
+	t.Run("levels", func(t *testing.T) {
+		sink := NewMemorySink()
+		logger := NewLogger(sink, WarnLevel)
+
+		logger.Debug("debug")
+		logger.Info("info")
+		logger.Warn("warn")
+		logger.Error("error")
+
+		if len(sink.entries) != 2 {
+			t.Fatalf("Expected %v entries, got %v", 2, len(sink.entries))
+		}
+		if sink.entries[0].Level != WarnLevel || sink.entries[1].Level != ErrorLevel {
+			t.Errorf("Expected %v and %v, got %v", WarnLevel, ErrorLevel, sink.entries)
+		}
+	})
+
+	t.Run("parses levels", func(t *testing.T) {
+		if level, err := ParseLogLevel("WARN"); err != nil || level != WarnLevel {
+			t.Errorf("Expected %v, got %v", WarnLevel, level)
+		}
+		if _, err := ParseLogLevel("loud"); err == nil {
+			t.Error("Expected error for unknown level")
+		}
+	})
+
+	t.Run("fields", func(t *testing.T) {
+		sink := NewMemorySink()
+		logger := NewLogger(sink, InfoLevel).With(Fields{"game_id": "game"})
+
+		logger.With(Fields{"player_id": "player"}).Info("with player")
+		logger.Info("without player")
+
+		if fields := sink.entries[0].Fields; fields["game_id"] != "game" || fields["player_id"] != "player" {
+			t.Errorf("Expected game and player, got %v", fields)
+		}
+		if _, ok := sink.entries[1].Fields["player_id"]; ok {
+			t.Errorf("Expected parent fields untouched, got %v", sink.entries[1].Fields)
+		}
+	})
+
+	t.Run("text sink", func(t *testing.T) {
+		var buffer bytes.Buffer
+		logger := NewLogger(NewTextSink(&buffer), InfoLevel)
+
+		logger.With(Fields{"game_id": "abc", "error": errors.New("no luck")}).Warn("stuck")
+
+		line := buffer.String()
+		if !strings.Contains(line, "WARN  stuck") || !strings.Contains(line, `error="no luck" game_id=abc`) {
+			t.Errorf("Expected level, message and sorted fields, got %v", line)
+		}
+	})
+
+	t.Run("json sink", func(t *testing.T) {
+		var buffer bytes.Buffer
+		logger := NewLogger(NewJSONSink(&buffer), InfoLevel)
+
+		logger.With(Fields{"error": errors.New("no luck"), "elapsed": time.Second}).Error("stuck")
+
+		var entry map[string]interface{}
+		if err := json.Unmarshal(buffer.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry["level"] != "error" || entry["msg"] != "stuck" {
+			t.Errorf("Expected error level and message, got %v", entry)
+		}
+		if entry["error"] != "no luck" || entry["elapsed"] != "1s" {
+			t.Errorf("Expected readable error and duration, got %v", entry)
+		}
+	})
+
+	t.Run("games log with context", func(t *testing.T) {
+		sink := CaptureLogs(t)
+
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+
+		game := NewGame([]*Socket{p1, p2}, time.Minute)
+		game.StartTurn()
+
+		<-p1.Outgoing // start turn
+		<-p2.Outgoing // wait turn
+
+		entry, ok := sink.Find("turn started")
+		if !ok {
+			t.Fatal("Expected turn to be logged")
+		}
+
+		player := game.GetPlayers()[p1]
+		if entry.Fields["game_id"] != game.Id || entry.Fields["player_id"] != player.Id || entry.Fields["socket_id"] != p1.Id {
+			t.Errorf("Expected game, player and socket ids, got %v", entry.Fields)
+		}
+	})
+
+	t.Run("rejected events are logged", func(t *testing.T) {
+		sink := CaptureLogs(t)
+		manager := NewGameManager(time.Second)
+		socket := NewTestSocket()
+
+		manager.Process(Event{Type: EndTurn, Player: socket, Payload: IdPayload("invalid"), RequestId: "7"})
+		<-socket.Outgoing
+
+		entry, ok := sink.Find("event rejected")
+		if !ok {
+			t.Fatal("Expected rejection to be logged")
+		}
+		if entry.Fields["event"] != EndTurn || entry.Fields["socket_id"] != socket.Id || entry.Fields["request_id"] != "7" {
+			t.Errorf("Expected event context, got %v", entry.Fields)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"context"
 	"sync"
 	"time"
 
@@ -10,20 +11,29 @@ import (
 type MatchManager struct {
 	mutex     *sync.Mutex
 	timeout   time.Duration
+	matchSize int
 	matches   map[uuid.UUID][]*Socket
 	confirmed map[uuid.UUID][]*Socket
-
-	StopTimer chan uuid.UUID
+	timers    map[uuid.UUID]*time.Timer
+	cluster   *Cluster
+	draining  bool
 }
 
 func NewMatchManager(timeout time.Duration) *MatchManager {
+	config := DefaultConfig()
+	config.ConfirmTimeout = timeout
+
+	return NewMatchManagerWithConfig(config)
+}
+
+func NewMatchManagerWithConfig(config Config) *MatchManager {
 	return &MatchManager{
-		timeout:   timeout,
+		timeout:   config.ConfirmTimeout,
+		matchSize: config.MatchSize,
 		mutex:     new(sync.Mutex),
 		matches:   make(map[uuid.UUID][]*Socket),
 		confirmed: make(map[uuid.UUID][]*Socket),
-
-		StopTimer: make(chan uuid.UUID),
+		timers:    make(map[uuid.UUID]*time.Timer),
 	}
 }
 
@@ -47,21 +57,69 @@ func WaitOtherPlayersMessage() Response {
 	}
 }
 
+// Claims matches created here so players elsewhere get routed to them
+func (m *MatchManager) SetCluster(cluster *Cluster) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.cluster = cluster
+}
+
+// Cancels matches still waiting for confirmation and makes no new ones,
+// so no game starts while shutting down
+func (m *MatchManager) Drain(ctx context.Context) error {
+	m.mutex.Lock()
+	m.draining = true
+	pending := []uuid.UUID{}
+	for matchId := range m.matches {
+		pending = append(pending, matchId)
+	}
+	m.mutex.Unlock()
+
+	// confirmed players are not queued again, the queue is closed too
+	for _, matchId := range pending {
+		m.CancelMatch(matchId)
+	}
+	return nil
+}
+
+func (m *MatchManager) Handles() []EventType {
+	return []EventType{CreateMatch, MatchConfirmed, MatchDeclined, Disconnected}
+}
+
 func (m *MatchManager) Process(event Event) *Event {
 	switch event.Type {
 	case CreateMatch:
 		players := event.Payload.([]*Socket)
-		if len(players) == NUM_OF_PLAYERS {
+		if len(players) == m.matchSize {
 			m.CreateMatch(players)
 		}
 	case MatchConfirmed:
-		if matchId, err := uuid.Parse(event.Payload.(string)); err == nil {
-			return m.ConfirmMatch(matchId, event.Player)
+		payload, ok := event.Payload.(IdPayload)
+		if !ok {
+			event.Reply(ErrorMessage(UndecodedPayload(event)))
+			return nil
+		}
+		matchId := payload.Id()
+		next, err := m.ConfirmMatch(matchId, event.Player)
+		if err != nil {
+			event.Reply(ErrorMessage(err))
+			return nil
 		}
+		event.Reply(WaitOtherPlayersMessage())
+		return next
 	case MatchDeclined:
-		if matchId, err := uuid.Parse(event.Payload.(string)); err == nil {
-			return m.CancelMatch(matchId)
+		payload, ok := event.Payload.(IdPayload)
+		if !ok {
+			event.Reply(ErrorMessage(UndecodedPayload(event)))
+			return nil
+		}
+		matchId := payload.Id()
+		next, err := m.DeclineMatch(matchId, event.Player)
+		if err != nil {
+			event.Reply(ErrorMessage(err))
 		}
+		return next
 	case Disconnected:
 		if matchId, ok := m.FindPlayerMatch(event.Player); ok {
 			return m.CancelMatch(matchId)
@@ -74,49 +132,75 @@ func (m *MatchManager) CreateMatch(players []*Socket) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
+	if m.draining {
+		for _, player := range players {
+			player.Send(ErrorMessage(NewProtocolError(ServerShuttingDown, "Server is shutting down")))
+		}
+		return
+	}
+
 	// generate an id
 	id := uuid.New()
 
 	// save the match
 	m.matches[id] = players
+	if m.cluster != nil {
+		m.cluster.Claim(id)
+	}
+
+	sockets := []uuid.UUID{}
+	for _, player := range players {
+		sockets = append(sockets, player.Id)
+	}
+	m.logger(id).With(Fields{"sockets": sockets}).Info("match created")
 
 	// return response
 	for _, player := range players {
-		go player.Send(ConfirmMessage(id))
+		player.Send(ConfirmMessage(id))
 	}
 
-	go m.StartTimer(id)
+	// cancel match when not confirmed in time
+	m.timers[id] = time.AfterFunc(m.timeout, func() {
+		m.logger(id).Info("match not confirmed in time")
+		m.CancelMatch(id)
+	})
 }
 
-func (m *MatchManager) StartTimer(matchId uuid.UUID) {
-	// start timer for match
-	timer := time.NewTimer(m.timeout)
+// Takes the confirmation timer of a match out, to be stopped once the lock
+// is released. Must be called with the lock held
+func (m *MatchManager) takeTimer(matchId uuid.UUID) *time.Timer {
+	timer := m.timers[matchId]
+	delete(m.timers, matchId)
+	return timer
+}
 
-	select {
-	// when timer ends, cancel match
-	case <-timer.C:
-		m.CancelMatch(matchId)
-	case <-m.StopTimer:
-		if !timer.Stop() {
-			<-timer.C
-		}
+func stopTimer(timer *time.Timer) {
+	if timer != nil {
+		timer.Stop()
 	}
 }
 
 func (m *MatchManager) CancelMatch(matchId uuid.UUID) *Event {
 	m.mutex.Lock()
+	timer := m.takeTimer(matchId)
+	defer stopTimer(timer)
 	defer m.mutex.Unlock()
 
 	var event *Event
 
 	// find match
 	if match, ok := m.matches[matchId]; ok {
+		m.logger(matchId).Info("match canceled")
+
 		// send response to players
 		for _, player := range match {
-			go player.Send(MatchCanceledMessage(matchId))
+			player.Send(MatchCanceledMessage(matchId))
 		}
 		// remove match from map
 		delete(m.matches, matchId)
+		if m.cluster != nil {
+			m.cluster.Release(matchId)
+		}
 	}
 
 	// return queue event for confirmed players
@@ -132,35 +216,87 @@ func (m *MatchManager) CancelMatch(matchId uuid.UUID) *Event {
 	return event
 }
 
-func (m *MatchManager) ConfirmMatch(matchId uuid.UUID, player *Socket) *Event {
+func (m *MatchManager) DeclineMatch(matchId uuid.UUID, player *Socket) (*Event, error) {
+	m.mutex.Lock()
+	_, err := m.findMatch(matchId, player)
+	m.mutex.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	return m.CancelMatch(matchId), nil
+}
+
+func (m *MatchManager) ConfirmMatch(matchId uuid.UUID, player *Socket) (*Event, error) {
+	var timer *time.Timer
+	defer func() { stopTimer(timer) }()
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
 	// find match
-	if match, ok := m.matches[matchId]; ok {
-		// add player as confirmed
-		m.confirmed[matchId] = append(m.confirmed[matchId], player)
+	match, err := m.findMatch(matchId, player)
+	if err != nil {
+		return nil, err
+	}
 
-		// send wait other players response
-		go player.Send(WaitOtherPlayersMessage())
+	for _, confirmed := range m.confirmed[matchId] {
+		if confirmed == player {
+			return nil, NewProtocolError(AlreadyConfirmed, "Match already confirmed", matchId)
+		}
+	}
 
-		// if both confirmed
-		if len(m.confirmed[matchId]) == len(match) {
-			// when all players confirmed, stop timer
-			m.StopTimer <- matchId
+	// add player as confirmed
+	m.confirmed[matchId] = append(m.confirmed[matchId], player)
+	m.logger(matchId).With(player.Fields()).Debug("match confirmed")
 
-			// remove match
-			delete(m.matches, matchId)
-			delete(m.confirmed, matchId)
+	// if both confirmed
+	if len(m.confirmed[matchId]) == len(match) {
+		// when all players confirmed, stop timer
+		timer = m.takeTimer(matchId)
 
-			// return create game event
-			return &Event{Type: CreateGame, Payload: match}
+		// remove match
+		delete(m.matches, matchId)
+		delete(m.confirmed, matchId)
+		if m.cluster != nil {
+			m.cluster.Release(matchId)
 		}
+
+		// return create game event
+		m.logger(matchId).Info("match ready")
+		return &Event{Type: CreateGame, Payload: match}, nil
 	}
-	return nil
+	return nil, nil
+}
+
+func (m *MatchManager) RegisterMetrics(metrics *Metrics) {
+	metrics.Register("card_server_pending_matches", "Matches waiting for players to confirm", GaugeFunc(func() float64 {
+		return float64(m.MatchCount())
+	}))
+}
+
+func (m *MatchManager) logger(matchId uuid.UUID) *Logger {
+	return DefaultLogger().With(Fields{"match_id": matchId})
+}
+
+// Finds a match the player is part of, must be called with the lock held
+func (m *MatchManager) findMatch(matchId uuid.UUID, player *Socket) ([]*Socket, error) {
+	match, ok := m.matches[matchId]
+	if !ok {
+		return nil, NewProtocolError(MatchNotFound, "Match not found", matchId)
+	}
+	for _, socket := range match {
+		if socket == player {
+			return match, nil
+		}
+	}
+	return nil, NewProtocolError(NotInMatch, "Player is not part of this match", matchId)
 }
 
 func (m *MatchManager) FindPlayerMatch(player *Socket) (uuid.UUID, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	for matchId, players := range m.matches {
 		for _, socket := range players {
 			if socket == player {
@@ -171,6 +307,31 @@ func (m *MatchManager) FindPlayerMatch(player *Socket) (uuid.UUID, bool) {
 	return uuid.Nil, false
 }
 
+type MatchSummary struct {
+	Id        uuid.UUID   `json:"id"`
+	Players   []uuid.UUID `json:"players"`
+	Confirmed []uuid.UUID `json:"confirmed"`
+}
+
+// Matches waiting for confirmation, players given by socket id
+func (m *MatchManager) Matches() []MatchSummary {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	matches := []MatchSummary{}
+	for matchId, players := range m.matches {
+		summary := MatchSummary{Id: matchId, Players: []uuid.UUID{}, Confirmed: []uuid.UUID{}}
+		for _, player := range players {
+			summary.Players = append(summary.Players, player.Id)
+		}
+		for _, player := range m.confirmed[matchId] {
+			summary.Confirmed = append(summary.Confirmed, player.Id)
+		}
+		matches = append(matches, summary)
+	}
+	return matches
+}
+
 func (m *MatchManager) MatchCount() int {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
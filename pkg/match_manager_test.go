@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -18,7 +19,7 @@ func MatchConfirmedEvent(player *Socket, matchId uuid.UUID) Event {
 	return Event{
 		Type:    MatchConfirmed,
 		Player:  player,
-		Payload: matchId.String(),
+		Payload: IdPayload(matchId.String()),
 	}
 }
 
@@ -26,7 +27,7 @@ func MatchDeclinedEvent(player *Socket, matchId uuid.UUID) Event {
 	return Event{
 		Type:    MatchDeclined,
 		Player:  player,
-		Payload: matchId.String(),
+		Payload: IdPayload(matchId.String()),
 	}
 }
 
@@ -118,6 +119,36 @@ func TestMatchManager(t *testing.T) {
 		}
 	})
 
+	t.Run("times out other matches when one starts", func(t *testing.T) {
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+		p3 := NewTestSocket()
+		p4 := NewTestSocket()
+
+		manager := NewMatchManager(100 * time.Millisecond)
+		manager.CreateMatch([]*Socket{p1, p2})
+		manager.CreateMatch([]*Socket{p3, p4})
+
+		matchId := (<-p1.Outgoing).Payload.(uuid.UUID)
+		<-p2.Outgoing
+		<-p3.Outgoing
+		<-p4.Outgoing
+
+		manager.ConfirmMatch(matchId, p1)
+		if event, _ := manager.ConfirmMatch(matchId, p2); event == nil || event.Type != CreateGame {
+			t.Fatalf("Expected %v, got %v", CreateGame, event)
+		}
+
+		select {
+		case <-time.After(500 * time.Millisecond):
+			t.Error("Expected match canceled response")
+		case response := <-p3.Outgoing:
+			if response.Type != MatchCanceled {
+				t.Errorf("Expected %v, got %v", MatchCanceled, response.Type)
+			}
+		}
+	})
+
 	t.Run("starts game", func(t *testing.T) {
 		p1 := NewTestSocket()
 		p2 := NewTestSocket()
@@ -257,4 +288,96 @@ func TestMatchManager(t *testing.T) {
 			t.Errorf("Expected no matches, got %v", manager.MatchCount())
 		}
 	})
+	t.Run("confirm unknown match", func(t *testing.T) {
+		player := NewTestSocket()
+		manager := NewMatchManager(100 * time.Millisecond)
+
+		event := MatchConfirmedEvent(player, uuid.New())
+		event.RequestId = "confirm-1"
+		manager.Process(event)
+
+		select {
+		case <-time.After(100 * time.Millisecond):
+			t.Error("Expected error response")
+		case response := <-player.Outgoing:
+			if response.Type != Error {
+				t.Errorf("Expected %v, got %v", Error, response.Type)
+			}
+			if response.RequestId != event.RequestId {
+				t.Errorf("Expected %v, got %v", event.RequestId, response.RequestId)
+			}
+			if code := response.Payload.(*ProtocolError).Code; code != MatchNotFound {
+				t.Errorf("Expected %v, got %v", MatchNotFound, code)
+			}
+		}
+	})
+
+	t.Run("confirm twice", func(t *testing.T) {
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+		outsider := NewTestSocket()
+
+		manager := NewMatchManager(time.Second)
+		manager.CreateMatch([]*Socket{p1, p2})
+
+		response := <-p1.Outgoing // confirm match
+		<-p2.Outgoing             // confirm match
+
+		matchId := response.Payload.(uuid.UUID)
+
+		if _, err := manager.ConfirmMatch(matchId, p1); err != nil {
+			t.Fatal(err)
+		}
+
+		// confirming again must not start the game for the other player
+		event, err := manager.ConfirmMatch(matchId, p1)
+		if ErrorCodeOf(err) != AlreadyConfirmed {
+			t.Errorf("Expected %v, got %v", AlreadyConfirmed, err)
+		}
+		if event != nil {
+			t.Errorf("Expected no event, got %v", event)
+		}
+
+		// players outside the match cannot confirm it
+		if _, err := manager.ConfirmMatch(matchId, outsider); ErrorCodeOf(err) != NotInMatch {
+			t.Errorf("Expected %v, got %v", NotInMatch, err)
+		}
+	})
+
+	t.Run("drain cancels pending matches", func(t *testing.T) {
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+
+		manager := NewMatchManager(time.Second)
+		manager.CreateMatch([]*Socket{p1, p2})
+
+		response := <-p1.Outgoing // confirm match
+		<-p2.Outgoing             // confirm match
+
+		matchId := response.Payload.(uuid.UUID)
+		if _, err := manager.ConfirmMatch(matchId, p1); err != nil {
+			t.Fatal(err)
+		}
+
+		go manager.Drain(context.Background())
+
+		for _, socket := range []*Socket{p1, p2} {
+			if response := <-socket.Outgoing; response.Type != MatchCanceled {
+				t.Errorf("Expected %v, got %v", MatchCanceled, response.Type)
+			}
+		}
+
+		// the last confirmation comes too late to start a game
+		if _, err := manager.ConfirmMatch(matchId, p2); ErrorCodeOf(err) != MatchNotFound {
+			t.Errorf("Expected %v, got %v", MatchNotFound, err)
+		}
+
+		manager.CreateMatch([]*Socket{p1, p2})
+		if response := <-p1.Outgoing; ErrorCodeOf(response.Payload.(*ProtocolError)) != ServerShuttingDown {
+			t.Errorf("Expected %v, got %v", ServerShuttingDown, response.Payload)
+		}
+		if manager.MatchCount() != 0 {
+			t.Errorf("Expected no matches, got %v", manager.MatchCount())
+		}
+	})
 }
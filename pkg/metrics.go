@@ -0,0 +1,278 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Buckets in seconds for handler latencies
+var LATENCY_BUCKETS = []float64{0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1}
+
+// Buckets in seconds for how long players wait in the queue
+var QUEUE_WAIT_BUCKETS = []float64{1, 5, 10, 30, 60, 120, 300, 600}
+
+// Buckets in seconds for how long turns last
+var TURN_BUCKETS = []float64{5, 15, 30, 45, 60, 75, 90, 120}
+
+// Collector writes the samples of a metric in Prometheus text format
+type Collector interface {
+	MetricType() string
+	WriteSamples(w io.Writer, name string)
+}
+
+// Components with metrics of their own, registered along with them
+type MetricsSource interface {
+	RegisterMetrics(metrics *Metrics)
+}
+
+type registered struct {
+	name      string
+	help      string
+	collector Collector
+}
+
+// Metrics is a registry of collectors, exposed in Prometheus text format
+type Metrics struct {
+	mutex      *sync.Mutex
+	collectors []registered
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		mutex:      new(sync.Mutex),
+		collectors: []registered{},
+	}
+}
+
+// Adds collector under name, replacing one registered with the same name
+func (m *Metrics) Register(name, help string, collector Collector) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for i, entry := range m.collectors {
+		if entry.name == name {
+			m.collectors[i] = registered{name, help, collector}
+			return
+		}
+	}
+	m.collectors = append(m.collectors, registered{name, help, collector})
+}
+
+// Writes every metric, sorted by name
+func (m *Metrics) WriteText(w io.Writer) {
+	m.mutex.Lock()
+	collectors := append([]registered{}, m.collectors...)
+	m.mutex.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool {
+		return collectors[i].name < collectors[j].name
+	})
+
+	for _, entry := range collectors {
+		fmt.Fprintf(w, "# HELP %v %v\n", entry.name, entry.help)
+		fmt.Fprintf(w, "# TYPE %v %v\n", entry.name, entry.collector.MetricType())
+		entry.collector.WriteSamples(w, entry.name)
+	}
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteText(w)
+}
+
+// Gauge reading its value when collected
+type GaugeFunc func() float64
+
+func (g GaugeFunc) MetricType() string {
+	return "gauge"
+}
+
+func (g GaugeFunc) WriteSamples(w io.Writer, name string) {
+	fmt.Fprintf(w, "%v %v\n", name, formatFloat(g()))
+}
+
+// Counter reading its total when collected, for totals kept elsewhere
+type CounterFunc func() float64
+
+func (c CounterFunc) MetricType() string {
+	return "counter"
+}
+
+func (c CounterFunc) WriteSamples(w io.Writer, name string) {
+	fmt.Fprintf(w, "%v %v\n", name, formatFloat(c()))
+}
+
+// Counter split by the values of a single label
+type Counter struct {
+	mutex  *sync.Mutex
+	label  string
+	counts map[string]uint64
+}
+
+func NewCounter(label string) *Counter {
+	return &Counter{
+		mutex:  new(sync.Mutex),
+		label:  label,
+		counts: make(map[string]uint64),
+	}
+}
+
+func (c *Counter) Inc(value string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.counts[value]++
+}
+
+func (c *Counter) Get(value string) uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.counts[value]
+}
+
+func (c *Counter) MetricType() string {
+	return "counter"
+}
+
+func (c *Counter) WriteSamples(w io.Writer, name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, value := range sortedKeys(c.counts) {
+		fmt.Fprintf(w, "%v{%v} %v\n", name, labels(c.label, value), c.counts[value])
+	}
+}
+
+type buckets struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Histogram split by the values of a single label, an empty label makes a
+// plain histogram
+type Histogram struct {
+	mutex   *sync.Mutex
+	label   string
+	bounds  []float64
+	buckets map[string]*buckets
+}
+
+func NewHistogram(label string, bounds []float64) *Histogram {
+	histogram := &Histogram{
+		mutex:   new(sync.Mutex),
+		label:   label,
+		bounds:  bounds,
+		buckets: make(map[string]*buckets),
+	}
+
+	// plain histograms report zeros until something is observed
+	if label == "" {
+		histogram.buckets[""] = &buckets{counts: make([]uint64, len(bounds))}
+	}
+	return histogram
+}
+
+func (h *Histogram) Observe(value string, observed float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	entry, ok := h.buckets[value]
+	if !ok {
+		entry = &buckets{counts: make([]uint64, len(h.bounds))}
+		h.buckets[value] = entry
+	}
+
+	for i, bound := range h.bounds {
+		if observed <= bound {
+			entry.counts[i]++
+		}
+	}
+	entry.sum += observed
+	entry.count++
+}
+
+func (h *Histogram) ObserveDuration(value string, elapsed time.Duration) {
+	h.Observe(value, elapsed.Seconds())
+}
+
+// Number of observations and their sum for a label value
+func (h *Histogram) Totals(value string) (uint64, float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if entry, ok := h.buckets[value]; ok {
+		return entry.count, entry.sum
+	}
+	return 0, 0
+}
+
+func (h *Histogram) MetricType() string {
+	return "histogram"
+}
+
+func (h *Histogram) WriteSamples(w io.Writer, name string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, value := range sortedKeys(h.buckets) {
+		entry := h.buckets[value]
+
+		// buckets are cumulative, each count includes the smaller ones
+		for i, bound := range h.bounds {
+			fmt.Fprintf(w, "%v_bucket{%v} %v\n", name, labels(h.label, value, "le", formatFloat(bound)), entry.counts[i])
+		}
+		fmt.Fprintf(w, "%v_bucket{%v} %v\n", name, labels(h.label, value, "le", "+Inf"), entry.count)
+
+		if extra := labels(h.label, value); extra != "" {
+			fmt.Fprintf(w, "%v_sum{%v} %v\n", name, extra, formatFloat(entry.sum))
+			fmt.Fprintf(w, "%v_count{%v} %v\n", name, extra, entry.count)
+		} else {
+			fmt.Fprintf(w, "%v_sum %v\n", name, formatFloat(entry.sum))
+			fmt.Fprintf(w, "%v_count %v\n", name, entry.count)
+		}
+	}
+}
+
+// Formats label pairs, skipping the ones with an empty name
+func labels(pairs ...string) string {
+	formatted := []string{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i] == "" {
+			continue
+		}
+		formatted = append(formatted, fmt.Sprintf("%v=%q", pairs[i], pairs[i+1]))
+	}
+	return strings.Join(formatted, ",")
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys(values interface{}) []string {
+	keys := []string{}
+	switch values := values.(type) {
+	case map[string]uint64:
+		for key := range values {
+			keys = append(keys, key)
+		}
+	case map[string]*buckets:
+		for key := range values {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
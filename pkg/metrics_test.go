@@ -0,0 +1,184 @@
+package pkg
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Run("text format", func(t *testing.T) {
+		metrics := NewMetrics()
+
+		counter := NewCounter("type")
+		counter.Inc("queue")
+		counter.Inc("queue")
+		counter.Inc("end_turn")
+
+		histogram := NewHistogram("", []float64{1, 5})
+		histogram.Observe("", 0.5)
+		histogram.Observe("", 3)
+		histogram.Observe("", 10)
+
+		metrics.Register("events_total", "Events received", counter)
+		metrics.Register("wait_seconds", "Time waited", histogram)
+		metrics.Register("sockets", "Sockets connected", GaugeFunc(func() float64 { return 2 }))
+
+		var buffer bytes.Buffer
+		metrics.WriteText(&buffer)
+
+		expected := `# HELP events_total Events received
+# TYPE events_total counter
+events_total{type="end_turn"} 1
+events_total{type="queue"} 2
+# HELP sockets Sockets connected
+# TYPE sockets gauge
+sockets 2
+# HELP wait_seconds Time waited
+# TYPE wait_seconds histogram
+wait_seconds_bucket{le="1"} 1
+wait_seconds_bucket{le="5"} 2
+wait_seconds_bucket{le="+Inf"} 3
+wait_seconds_sum 13.5
+wait_seconds_count 3
+`
+		if buffer.String() != expected {
+			t.Errorf("Expected %v, got %v", expected, buffer.String())
+		}
+	})
+
+	t.Run("labeled histogram", func(t *testing.T) {
+		histogram := NewHistogram("type", []float64{0.1})
+		histogram.ObserveDuration("play_card", 50*time.Millisecond)
+
+		var buffer bytes.Buffer
+		histogram.WriteSamples(&buffer, "latency")
+
+		if !strings.Contains(buffer.String(), `latency_bucket{type="play_card",le="0.1"} 1`) {
+			t.Errorf("Expected labeled bucket, got %v", buffer.String())
+		}
+		if !strings.Contains(buffer.String(), `latency_count{type="play_card"} 1`) {
+			t.Errorf("Expected labeled count, got %v", buffer.String())
+		}
+	})
+
+	t.Run("queue wait", func(t *testing.T) {
+		queue := NewQueueManager()
+		queue.AddToQueue(NewTestSocket())
+		queue.AddToQueue(NewTestSocket())
+
+		time.Sleep(10 * time.Millisecond)
+		queue.PrepareMatch()
+
+		count, sum := queue.wait.Totals("")
+		if count != 2 {
+			t.Errorf("Expected %v waits, got %v", 2, count)
+		}
+		if sum < 0.02 {
+			t.Errorf("Expected at least %v, got %v", 0.02, sum)
+		}
+	})
+
+	t.Run("turn durations", func(t *testing.T) {
+		manager := NewGameManager(time.Second)
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+
+		game := manager.CreateGame([]*Socket{p1, p2})
+		game.StartTurn()
+		<-p1.Outgoing // start turn
+		<-p2.Outgoing // wait turn
+
+		if count, _ := manager.turns.Totals(""); count != 0 {
+			t.Errorf("Expected no turns, got %v", count)
+		}
+
+		game.EndTurn()
+		<-p1.Outgoing // wait turn
+		<-p2.Outgoing // start turn
+
+		if count, _ := manager.turns.Totals(""); count != 1 {
+			t.Errorf("Expected %v turn, got %v", 1, count)
+		}
+	})
+
+	t.Run("outbox stats", func(t *testing.T) {
+		server := NewServer()
+
+		// nothing pumps these outboxes, messages stay queued
+		slow := &Socket{outbox: NewOutbox(1, DropMessages)}
+		slow.outbox.Push(Response{Type: StartTurn})
+		slow.outbox.Push(Response{Type: WaitTurn})
+
+		other := &Socket{outbox: NewOutbox(2, DropMessages)}
+		other.outbox.Push(Response{Type: StartTurn})
+		other.outbox.Push(Response{Type: WaitTurn})
+
+		server.mutex.Lock()
+		server.sockets[slow] = true
+		server.sockets[other] = true
+		server.mutex.Unlock()
+
+		var text strings.Builder
+		server.metrics.WriteText(&text)
+		for _, line := range []string{
+			"card_server_outbox_depth 3",
+			"card_server_outbox_peak_depth 2",
+			"card_server_outbox_dropped_total 1",
+			"card_server_outbox_coalesced_total 0",
+		} {
+			if !strings.Contains(text.String(), line+"\n") {
+				t.Errorf("Expected %v, got %v", line, text.String())
+			}
+		}
+
+		// counts outlive the clients, depths don't
+		server.forget(slow)
+		if stats := server.OutboxStats(); stats.Dropped != 1 || stats.Depth != 2 {
+			t.Errorf("Expected %v dropped and %v depth, got %+v", 1, 2, stats)
+		}
+	})
+
+	t.Run("endpoint", func(t *testing.T) {
+		server := NewServer()
+		games := NewGameManager(time.Second)
+		server.RegisterHandler(NewQueueManager())
+		server.RegisterHandler(games)
+		server.RegisterHandler(NewMatchManager(time.Second))
+
+		games.CreateGame([]*Socket{NewTestSocket(), NewTestSocket()})
+		server.ProcessEvent(Event{Type: QueueUp, Player: NewTestSocket()})
+
+		// every manager handles it, timed once still
+		server.ProcessEvent(NewDisconnected(NewTestSocket()))
+
+		listener := httptest.NewServer(server.Handler())
+		defer listener.Close()
+
+		response, err := http.Get(listener.URL + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+
+		body, _ := io.ReadAll(response.Body)
+		for _, line := range []string{
+			"card_server_connected_sockets 0",
+			"card_server_queue_length 1",
+			"card_server_pending_matches 0",
+			"card_server_active_games 1",
+			"card_server_queue_wait_seconds_count 0",
+			"card_server_turn_duration_seconds_count 0",
+			`card_server_event_duration_seconds_count{type="queue"} 1`,
+			`card_server_event_duration_seconds_count{type="disconnected"} 1`,
+		} {
+			if !strings.Contains(string(body), line+"\n") {
+				t.Errorf("Expected %v, got %v", line, string(body))
+			}
+		}
+	})
+}
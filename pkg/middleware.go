@@ -0,0 +1,71 @@
+package pkg
+
+import "time"
+
+// Events taking longer than this are logged by LogSlowEvents
+const SLOW_EVENT = 100 * time.Millisecond
+
+// Lets plain functions be used as handlers
+type HandlerFunc func(event Event) *Event
+
+func (f HandlerFunc) Process(event Event) *Event {
+	return f(event)
+}
+
+// Middleware wraps a handler with logic shared by every handler, calling
+// next.Process to go on or returning without it to stop the event there
+type Middleware func(next EventHandler) EventHandler
+
+// Combines middleware into one, the first being the outermost
+func Chain(middleware ...Middleware) Middleware {
+	return func(next EventHandler) EventHandler {
+		for i := len(middleware) - 1; i >= 0; i-- {
+			next = middleware[i](next)
+		}
+		return next
+	}
+}
+
+// Turns a panic into an internal error for the player who sent the event,
+// so a broken handler doesn't take the socket's goroutine with it
+func Recovery() Middleware {
+	return func(next EventHandler) EventHandler {
+		return HandlerFunc(func(event Event) (recast *Event) {
+			defer func() {
+				if err := recover(); err != nil {
+					DefaultLogger().With(event.Fields()).With(Fields{"panic": err}).Error("handler panicked")
+
+					if event.Player != nil {
+						event.Reply(ErrorMessage(NewProtocolError(Internal, "Could not process event")))
+					}
+					recast = nil
+				}
+			}()
+
+			return next.Process(event)
+		})
+	}
+}
+
+// Reports how long the handler took with each event
+func Timing(observe func(event Event, elapsed time.Duration)) Middleware {
+	return func(next EventHandler) EventHandler {
+		return HandlerFunc(func(event Event) *Event {
+			start := time.Now()
+			defer func() {
+				observe(event, time.Since(start))
+			}()
+
+			return next.Process(event)
+		})
+	}
+}
+
+// Timing observer logging events slower than threshold
+func LogSlowEvents(threshold time.Duration) func(event Event, elapsed time.Duration) {
+	return func(event Event, elapsed time.Duration) {
+		if elapsed >= threshold {
+			DefaultLogger().With(event.Fields()).With(Fields{"elapsed": elapsed}).Warn("slow event")
+		}
+	}
+}
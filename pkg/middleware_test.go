@@ -0,0 +1,117 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Records when it is entered and left
+func Trace(name string, trace *[]string) Middleware {
+	return func(next EventHandler) EventHandler {
+		return HandlerFunc(func(event Event) *Event {
+			*trace = append(*trace, name+" in")
+			defer func() {
+				*trace = append(*trace, name+" out")
+			}()
+			return next.Process(event)
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Run("chain", func(t *testing.T) {
+		trace := []string{}
+		handler := HandlerFunc(func(event Event) *Event {
+			trace = append(trace, "handler")
+			return &Event{Type: CreateMatch}
+		})
+
+		chain := Chain(Trace("first", &trace), Trace("second", &trace))
+		next := chain(handler).Process(Event{Type: QueueUp})
+
+		if next == nil || next.Type != CreateMatch {
+			t.Errorf("Expected %v, got %v", CreateMatch, next)
+		}
+
+		expected := []string{"first in", "second in", "handler", "second out", "first out"}
+		if !reflect.DeepEqual(expected, trace) {
+			t.Errorf("Expected %v, got %v", expected, trace)
+		}
+	})
+
+	t.Run("recovery", func(t *testing.T) {
+		socket := NewTestSocket()
+		handler := Recovery()(PanicHandler{})
+
+		if next := handler.Process(Event{Type: EndTurn, Player: socket}); next != nil {
+			t.Errorf("Expected no event, got %v", next)
+		}
+
+		response := <-socket.Outgoing
+		if payload := response.Payload.(*ProtocolError); payload.Code != Internal {
+			t.Errorf("Expected %v, got %v", Internal, payload.Code)
+		}
+	})
+
+	t.Run("timing", func(t *testing.T) {
+		var observed time.Duration
+		var observedType EventType
+
+		handler := Timing(func(event Event, elapsed time.Duration) {
+			observedType = event.Type
+			observed = elapsed
+		})(HandlerFunc(func(event Event) *Event {
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		}))
+
+		handler.Process(Event{Type: PlayCard})
+
+		if observedType != PlayCard {
+			t.Errorf("Expected %v, got %v", PlayCard, observedType)
+		}
+		if observed < 10*time.Millisecond {
+			t.Errorf("Expected at least %v, got %v", 10*time.Millisecond, observed)
+		}
+	})
+
+	t.Run("wraps server handlers", func(t *testing.T) {
+		trace := []string{}
+		server := NewServer()
+		socket := NewTestSocket()
+
+		// stops events from sockets without a session
+		server.Use(func(next EventHandler) EventHandler {
+			return HandlerFunc(func(event Event) *Event {
+				if event.Player.Session == uuid.Nil {
+					event.Reply(ErrorMessage(NewProtocolError(SessionMismatch, "No session")))
+					return nil
+				}
+				return next.Process(event)
+			})
+		})
+		server.Use(Trace("trace", &trace))
+		server.RegisterHandler(NewQueueManager())
+
+		server.ProcessEvent(Event{Type: QueueUp, Player: socket})
+		if response := <-socket.Outgoing; response.Type != WaitForMatch {
+			t.Errorf("Expected %v, got %v", WaitForMatch, response.Type)
+		}
+
+		anonymous := NewTestSocket()
+		anonymous.Session = uuid.Nil
+
+		server.ProcessEvent(Event{Type: QueueUp, Player: anonymous})
+		if response := <-anonymous.Outgoing; response.Type != Error {
+			t.Errorf("Expected %v, got %v", Error, response.Type)
+		}
+
+		expected := []string{"trace in", "trace out"}
+		if !reflect.DeepEqual(expected, trace) {
+			t.Errorf("Expected %v, got %v", expected, trace)
+		}
+	})
+}
@@ -0,0 +1,303 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+var ErrInvalidMsgpack = errors.New("Invalid msgpack data")
+
+// Encodes v as MessagePack. Values go through their JSON representation
+// first, so field names and shapes are exactly the same as in JSON
+func MarshalMsgpack(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	if err := encodeMsgpack(&buffer, value); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Decodes MessagePack data into v, following v's JSON decoding rules
+func UnmarshalMsgpack(data []byte, v interface{}) error {
+	decoder := &msgpackDecoder{data: data}
+
+	value, err := decoder.decode()
+	if err != nil {
+		return err
+	}
+	if decoder.pos != len(data) {
+		return ErrInvalidMsgpack
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, v)
+}
+
+func encodeMsgpack(buffer *bytes.Buffer, value interface{}) error {
+	switch value := value.(type) {
+	case nil:
+		buffer.WriteByte(0xc0)
+	case bool:
+		if value {
+			buffer.WriteByte(0xc3)
+		} else {
+			buffer.WriteByte(0xc2)
+		}
+	case json.Number:
+		if integer, err := value.Int64(); err == nil {
+			encodeInt(buffer, integer)
+		} else if unsigned, err := strconv.ParseUint(string(value), 10, 64); err == nil {
+			buffer.WriteByte(0xcf)
+			binary.Write(buffer, binary.BigEndian, unsigned)
+		} else if float, err := value.Float64(); err == nil {
+			buffer.WriteByte(0xcb)
+			binary.Write(buffer, binary.BigEndian, float)
+		} else {
+			return err
+		}
+	case string:
+		encodeLength(buffer, len(value), 0xa0, 31, 0xd9, 0xda, 0xdb)
+		buffer.WriteString(value)
+	case []interface{}:
+		encodeLength(buffer, len(value), 0x90, 15, 0, 0xdc, 0xdd)
+		for _, item := range value {
+			if err := encodeMsgpack(buffer, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		// sorted keys keep the encoding deterministic
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		encodeLength(buffer, len(value), 0x80, 15, 0, 0xde, 0xdf)
+		for _, key := range keys {
+			encodeMsgpack(buffer, key)
+			if err := encodeMsgpack(buffer, value[key]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cannot encode %T as msgpack", value)
+	}
+	return nil
+}
+
+func encodeInt(buffer *bytes.Buffer, value int64) {
+	switch {
+	case value >= 0 && value <= 127:
+		buffer.WriteByte(byte(value))
+	case value < 0 && value >= -32:
+		buffer.WriteByte(byte(int8(value)))
+	case value >= math.MinInt8 && value <= math.MaxInt8:
+		buffer.WriteByte(0xd0)
+		buffer.WriteByte(byte(int8(value)))
+	case value >= math.MinInt16 && value <= math.MaxInt16:
+		buffer.WriteByte(0xd1)
+		binary.Write(buffer, binary.BigEndian, int16(value))
+	case value >= math.MinInt32 && value <= math.MaxInt32:
+		buffer.WriteByte(0xd2)
+		binary.Write(buffer, binary.BigEndian, int32(value))
+	default:
+		buffer.WriteByte(0xd3)
+		binary.Write(buffer, binary.BigEndian, value)
+	}
+}
+
+// Writes a fixed size header if length fits, otherwise the smallest of the
+// 8, 16 or 32 bits headers, a zero header means that size doesn't exist
+func encodeLength(buffer *bytes.Buffer, length int, fixed byte, maxFixed int, header8, header16, header32 byte) {
+	switch {
+	case length <= maxFixed:
+		buffer.WriteByte(fixed | byte(length))
+	case header8 != 0 && length <= math.MaxUint8:
+		buffer.WriteByte(header8)
+		buffer.WriteByte(byte(length))
+	case length <= math.MaxUint16:
+		buffer.WriteByte(header16)
+		binary.Write(buffer, binary.BigEndian, uint16(length))
+	default:
+		buffer.WriteByte(header32)
+		binary.Write(buffer, binary.BigEndian, uint32(length))
+	}
+}
+
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *msgpackDecoder) read(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.data) {
+		return nil, ErrInvalidMsgpack
+	}
+	bytes := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return bytes, nil
+}
+
+func (d *msgpackDecoder) uint(size int) (uint64, error) {
+	bytes, err := d.read(size)
+	if err != nil {
+		return 0, err
+	}
+
+	var value uint64
+	for _, b := range bytes {
+		value = value<<8 | uint64(b)
+	}
+	return value, nil
+}
+
+func (d *msgpackDecoder) decode() (interface{}, error) {
+	header, err := d.read(1)
+	if err != nil {
+		return nil, err
+	}
+	b := header[0]
+
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xe0 == 0xa0:
+		return d.string(int(b & 0x1f))
+	case b&0xf0 == 0x90:
+		return d.array(int(b & 0x0f))
+	case b&0xf0 == 0x80:
+		return d.object(int(b & 0x0f))
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xca:
+		bits, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(bits))), err
+	case 0xcb:
+		bits, err := d.uint(8)
+		return math.Float64frombits(bits), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		value, err := d.uint(1 << (b - 0xcc))
+		return value, err
+	case 0xd0:
+		value, err := d.uint(1)
+		return int64(int8(value)), err
+	case 0xd1:
+		value, err := d.uint(2)
+		return int64(int16(value)), err
+	case 0xd2:
+		value, err := d.uint(4)
+		return int64(int32(value)), err
+	case 0xd3:
+		value, err := d.uint(8)
+		return int64(value), err
+	case 0xd9, 0xda, 0xdb:
+		length, err := d.uint(1 << (b - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.string(int(length))
+	case 0xc4, 0xc5, 0xc6:
+		// binary data is read as a string, json has nothing better
+		length, err := d.uint(1 << (b - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return d.string(int(length))
+	case 0xdc, 0xdd:
+		length, err := d.uint(2 << (b - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(int(length))
+	case 0xde, 0xdf:
+		length, err := d.uint(2 << (b - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.object(int(length))
+	}
+
+	return nil, fmt.Errorf("%w: unsupported type 0x%x", ErrInvalidMsgpack, b)
+}
+
+func (d *msgpackDecoder) string(length int) (interface{}, error) {
+	bytes, err := d.read(length)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+func (d *msgpackDecoder) array(length int) (interface{}, error) {
+	// every item takes at least a byte, guards against huge bogus lengths
+	if length > len(d.data)-d.pos {
+		return nil, ErrInvalidMsgpack
+	}
+
+	items := make([]interface{}, length)
+	for i := range items {
+		item, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		items[i] = item
+	}
+	return items, nil
+}
+
+func (d *msgpackDecoder) object(length int) (interface{}, error) {
+	if length > len(d.data)-d.pos {
+		return nil, ErrInvalidMsgpack
+	}
+
+	object := make(map[string]interface{}, length)
+	for i := 0; i < length; i++ {
+		key, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		name, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: map keys must be strings", ErrInvalidMsgpack)
+		}
+
+		value, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		object[name] = value
+	}
+	return object, nil
+}
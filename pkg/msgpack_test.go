@@ -0,0 +1,320 @@
+package pkg
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Decodes data with codec into generic values, for comparing encodings
+func DecodeGeneric(t *testing.T, codec Codec, data []byte) interface{} {
+	var value interface{}
+	if err := codec.Unmarshal(data, &value); err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestMsgpack(t *testing.T) {
+	player := NewPlayer(NewTestSocket())
+	minion := NewMinion(NewCard("Minion", 1, 2, 3))
+	spell := NewSpell("Spell", 2, nil)
+	hand := []Card{NewCard("Card", 3, 4, 5), spell}
+	ids := []uuid.UUID{uuid.New(), uuid.New()}
+	deadline := time.Date(2022, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	player.Hand.Add(hand[0])
+	player.Board.Place(minion)
+	state := StateView{Players: []PlayerView{player.View(true), player.View(false)}}
+
+	responses := []Response{
+		{Type: Error, Payload: "legacy error"},
+		{Type: Error, Payload: NewProtocolError(InvalidPayload, "Invalid payload", ids...), RequestId: "req-1"},
+		{Type: Success},
+		{Type: WaitForMatch},
+		{Type: ConfirmMatch, Payload: ids[0]},
+		{Type: MatchCanceled, Payload: ids[0]},
+		{Type: WaitOtherPlayers, Payload: hand},
+		{Type: StartingHand, Payload: StartingHandPayload{GameId: ids[0], Duration: time.Minute, Hand: hand}},
+		{Type: StartTurn, Payload: TurnPayload{
+			PlayerId: player.Id,
+			Mana:     7,
+			Board:    map[uuid.UUID]*ActiveMinion{minion.Id: minion},
+			Duration: 75 * time.Second,
+			Cards:    hand,
+		}},
+		{Type: WaitTurn, Payload: TurnPayload{OpponentId: player.Id, Mana: 3, CardsInHand: 4}},
+		{Type: CardPlayed, Payload: minion},
+		{Type: CardPlayed, Payload: spell},
+		{Type: MinionDamageTaken, Payload: MinionDamagedPayload{Attacker: minion, Defender: minion.Snapshot()}},
+		{Type: MinionDestroyed, Payload: minion},
+		{Type: ManaChanged, Payload: player},
+		{Type: AttributeChanged, Payload: minion},
+		{Type: PlayerDamageTaken, Payload: PlayerDamagedPayload{Player: player, Attacker: minion}},
+		{Type: Win},
+		{Type: Loss},
+		{Type: SessionStarted, Payload: SessionPayload{SessionId: ids[0], Token: "token", ExpiresAt: deadline}},
+		{Type: Welcome, Payload: HelloPayload{Version: PROTOCOL_VERSION, Build: "1.2.3", Features: []Feature{SessionResume, ErrorCodes}}},
+		{Type: ServerShutdown, Payload: ShutdownPayload{Reason: MAINTENANCE_SHUTDOWN, Deadline: deadline}},
+		{Type: StateDiff, Payload: StateDiffPayload{GameId: ids[0], Version: 2, Changes: DiffState(StateView{}, state)}},
+		{Type: FullState, Payload: StatePayload{GameId: ids[0], Version: 3, State: state}},
+		{Type: Resumed, Payload: ResumedPayload{GameId: ids[0], LastSeq: 1 << 33, Replayed: true}},
+		{Type: WaitTurn, Payload: TurnPayload{OpponentId: player.Id}, Seq: 1<<64 - 1},
+	}
+
+	t.Run("round trips every response", func(t *testing.T) {
+		for _, response := range responses {
+			encoded, err := MarshalMsgpack(response)
+			if err != nil {
+				t.Fatalf("Could not encode %v: %v", response.Type, err)
+			}
+			jsonEncoded, _ := json.Marshal(response)
+
+			got := DecodeGeneric(t, MsgpackCodec{}, encoded)
+			expected := DecodeGeneric(t, JSONCodec{}, jsonEncoded)
+
+			if !reflect.DeepEqual(expected, got) {
+				t.Errorf("Expected %v, got %v", expected, got)
+			}
+		}
+	})
+
+	t.Run("round trips typed payloads", func(t *testing.T) {
+		payloads := []interface{}{
+			&SessionPayload{SessionId: ids[0], Token: "token", ExpiresAt: deadline},
+			&HelloPayload{Version: PROTOCOL_VERSION, Features: []Feature{RequestIds}},
+			&ProtocolError{Code: NotYourTurn, Message: "Not your turn", Ids: ids},
+			&ShutdownPayload{Reason: MAINTENANCE_SHUTDOWN, Deadline: deadline},
+			&StreamPayload{SocketId: ids[0], Events: "/events/" + ids[0].String()},
+			&CardDiscardedPayload{GameId: ids[0].String(), Cards: []string{ids[1].String()}},
+			&PlayCardPayload{GameId: ids[0].String(), CardId: ids[1].String()},
+			&CombatPayload{GameId: ids[0].String(), Attacker: ids[1].String(), Defender: ids[0].String()},
+			&ResumePayload{GameId: ids[0].String(), LastSeq: 7},
+			&ResumedPayload{GameId: ids[0], LastSeq: 1<<64 - 1, Replayed: true},
+		}
+
+		for _, payload := range payloads {
+			encoded, err := MarshalMsgpack(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decoded := reflect.New(reflect.TypeOf(payload).Elem()).Interface()
+			if err := UnmarshalMsgpack(encoded, decoded); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(payload, decoded) {
+				t.Errorf("Expected %v, got %v", payload, decoded)
+			}
+		}
+	})
+
+	t.Run("round trips every event", func(t *testing.T) {
+		payloads := map[EventType]interface{}{
+			Hello:          map[string]interface{}{"version": PROTOCOL_VERSION, "features": []string{"request_ids"}},
+			QueueUp:        map[string]interface{}{},
+			Dequeue:        nil,
+			MatchConfirmed: ids[0].String(),
+			MatchDeclined:  ids[0].String(),
+			CardDiscarded:  map[string]interface{}{"GameId": ids[0].String(), "Cards": []string{ids[1].String()}},
+			EndTurn:        ids[0].String(),
+			PlayCard:       map[string]interface{}{"GameId": ids[0].String(), "CardId": ids[1].String()},
+			Attack:         map[string]interface{}{"GameId": ids[0].String(), "Attacker": ids[1].String(), "Defender": ids[0].String()},
+			AttackPlayer:   map[string]interface{}{"GameId": ids[0].String(), "Attacker": ids[1].String(), "Defender": ids[0].String()},
+			Reconnected:    ids[0].String(),
+			RequestState:   ids[0].String(),
+			Resume:         map[string]interface{}{"GameId": ids[0].String(), "LastSeq": 42},
+		}
+
+		for eventType := range schemas {
+			message := map[string]interface{}{
+				"type":       eventType,
+				"payload":    payloads[eventType],
+				"request_id": "req-1",
+			}
+
+			var expected, got Event
+			jsonEncoded, _ := json.Marshal(message)
+			json.Unmarshal(jsonEncoded, &expected)
+
+			encoded, err := MarshalMsgpack(message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := UnmarshalMsgpack(encoded, &got); err != nil {
+				t.Fatal(err)
+			}
+
+			expected, err = DecodeEvent(expected)
+			if err != nil {
+				t.Fatalf("Expected valid %v event, got %v", eventType, err)
+			}
+			got, err = DecodeEvent(got)
+			if err != nil {
+				t.Fatalf("Expected valid %v event, got %v", eventType, err)
+			}
+
+			if !reflect.DeepEqual(expected, got) {
+				t.Errorf("Expected %v, got %v", expected, got)
+			}
+		}
+	})
+
+	t.Run("encodes every size", func(t *testing.T) {
+		values := []interface{}{
+			0, 1, 127, 128, 255, 256, 65535, 65536, 1 << 40,
+			-1, -32, -33, -128, -129, -32768, -32769, -(1 << 40),
+			1.5, -0.25, true, false, nil,
+			"", strings.Repeat("a", 31), strings.Repeat("b", 32), strings.Repeat("c", 256), strings.Repeat("d", 65536),
+			make([]int, 15), make([]int, 16), make([]int, 65536),
+			map[string]int{"a": 1},
+		}
+
+		big := map[string]int{}
+		for i := 0; i < 20; i++ {
+			big[strings.Repeat("k", i+1)] = i
+		}
+		values = append(values, big)
+
+		for _, value := range values {
+			encoded, err := MarshalMsgpack(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			jsonEncoded, _ := json.Marshal(value)
+
+			expected := DecodeGeneric(t, JSONCodec{}, jsonEncoded)
+			if got := DecodeGeneric(t, MsgpackCodec{}, encoded); !reflect.DeepEqual(expected, got) {
+				t.Errorf("Expected %v, got %v", expected, got)
+			}
+		}
+	})
+
+	t.Run("is smaller than json", func(t *testing.T) {
+		response := responses[8]
+		encoded, _ := MarshalMsgpack(response)
+		jsonEncoded, _ := json.Marshal(response)
+
+		if len(encoded) >= len(jsonEncoded) {
+			t.Errorf("Expected less than %v bytes, got %v", len(jsonEncoded), len(encoded))
+		}
+	})
+
+	t.Run("rejects invalid data", func(t *testing.T) {
+		encoded, _ := MarshalMsgpack(responses[8])
+
+		invalid := [][]byte{
+			{},
+			encoded[:len(encoded)-1],
+			append(encoded, 0x00),
+			{0x81, 0x01, 0x01},       // non string key
+			{0xdd, 0xff, 0xff, 0xff}, // huge array with no items
+			{0xc1},                   // never used
+		}
+
+		for _, data := range invalid {
+			var value interface{}
+			if err := UnmarshalMsgpack(data, &value); err == nil {
+				t.Errorf("Expected error for %x", data)
+			}
+		}
+	})
+
+	t.Run("parses codec", func(t *testing.T) {
+		for name, expected := range map[string]string{"": JSON_ENCODING, "json": JSON_ENCODING, "msgpack": MSGPACK_ENCODING} {
+			codec, err := ParseCodec(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if codec.Name() != expected {
+				t.Errorf("Expected %v, got %v", expected, codec.Name())
+			}
+		}
+
+		if _, err := ParseCodec("xml"); err == nil {
+			t.Error("Expected error for unsupported encoding")
+		}
+	})
+
+	t.Run("connects with msgpack", func(t *testing.T) {
+		server := NewServer()
+		server.RegisterHandler(NewQueueManager())
+
+		listener := httptest.NewServer(server.Handler())
+		defer listener.Close()
+
+		url := "ws" + strings.TrimPrefix(listener.URL, "http")
+		socket, _, err := websocket.DefaultDialer.Dial(url+"?encoding=msgpack", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer socket.Close()
+
+		read := func() map[string]interface{} {
+			messageType, data, err := socket.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if messageType != websocket.BinaryMessage {
+				t.Errorf("Expected %v, got %v", websocket.BinaryMessage, messageType)
+			}
+
+			var response map[string]interface{}
+			if err := UnmarshalMsgpack(data, &response); err != nil {
+				t.Fatal(err)
+			}
+			return response
+		}
+		write := func(event map[string]interface{}) {
+			data, _ := MarshalMsgpack(event)
+			socket.WriteMessage(websocket.BinaryMessage, data)
+		}
+
+		if response := read(); response["type"] != string(SessionStarted) {
+			t.Errorf("Expected %v, got %v", SessionStarted, response["type"])
+		}
+
+		write(map[string]interface{}{"type": Hello, "payload": map[string]interface{}{"version": PROTOCOL_VERSION}})
+		if response := read(); response["type"] != string(Welcome) {
+			t.Errorf("Expected %v, got %v", Welcome, response["type"])
+		}
+
+		write(map[string]interface{}{"type": QueueUp, "request_id": "queue-1"})
+		response := read()
+		if response["type"] != string(WaitForMatch) {
+			t.Errorf("Expected %v, got %v", WaitForMatch, response["type"])
+		}
+	})
+
+	t.Run("rejects unsupported encodings", func(t *testing.T) {
+		server := NewServer()
+		listener := httptest.NewServer(server.Handler())
+		defer listener.Close()
+
+		url := "ws" + strings.TrimPrefix(listener.URL, "http")
+		_, res, err := websocket.DefaultDialer.Dial(url+"?encoding=xml", nil)
+		if err == nil {
+			t.Fatal("Expected connection to fail")
+		}
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %v, got %v", http.StatusBadRequest, res.StatusCode)
+		}
+
+		// streams are text only
+		res, err = http.Get(listener.URL + "/events?encoding=msgpack")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %v, got %v", http.StatusBadRequest, res.StatusCode)
+		}
+	})
+}
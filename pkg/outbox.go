@@ -0,0 +1,148 @@
+package pkg
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// SlowConsumerPolicy decides what happens when a client doesn't read its
+// messages fast enough and its outbox fills up
+type SlowConsumerPolicy string
+
+const (
+	// Discards new messages while the outbox is full
+	DropMessages SlowConsumerPolicy = "drop"
+	// Replaces pending state updates of the same entity with the newest
+	// one, disconnecting if there is nothing left to coalesce
+	CoalesceUpdates SlowConsumerPolicy = "coalesce"
+	// Disconnects the client as soon as the outbox is full
+	DisconnectClient SlowConsumerPolicy = "disconnect"
+)
+
+type OutboxStats struct {
+	Depth     int    `json:"depth"`
+	Peak      int    `json:"peak"`
+	Sent      uint64 `json:"sent"`
+	Dropped   uint64 `json:"dropped"`
+	Coalesced uint64 `json:"coalesced"`
+}
+
+// Outbox is a bounded, ordered queue of messages waiting to be written to
+// a client
+type Outbox struct {
+	mutex   *sync.Mutex
+	pending *list.List
+	size    int
+	policy  SlowConsumerPolicy
+	ready   chan struct{}
+	stats   OutboxStats
+}
+
+func NewOutbox(size int, policy SlowConsumerPolicy) *Outbox {
+	return &Outbox{
+		mutex:   new(sync.Mutex),
+		pending: list.New(),
+		size:    size,
+		policy:  policy,
+		ready:   make(chan struct{}, 1),
+	}
+}
+
+// Queues a message, returns false if the client should be disconnected
+// because it cannot keep up
+func (o *Outbox) Push(message Response) bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.policy == CoalesceUpdates {
+		o.coalesce(message)
+	}
+
+	if o.pending.Len() >= o.size {
+		if o.policy == DropMessages {
+			o.stats.Dropped++
+			return true
+		}
+		return false
+	}
+
+	o.pending.PushBack(message)
+	if o.pending.Len() > o.stats.Peak {
+		o.stats.Peak = o.pending.Len()
+	}
+
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Removes the oldest pending message
+func (o *Outbox) Pop() (Response, bool) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	front := o.pending.Front()
+	if front == nil {
+		return Response{}, false
+	}
+	o.stats.Sent++
+	return o.pending.Remove(front).(Response), true
+}
+
+// Signals when messages are waiting to be popped
+func (o *Outbox) Ready() <-chan struct{} {
+	return o.ready
+}
+
+func (o *Outbox) Stats() OutboxStats {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	stats := o.stats
+	stats.Depth = o.pending.Len()
+	return stats
+}
+
+// Drops a pending update superseded by message, the newest one is queued
+// at the back so ordering with other messages is kept
+func (o *Outbox) coalesce(message Response) {
+	key := coalesceKey(message)
+	if key == "" {
+		return
+	}
+	for cur := o.pending.Front(); cur != nil; cur = cur.Next() {
+		if coalesceKey(cur.Value.(Response)) == key {
+			o.pending.Remove(cur)
+			o.stats.Coalesced++
+			return
+		}
+	}
+}
+
+// Identifies state updates that only matter in their latest version,
+// other messages cannot be coalesced
+func coalesceKey(message Response) string {
+	var id uuid.UUID
+
+	switch payload := message.Payload.(type) {
+	case *ActiveMinion:
+		if message.Type != AttributeChanged {
+			return ""
+		}
+		id = payload.Id
+	case *Player:
+		if message.Type != ManaChanged {
+			return ""
+		}
+		id = payload.Id
+	default:
+		return ""
+	}
+
+	return fmt.Sprintf("%v:%v", message.Type, id)
+}
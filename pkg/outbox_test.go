@@ -0,0 +1,118 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestOutbox(t *testing.T) {
+	t.Run("keeps order", func(t *testing.T) {
+		outbox := NewOutbox(3, DisconnectClient)
+
+		outbox.Push(Response{Type: StartTurn})
+		outbox.Push(Response{Type: CardPlayed})
+		outbox.Push(Response{Type: WaitTurn})
+
+		for _, expected := range []ResponseType{StartTurn, CardPlayed, WaitTurn} {
+			response, ok := outbox.Pop()
+			if !ok {
+				t.Fatal("Expected pending message")
+			}
+			if response.Type != expected {
+				t.Errorf("Expected %v, got %v", expected, response.Type)
+			}
+		}
+
+		if _, ok := outbox.Pop(); ok {
+			t.Error("Expected empty outbox")
+		}
+	})
+
+	t.Run("disconnects when full", func(t *testing.T) {
+		outbox := NewOutbox(1, DisconnectClient)
+
+		if !outbox.Push(Response{Type: StartTurn}) {
+			t.Error("Should accept message")
+		}
+		if outbox.Push(Response{Type: WaitTurn}) {
+			t.Error("Should ask to disconnect")
+		}
+	})
+
+	t.Run("drops when full", func(t *testing.T) {
+		outbox := NewOutbox(1, DropMessages)
+
+		outbox.Push(Response{Type: StartTurn})
+		if !outbox.Push(Response{Type: WaitTurn}) {
+			t.Error("Should not ask to disconnect")
+		}
+
+		stats := outbox.Stats()
+		if stats.Dropped != 1 {
+			t.Errorf("Expected %v dropped, got %v", 1, stats.Dropped)
+		}
+		if stats.Depth != 1 {
+			t.Errorf("Expected %v depth, got %v", 1, stats.Depth)
+		}
+	})
+
+	t.Run("coalesces updates", func(t *testing.T) {
+		outbox := NewOutbox(2, CoalesceUpdates)
+
+		minion := NewMinion(NewCard("", 1, 1, 1))
+		stale := minion.Snapshot()
+		minion.SetState(Active{})
+
+		outbox.Push(Response{Type: AttributeChanged, Payload: stale})
+		outbox.Push(Response{Type: StartTurn})
+		if !outbox.Push(Response{Type: AttributeChanged, Payload: minion}) {
+			t.Fatal("Should coalesce instead of disconnecting")
+		}
+
+		response, _ := outbox.Pop()
+		if response.Type != StartTurn {
+			t.Errorf("Expected %v, got %v", StartTurn, response.Type)
+		}
+
+		response, _ = outbox.Pop()
+		if response.Payload.(*ActiveMinion) != minion {
+			t.Error("Expected latest update")
+		}
+
+		if outbox.Stats().Coalesced != 1 {
+			t.Errorf("Expected %v coalesced, got %v", 1, outbox.Stats().Coalesced)
+		}
+	})
+
+	t.Run("does not coalesce other entities", func(t *testing.T) {
+		outbox := NewOutbox(1, CoalesceUpdates)
+
+		first := &Player{Id: uuid.New()}
+		second := &Player{Id: uuid.New()}
+
+		outbox.Push(Response{Type: ManaChanged, Payload: first})
+		if outbox.Push(Response{Type: ManaChanged, Payload: second}) {
+			t.Error("Should ask to disconnect")
+		}
+	})
+
+	t.Run("tracks stats", func(t *testing.T) {
+		outbox := NewOutbox(5, DisconnectClient)
+
+		outbox.Push(Response{Type: StartTurn})
+		outbox.Push(Response{Type: WaitTurn})
+		outbox.Pop()
+
+		stats := outbox.Stats()
+		if stats.Peak != 2 {
+			t.Errorf("Expected %v peak, got %v", 2, stats.Peak)
+		}
+		if stats.Sent != 1 {
+			t.Errorf("Expected %v sent, got %v", 1, stats.Sent)
+		}
+		if stats.Depth != 1 {
+			t.Errorf("Expected %v depth, got %v", 1, stats.Depth)
+		}
+	})
+}
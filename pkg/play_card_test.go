@@ -38,8 +38,8 @@ func TestPlayCard(t *testing.T) {
 	<-p1.Outgoing // start turn
 	<-p2.Outgoing // wait turn
 
-	// make sure it can get played
-	played := payload.Hand[0].(*Minion)
+	// make sure it can get played, messages carry copies of the cards in hand
+	played := game.players[p1].Hand.Find(payload.Hand[0].GetId()).(*Minion)
 	played.Mana = 1
 
 	// play a card
@@ -95,22 +95,19 @@ func TestNotEnoughMana(t *testing.T) {
 	<-p2.Outgoing // wait turn
 
 	// play a card with mana > 1
-	played := payload.Hand[0].(*Minion)
+	played := game.players[p1].Hand.Find(payload.Hand[0].GetId()).(*Minion)
 	played.Mana = 5
-	game.PlayCard(played.Id, p1)
+	err := game.PlayCard(played.Id, p1)
 
-	// expect error response
-	select {
-	case <-time.After(100 * time.Millisecond):
-		t.Error("Expected error message")
-	case response := <-p1.Outgoing:
-		if response.Type != Error {
-			t.Errorf("expecetd %v, got %v", Error, response.Type)
-		}
-		payload := response.Payload.(string)
-		if payload != "Not enough mana" {
-			t.Errorf("Expected not enough mana, got %v", payload)
-		}
+	// expect error
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if err.Error() != "Not enough mana" {
+		t.Errorf("Expected not enough mana, got %v", err)
+	}
+	if ErrorCodeOf(err) != NotEnoughMana {
+		t.Errorf("Expected %v code, got %v", NotEnoughMana, ErrorCodeOf(err))
 	}
 
 	card := game.players[p1].Hand.Find(played.GetId())
@@ -140,9 +137,37 @@ func TestCardNotFound(t *testing.T) {
 	// play a nonexisting card for player
 	played := payload.Hand[0].(*Minion)
 	played.Mana = 1
-	game.PlayCard(played.GetId(), p1)
+	err := game.PlayCard(played.GetId(), p1)
+
+	// expect error
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if err.Error() != "Card not found in hand" {
+		t.Errorf("Expected '%v', got '%v'", "Card not found in hand", err)
+	}
+	if ErrorCodeOf(err) != CardNotFound {
+		t.Errorf("Expected %v code, got %v", CardNotFound, ErrorCodeOf(err))
+	}
+}
+
+func TestErrorEchoesRequestId(t *testing.T) {
+	manager := NewGameManager(time.Second)
+
+	p1 := NewTestSocket()
+	p2 := NewTestSocket()
+
+	game := manager.CreateGame([]*Socket{p1, p2})
+	game.StartTurn()
+
+	<-p1.Outgoing // start turn
+	<-p2.Outgoing // wait turn
+
+	// play a card that is not in hand
+	event := PlayCardEvent(p1, game.Id, uuid.New())
+	event.RequestId = "req-42"
+	manager.Process(event)
 
-	// expect error response
 	select {
 	case <-time.After(100 * time.Millisecond):
 		t.Error("Expected error message")
@@ -150,9 +175,74 @@ func TestCardNotFound(t *testing.T) {
 		if response.Type != Error {
 			t.Errorf("expecetd %v, got %v", Error, response.Type)
 		}
-		payload := response.Payload.(string)
-		if payload != "Card not found in hand" {
-			t.Errorf("Expected '%v', got '%v'", "Card not found in hand", payload)
+		if response.RequestId != event.RequestId {
+			t.Errorf("Expected %v request id, got %v", event.RequestId, response.RequestId)
+		}
+		payload := response.Payload.(*ProtocolError)
+		if payload.Code != CardNotFound {
+			t.Errorf("Expected %v code, got %v", CardNotFound, payload.Code)
+		}
+	}
+}
+
+func TestNotYourTurn(t *testing.T) {
+	manager := NewGameManager(time.Second)
+
+	p1 := NewTestSocket()
+	p2 := NewTestSocket()
+
+	game := manager.CreateGame([]*Socket{p1, p2})
+	game.StartTurn()
+
+	<-p1.Outgoing // start turn
+	<-p2.Outgoing // wait turn
+
+	if err := game.PlayCard(uuid.New(), p2); ErrorCodeOf(err) != NotYourTurn {
+		t.Errorf("Expected %v, got %v", NotYourTurn, err)
+	}
+
+	// ending someone else's turn is rejected
+	manager.Process(Event{Type: EndTurn, Player: p2, Payload: IdPayload(game.Id.String())})
+
+	select {
+	case <-time.After(100 * time.Millisecond):
+		t.Error("Expected error message")
+	case response := <-p2.Outgoing:
+		if response.Type != Error {
+			t.Fatalf("Expected %v, got %v", Error, response.Type)
+		}
+		if code := response.Payload.(*ProtocolError).Code; code != NotYourTurn {
+			t.Errorf("Expected %v, got %v", NotYourTurn, code)
+		}
+	}
+
+	if !game.IsCurrent(p1) {
+		t.Error("Expected turn to remain with first player")
+	}
+}
+
+func TestInvalidIds(t *testing.T) {
+	manager := NewGameManager(time.Second)
+	player := NewTestSocket()
+
+	events := []Event{
+		{Type: PlayCard, Player: player, Payload: PlayCardPayload{GameId: "nope", CardId: "nope"}},
+		{Type: PlayCard, Player: player, Payload: PlayCardPayload{GameId: uuid.NewString(), CardId: uuid.NewString()}},
+		{Type: Attack, Player: player, Payload: CombatPayload{GameId: "nope"}},
+		{Type: EndTurn, Player: player, Payload: IdPayload("nope")},
+	}
+	codes := []ErrorCode{InvalidPayload, GameNotFound, InvalidPayload, InvalidPayload}
+
+	for i, event := range events {
+		manager.Process(event)
+
+		select {
+		case <-time.After(100 * time.Millisecond):
+			t.Errorf("Expected error message for %v", event.Type)
+		case response := <-player.Outgoing:
+			if code := response.Payload.(*ProtocolError).Code; code != codes[i] {
+				t.Errorf("Expected %v, got %v", codes[i], code)
+			}
 		}
 	}
 }
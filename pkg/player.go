@@ -2,7 +2,6 @@ package pkg
 
 import (
 	"container/list"
-	"errors"
 	"sync"
 	"time"
 
@@ -20,11 +19,14 @@ type Player struct {
 	Mana    int
 	MaxMana int
 
-	mutex  *sync.Mutex
-	Board  *Board
-	Hand   *Hand
-	deck   *Deck
-	socket *Socket
+	mutex   *sync.Mutex
+	Board   *Board
+	Hand    *Hand
+	deck    *Deck
+	socket  *Socket
+	session uuid.UUID
+	state   *StateTracker
+	journal *Journal
 }
 
 func NewPlayer(socket *Socket) *Player {
@@ -35,11 +37,13 @@ func NewPlayer(socket *Socket) *Player {
 		Mana:    0,
 		Health:  MAX_HEALTH,
 
-		mutex:  new(sync.Mutex),
-		Board:  NewBoard(),
-		deck:   NewDeck(),
-		socket: socket,
-		Hand:   NewHand(list.New()),
+		mutex:   new(sync.Mutex),
+		Board:   NewBoard(),
+		deck:    NewDeck(),
+		socket:  socket,
+		session: socket.Session,
+		journal: NewJournal(REPLAY_BUFFER),
+		Hand:    NewHand(list.New()),
 	}
 }
 
@@ -57,8 +61,54 @@ func (p *Player) DrawCards(qty int) []Card {
 	return out
 }
 
+// Copies what clients see of the player as it is now, messages wait in
+// the outbox while the game goes on
+func (p *Player) Copy() *Player {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return &Player{
+		Id: p.Id,
+
+		Health:  p.Health,
+		Mana:    p.Mana,
+		MaxMana: p.MaxMana,
+
+		mutex: new(sync.Mutex),
+		Board: p.Board.Snapshot(),
+		Hand:  p.Hand.Snapshot(),
+	}
+}
+
+// Checks if socket belongs to the same identity this player was created for
+func (p *Player) OwnedBy(socket *Socket) bool {
+	return p.session == socket.Session
+}
+
+// Numbers and keeps every message, so it can be replayed if the player
+// misses it
 func (p *Player) Send(message Response) {
-	p.socket.Send(message)
+	p.socket.Send(p.journal.Record(message))
+}
+
+// Clients which negotiated state diffs follow the game through versioned
+// changes instead of whole boards and minions
+func (p *Player) followsDiffs() bool {
+	return p.state != nil && p.socket.Supports(StateDiffs)
+}
+
+// Sends what changed in the game since the player's last update
+func (p *Player) SyncState() {
+	if p.followsDiffs() {
+		p.state.Sync(p.Send)
+	}
+}
+
+// Sends the whole game state, restarting the player's diffs from it
+func (p *Player) ResyncState() {
+	if p.state != nil {
+		p.state.Resync(p.Send)
+	}
 }
 
 func (p *Player) GetHand() *Hand {
@@ -162,24 +212,33 @@ func (p *Player) CardsOnBoardCount() int {
 func (p *Player) NotifyDamage(event GameEvent) bool {
 	payload := event.GetData().(MinionDamagedPayload)
 	p.Send(Response{
-		Type:    MinionDamageTaken,
-		Payload: payload,
+		Type: MinionDamageTaken,
+		Payload: MinionDamagedPayload{
+			Attacker: payload.Attacker.Snapshot(),
+			Defender: payload.Defender.Snapshot(),
+		},
 	})
+	p.SyncState()
 	return false
 }
 
 func (p *Player) NotifyPlayerDamage(event GameEvent) bool {
 	payload := event.GetData().(PlayerDamagedPayload)
-	go p.Send(Response{
-		Type:    PlayerDamageTaken,
-		Payload: payload,
+	p.Send(Response{
+		Type: PlayerDamageTaken,
+		Payload: PlayerDamagedPayload{
+			Player:   payload.Player.Copy(),
+			Attacker: payload.Attacker.Snapshot(),
+		},
 	})
+	p.SyncState()
 	return false
 }
 
 func (p *Player) NotifyDestroyed(event GameEvent) bool {
 	minion := event.GetData().(*ActiveMinion)
-	go p.Send(MinionDestroyedMessage(minion))
+	p.Send(MinionDestroyedMessage(minion.Snapshot()))
+	p.SyncState()
 	return false
 }
 
@@ -187,32 +246,43 @@ func (p *Player) NotifyCardPlayed(event GameEvent) bool {
 	card := event.GetData()
 
 	if minion, ok := card.(*ActiveMinion); ok {
-		card = minion
+		card = minion.Snapshot()
 	} else if spell, ok := card.(*Spell); ok {
 		card = spell
 	}
 
-	go p.Send(Response{
+	p.Send(Response{
 		Type:    CardPlayed,
 		Payload: card,
 	})
+	p.SyncState()
 	return false
 }
 
 func (p *Player) NotifyManaChanges(event GameEvent) bool {
+	if p.followsDiffs() {
+		p.SyncState()
+		return false
+	}
+
 	player := event.GetData().(*Player)
-	go p.Send(Response{
+	p.Send(Response{
 		Type:    ManaChanged,
-		Payload: player,
+		Payload: player.Copy(),
 	})
 	return false
 }
 
 func (p *Player) NotifyAttributeChanges(event GameEvent) bool {
+	if p.followsDiffs() {
+		p.SyncState()
+		return false
+	}
+
 	minion := event.GetData().(*ActiveMinion)
-	go p.Send(Response{
+	p.Send(Response{
 		Type:    AttributeChanged,
-		Payload: minion,
+		Payload: minion.Snapshot(),
 	})
 	return false
 }
@@ -222,30 +292,35 @@ func (p *Player) NotifyTurnStarted(event GameEvent) bool {
 	player := data["Player"].(*Player)
 	duration := data["Duration"].(time.Duration)
 
+	// board and hand come in the diff that follows
+	diffs := p.followsDiffs()
+
 	if player == p {
-		go p.Send(Response{
-			Type: StartTurn,
-			Payload: TurnPayload{
-				PlayerId:    player.Id,
-				Duration:    duration,
-				Board:       player.Board.Minions,
-				Cards:       player.Hand.GetCards(),
-				Mana:        player.GetMana(),
-				CardsInHand: player.Hand.Length(),
-			},
-		})
+		payload := TurnPayload{
+			PlayerId:    player.Id,
+			Duration:    duration,
+			Mana:        player.GetMana(),
+			CardsInHand: player.Hand.Length(),
+		}
+		if !diffs {
+			payload.Board = player.Board.Snapshot().Minions
+			payload.Cards = SnapshotCards(player.Hand.GetCards())
+		}
+		p.Send(Response{Type: StartTurn, Payload: payload})
 	} else {
-		go p.Send(Response{
-			Type: WaitTurn,
-			Payload: TurnPayload{
-				OpponentId:  player.Id,
-				Mana:        player.GetMana(),
-				Board:       player.Board.Minions,
-				Duration:    duration,
-				CardsInHand: player.Hand.Length(),
-			},
-		})
+		payload := TurnPayload{
+			OpponentId:  player.Id,
+			Mana:        player.GetMana(),
+			Duration:    duration,
+			CardsInHand: player.Hand.Length(),
+		}
+		if !diffs {
+			payload.Board = player.Board.Snapshot().Minions
+		}
+		p.Send(Response{Type: WaitTurn, Payload: payload})
 	}
+
+	p.SyncState()
 	return false
 }
 
@@ -272,9 +347,20 @@ func (b *Board) Remove(minion *ActiveMinion) {
 	delete(b.Minions, minion.Id)
 }
 
+// Copies the board and its minions as they are now
+func (b *Board) Snapshot() *Board {
+	minions := make(map[uuid.UUID]*ActiveMinion)
+	for id, minion := range b.Minions {
+		minions[id] = minion.Snapshot()
+	}
+	return &Board{
+		Minions: minions,
+	}
+}
+
 func (b *Board) Place(card *ActiveMinion) error {
 	if b.MinionsCount() == MAX_MINIONS {
-		return errors.New("Cannot place minion, board is full")
+		return NewProtocolError(BoardFull, "Cannot place minion, board is full", card.Id)
 	}
 	b.Minions[card.Id] = card
 	return nil
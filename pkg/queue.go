@@ -40,6 +40,11 @@ func (q *Queue) Remove(player *Socket) {
 	}
 }
 
+func (q *Queue) Has(player *Socket) bool {
+	_, ok := q.players[player]
+	return ok
+}
+
 func (q *Queue) Length() int {
 	return q.head.Len()
 }
@@ -1,14 +1,33 @@
 package pkg
 
 import (
+	"context"
+	"math"
 	"sync"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 const NUM_OF_PLAYERS = 2
 
+// How often waiting players are matched again, their rating window being
+// wider each time
+const MATCHMAKING_INTERVAL = time.Second
+
 type QueueManager struct {
-	queue *Queue
-	mutex *sync.Mutex
+	store     QueueStore
+	ratings   RatingStore
+	cluster   *Cluster
+	mutex     *sync.Mutex
+	matchSize int
+	rule      MatchRule
+	interval  time.Duration
+	sockets   map[uuid.UUID]*Socket // queued through this manager
+	wait      *Histogram
+	stop      chan struct{}
+	stopped   bool
+	draining  bool
 }
 
 func WaitForMatchMessage() Response {
@@ -18,57 +37,263 @@ func WaitForMatchMessage() Response {
 }
 
 func NewQueueManager() *QueueManager {
+	return NewQueueManagerWithConfig(DefaultConfig())
+}
+
+func NewQueueManagerWithConfig(config Config) *QueueManager {
 	return &QueueManager{
-		queue: NewQueue(),
-		mutex: new(sync.Mutex),
+		store:     NewMemoryStore(),
+		ratings:   DefaultRatings(),
+		mutex:     new(sync.Mutex),
+		matchSize: config.MatchSize,
+		rule:      NewMatchRule(config),
+		interval:  config.MatchmakingInterval,
+		sockets:   make(map[uuid.UUID]*Socket),
+		wait:      NewHistogram("", QUEUE_WAIT_BUCKETS),
+		stop:      make(chan struct{}),
+	}
+}
+
+// Matches players from the cluster's shared pool instead of a private one
+func (q *QueueManager) SetCluster(cluster *Cluster) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.cluster = cluster
+	q.store = cluster.Store()
+	q.ratings = cluster.Store()
+}
+
+// Sets where player ratings are read from, they should be the ones the game
+// manager updates
+func (q *QueueManager) SetRatings(ratings RatingStore) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.ratings = ratings
+}
+
+// Matches waiting players every interval until stopped, as their windows
+// grow players who could not be matched when queueing may be now
+func (q *QueueManager) Matchmake(publish func(event Event)) {
+	ticker := time.NewTicker(q.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for event := q.PrepareMatch(); event.Payload != nil; event = q.PrepareMatch() {
+				publish(event)
+			}
+		case <-q.stop:
+			return
+		}
+	}
+}
+
+func (q *QueueManager) Stop() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if !q.stopped {
+		q.stopped = true
+		close(q.stop)
 	}
 }
 
+// No new matches are made while shutting down, players queued again when
+// their match is cancelled are turned away too
+func (q *QueueManager) Drain(ctx context.Context) error {
+	q.mutex.Lock()
+	q.draining = true
+	q.mutex.Unlock()
+
+	q.Stop()
+	return nil
+}
+
+func (q *QueueManager) Handles() []EventType {
+	return []EventType{QueueUp, Dequeue, Disconnected}
+}
+
 func (q *QueueManager) Process(event Event) *Event {
 	switch event.Type {
 	case QueueUp:
-		q.AddToQueue(event.Player)
+		if err := q.AddToQueue(event.Player); err != nil {
+			event.Reply(ErrorMessage(err))
+			return nil
+		}
+		event.Reply(WaitForMatchMessage())
 
-		if q.InQueueCount() == NUM_OF_PLAYERS {
-			event := q.PrepareMatch()
+		if event := q.PrepareMatch(); event.Payload != nil {
 			return &event
 		}
-	case Dequeue, Disconnected:
+	case Dequeue:
+		if err := q.RemoveFromQueue(event.Player); err != nil {
+			event.Reply(ErrorMessage(err))
+			return nil
+		}
+		event.Reply(Response{Type: Success})
+	case Disconnected:
 		q.RemoveFromQueue(event.Player)
 	}
 	return nil
 }
 
-func (q *QueueManager) AddToQueue(player *Socket) {
+func (q *QueueManager) AddToQueue(player *Socket) error {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
 
-	q.queue.Queue(player)
-	go player.Send(WaitForMatchMessage())
+	if q.draining {
+		return NewProtocolError(ServerShuttingDown, "Server is shutting down")
+	}
+
+	logger := DefaultLogger().With(player.Fields())
+
+	rating, err := q.ratings.Rating(player.Session)
+	if err != nil {
+		logger.With(Fields{"error": err}).Error("could not read rating")
+		rating = DEFAULT_RATING
+	}
+
+	if err := q.store.Enqueue(QueueEntry{Socket: q.remoteOf(player), Joined: time.Now(), Rating: rating}); err != nil {
+		return err
+	}
+
+	q.sockets[player.Id] = player
+	logger.With(Fields{"rating": rating}).Debug("queued")
+	return nil
 }
 
-func (q *QueueManager) RemoveFromQueue(player *Socket) {
+func (q *QueueManager) RemoveFromQueue(player *Socket) error {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
 
-	q.queue.Remove(player)
-	go player.Send(Response{Type: Success})
+	// matched on another instance, the socket may be known here still
+	delete(q.sockets, player.Id)
+
+	if err := q.store.Dequeue(player.Id); err != nil {
+		return err
+	}
+	DefaultLogger().With(player.Fields()).Debug("left queue")
+	return nil
 }
 
+// Takes players close enough in rating for a match, the longest waiting
+// first. The event has no players if nobody can be matched yet
 func (q *QueueManager) PrepareMatch() Event {
-	players := make([]*Socket, NUM_OF_PLAYERS)
-	for i := 0; i < NUM_OF_PLAYERS; i++ {
-		players[i] = q.queue.Dequeue()
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	event := Event{Type: CreateMatch}
+	if q.draining {
+		return event
+	}
+
+	entries, err := q.store.TakeMatch(q.matchSize, q.rule)
+	if err != nil {
+		DefaultLogger().With(Fields{"error": err}).Error("could not take match from queue")
+		return event
 	}
-	return Event{
-		Type:    CreateMatch,
-		Payload: players,
+	if len(entries) == 0 {
+		return event
+	}
+
+	players := make([]*Socket, 0, len(entries))
+	reachable := make([]QueueEntry, 0, len(entries))
+	for _, entry := range entries {
+		player := q.resolve(entry)
+		if player == nil {
+			DefaultLogger().With(Fields{"socket_id": entry.Socket.Id}).Warn("queued player cannot be reached")
+			continue
+		}
+		players = append(players, player)
+		reachable = append(reachable, entry)
+	}
+	if len(players) < len(entries) {
+		q.requeue(reachable, players)
+		return event
+	}
+
+	lowest, highest := entries[0].Rating, entries[0].Rating
+	for _, entry := range entries {
+		q.wait.ObserveDuration("", time.Since(entry.Joined))
+		lowest = math.Min(lowest, entry.Rating)
+		highest = math.Max(highest, entry.Rating)
+	}
+	DefaultLogger().With(Fields{"players": q.matchSize, "spread": highest - lowest}).Debug("match prepared")
+
+	event.Payload = players
+	return event
+}
+
+// How the queue knows player, must be called with the lock held
+func (q *QueueManager) remoteOf(player *Socket) RemoteSocket {
+	if q.cluster != nil {
+		return q.cluster.RemoteOf(player)
 	}
+	return RemoteSocket{Id: player.Id, Session: player.Session, Protocol: player.Protocol(), Features: player.Features()}
 }
 
+// Socket of a queued entry, players queued on other instances are reached
+// through the cluster. Nil if the player can't be reached from here. Must
+// be called with the lock held
+func (q *QueueManager) resolve(entry QueueEntry) *Socket {
+	socket, ok := q.sockets[entry.Socket.Id]
+	delete(q.sockets, entry.Socket.Id)
+
+	if ok && q.remoteOf(socket).Instance == entry.Socket.Instance {
+		return socket
+	}
+	if q.cluster == nil {
+		return nil
+	}
+	return q.cluster.Resolve(entry.Socket)
+}
+
+// Puts players of a match that can't be made back in the queue, keeping
+// when they joined. Must be called with the lock held
+func (q *QueueManager) requeue(entries []QueueEntry, players []*Socket) {
+	for i, entry := range entries {
+		if err := q.store.Enqueue(entry); err != nil {
+			DefaultLogger().With(players[i].Fields()).With(Fields{"error": err}).Error("could not queue again")
+			continue
+		}
+		q.sockets[entry.Socket.Id] = players[i]
+	}
+}
+
+func (q *QueueManager) RegisterMetrics(metrics *Metrics) {
+	metrics.Register("card_server_queue_length", "Players waiting for a match", GaugeFunc(func() float64 {
+		return float64(q.InQueueCount())
+	}))
+	metrics.Register("card_server_queue_wait_seconds", "How long players wait in the queue for a match", q.wait)
+}
+
+// Players waiting for a match, first in line first. Players waiting on
+// other instances are left out
+func (q *QueueManager) Players() []*Socket {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	players := []*Socket{}
+	entries, _ := q.store.Queued()
+	for _, entry := range entries {
+		if socket, ok := q.sockets[entry.Socket.Id]; ok {
+			players = append(players, socket)
+		}
+	}
+	return players
+}
+
+// Players waiting for a match, on every instance
 func (q *QueueManager) InQueueCount() int {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
 
-	return q.queue.Length()
+	entries, err := q.store.Queued()
+	if err != nil {
+		return 0
+	}
+	return len(entries)
 }
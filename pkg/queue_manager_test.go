@@ -1,8 +1,11 @@
 package pkg
 
 import (
+	"context"
 	"testing"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 func QueueUpEvent(player *Socket) Event {
@@ -96,8 +99,6 @@ func TestQueueManager(t *testing.T) {
 		// queue a player
 		manager.AddToQueue(player)
 
-		<-player.Outgoing // skip WaitForMatch response
-
 		// process dequeue event for that player
 		manager.Process(DequeueEvent(player))
 
@@ -133,4 +134,107 @@ func TestQueueManager(t *testing.T) {
 			t.Errorf("Expected empty queue, got %v", manager.InQueueCount())
 		}
 	})
+	t.Run("matches by rating", func(t *testing.T) {
+		config := DefaultConfig()
+		config.RatingWindowGrowth = 1000
+		config.MatchmakingInterval = 10 * time.Millisecond
+		manager := NewQueueManagerWithConfig(config)
+		defer manager.Stop()
+
+		veteran := NewTestSocket()
+		manager.ratings.SetRatings(map[uuid.UUID]float64{veteran.Session: 2000})
+
+		// too far apart to be matched right away
+		manager.Process(QueueUpEvent(NewTestSocket()))
+		if event := manager.Process(QueueUpEvent(veteran)); event != nil {
+			t.Errorf("Expected no match, got %v", event.Type)
+		}
+
+		matches := make(chan Event, 1)
+		go manager.Matchmake(func(event Event) {
+			matches <- event
+		})
+
+		select {
+		case <-time.After(time.Second):
+			t.Error("Expected players to be matched as their window grows")
+		case event := <-matches:
+			if players := event.Payload.([]*Socket); len(players) != 2 || players[1] != veteran {
+				t.Errorf("Expected %v to be matched, got %v", veteran.Id, players)
+			}
+		}
+	})
+
+	t.Run("keeps players it cannot match", func(t *testing.T) {
+		local := NewQueueManager()
+		other := NewQueueManager()
+
+		// sharing a queue without a cluster to reach each other's players
+		other.store = local.store
+
+		player := NewTestSocket()
+		local.AddToQueue(player)
+		other.AddToQueue(NewTestSocket())
+
+		if event := local.PrepareMatch(); event.Payload != nil {
+			t.Errorf("Expected no match, got %v", event.Payload)
+		}
+		if players := local.Players(); len(players) != 1 || players[0] != player {
+			t.Errorf("Expected %v to wait still, got %v", player.Id, players)
+		}
+	})
+
+	t.Run("keeps its place when the other player cannot be reached", func(t *testing.T) {
+		local := NewQueueManager()
+		other := NewQueueManager()
+		other.store = local.store
+
+		other.AddToQueue(NewTestSocket())
+		first := NewTestSocket()
+		local.AddToQueue(first)
+		second := NewTestSocket()
+		local.AddToQueue(second)
+
+		if event := local.PrepareMatch(); event.Payload != nil {
+			t.Errorf("Expected no match, got %v", event.Payload)
+		}
+		if players := local.Players(); len(players) != 2 || players[0] != first || players[1] != second {
+			t.Errorf("Expected %v and %v to wait in order, got %v", first.Id, second.Id, players)
+		}
+	})
+
+	t.Run("drain stops matching", func(t *testing.T) {
+		manager := NewQueueManager()
+		manager.AddToQueue(NewTestSocket())
+		manager.AddToQueue(NewTestSocket())
+
+		if err := manager.Drain(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if event := manager.PrepareMatch(); event.Payload != nil {
+			t.Errorf("Expected no match, got %v", event.Payload)
+		}
+		if err := manager.AddToQueue(NewTestSocket()); ErrorCodeOf(err) != ServerShuttingDown {
+			t.Errorf("Expected %v, got %v", ServerShuttingDown, err)
+		}
+	})
+
+	t.Run("echoes request id", func(t *testing.T) {
+		player := NewTestSocket()
+		manager := NewQueueManager()
+
+		event := DequeueEvent(player)
+		event.RequestId = "dequeue-1"
+		manager.Process(event)
+
+		select {
+		case <-time.After(500 * time.Millisecond):
+			t.Error("Expected confirmation of dequeue")
+		case response := <-player.Outgoing:
+			if response.RequestId != event.RequestId {
+				t.Errorf("Expected %v, got %v", event.RequestId, response.RequestId)
+			}
+		}
+	})
 }
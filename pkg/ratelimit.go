@@ -0,0 +1,157 @@
+package pkg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimit is a token bucket budget, Rate events per second on average
+// with bursts of up to Burst events
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// Parses limits written as rate/burst, like 5/10
+func ParseRateLimit(value string) (RateLimit, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q, expected rate/burst", value)
+	}
+
+	rate, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil || rate <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate in %q", value)
+	}
+	burst, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil || burst < 1 {
+		return RateLimit{}, fmt.Errorf("invalid burst in %q", value)
+	}
+
+	return RateLimit{Rate: rate, Burst: burst}, nil
+}
+
+func (l RateLimit) String() string {
+	return fmt.Sprintf("%v/%v", l.Rate, l.Burst)
+}
+
+// RateLimits are the budgets given to every socket, violations past
+// MaxStrikes within StrikeWindow of each other get the client disconnected
+type RateLimits struct {
+	Overall      RateLimit
+	Events       map[EventType]RateLimit
+	MaxStrikes   int
+	StrikeWindow time.Duration
+}
+
+func DefaultRateLimits() RateLimits {
+	return RateLimits{
+		Overall: RateLimit{Rate: 20, Burst: 40},
+		Events: map[EventType]RateLimit{
+			Hello:        {Rate: 1, Burst: 3},
+			QueueUp:      {Rate: 1, Burst: 5},
+			Dequeue:      {Rate: 1, Burst: 5},
+			PlayCard:     {Rate: 5, Burst: 10},
+			Attack:       {Rate: 5, Burst: 10},
+			AttackPlayer: {Rate: 5, Burst: 10},
+			RequestState: {Rate: 1, Burst: 3},
+		},
+		MaxStrikes:   20,
+		StrikeWindow: 10 * time.Second,
+	}
+}
+
+type TokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+// Creates a full bucket
+func NewTokenBucket(limit RateLimit, now time.Time) *TokenBucket {
+	return &TokenBucket{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   now,
+	}
+}
+
+// Takes a token if there is one available
+func (b *TokenBucket) Allow(now time.Time) bool {
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+		if b.tokens > float64(b.limit.Burst) {
+			b.tokens = float64(b.limit.Burst)
+		}
+		b.last = now
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// RateLimiter throttles the events of a single socket, with a budget for
+// all events and optional budgets per event type. It is only used by the
+// socket's read loop, so it is not safe for concurrent use
+type RateLimiter struct {
+	now     func() time.Time
+	overall *TokenBucket
+	events  map[EventType]*TokenBucket
+
+	maxStrikes  int
+	strikeReset time.Duration
+	strikes     int
+	lastStrike  time.Time
+}
+
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	now := time.Now()
+
+	limiter := &RateLimiter{
+		now:         time.Now,
+		overall:     NewTokenBucket(limits.Overall, now),
+		events:      make(map[EventType]*TokenBucket),
+		maxStrikes:  limits.MaxStrikes,
+		strikeReset: limits.StrikeWindow,
+	}
+	for eventType, limit := range limits.Events {
+		limiter.events[eventType] = NewTokenBucket(limit, now)
+	}
+	return limiter
+}
+
+// Returns an error if the event exceeds the socket's budget, each throttled
+// event counts as a strike
+func (r *RateLimiter) Allow(eventType EventType) error {
+	now := r.now()
+
+	// a quiet period forgives previous strikes
+	if r.strikes > 0 && now.Sub(r.lastStrike) > r.strikeReset {
+		r.strikes = 0
+	}
+
+	allowed := true
+	if bucket, ok := r.events[eventType]; ok {
+		allowed = bucket.Allow(now)
+	}
+	if allowed {
+		allowed = r.overall.Allow(now)
+	}
+	if allowed {
+		return nil
+	}
+
+	r.strikes++
+	r.lastStrike = now
+	return NewProtocolError(RateLimited, fmt.Sprintf("Too many %v events, slow down", eventType))
+}
+
+// Whether the socket was throttled too many times and should be dropped
+func (r *RateLimiter) Exceeded() bool {
+	return r.maxStrikes > 0 && r.strikes >= r.maxStrikes
+}
@@ -0,0 +1,140 @@
+package pkg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRateLimit(t *testing.T) {
+	t.Run("parse", func(t *testing.T) {
+		limit, err := ParseRateLimit("2.5/10")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if limit.Rate != 2.5 || limit.Burst != 10 {
+			t.Errorf("Expected %v, got %v", "2.5/10", limit)
+		}
+
+		for _, invalid := range []string{"5", "0/1", "1/0", "a/b"} {
+			if _, err := ParseRateLimit(invalid); err == nil {
+				t.Errorf("Expected error for %q", invalid)
+			}
+		}
+	})
+
+	t.Run("token bucket", func(t *testing.T) {
+		now := time.Now()
+		bucket := NewTokenBucket(RateLimit{Rate: 2, Burst: 2}, now)
+
+		if !bucket.Allow(now) || !bucket.Allow(now) {
+			t.Error("Should allow burst")
+		}
+		if bucket.Allow(now) {
+			t.Error("Should throttle after burst")
+		}
+
+		// refills at rate
+		if !bucket.Allow(now.Add(500 * time.Millisecond)) {
+			t.Error("Should allow after refill")
+		}
+		if bucket.Allow(now.Add(500 * time.Millisecond)) {
+			t.Error("Should only refill one token")
+		}
+	})
+
+	t.Run("per event type", func(t *testing.T) {
+		limits := RateLimits{
+			Overall: RateLimit{Rate: 100, Burst: 100},
+			Events: map[EventType]RateLimit{
+				PlayCard: {Rate: 1, Burst: 1},
+			},
+		}
+		now := time.Now()
+		limiter := NewRateLimiter(limits)
+		limiter.now = func() time.Time { return now }
+
+		if err := limiter.Allow(PlayCard); err != nil {
+			t.Fatal(err)
+		}
+
+		err := limiter.Allow(PlayCard)
+		if ErrorCodeOf(err) != RateLimited {
+			t.Errorf("Expected %v, got %v", RateLimited, err)
+		}
+
+		if err := limiter.Allow(EndTurn); err != nil {
+			t.Errorf("Should not throttle other events, got %v", err)
+		}
+	})
+
+	t.Run("strikes", func(t *testing.T) {
+		limits := RateLimits{
+			Overall:      RateLimit{Rate: 1, Burst: 1},
+			MaxStrikes:   2,
+			StrikeWindow: time.Second,
+		}
+		now := time.Now()
+		limiter := NewRateLimiter(limits)
+		limiter.now = func() time.Time { return now }
+
+		limiter.Allow(EndTurn)
+		limiter.Allow(EndTurn)
+		if limiter.Exceeded() {
+			t.Error("Should not exceed after one strike")
+		}
+
+		// quiet period forgives the strike
+		now = now.Add(2 * time.Second)
+		limiter.Allow(EndTurn)
+		limiter.Allow(EndTurn)
+		if limiter.Exceeded() {
+			t.Error("Should have forgiven previous strike")
+		}
+
+		limiter.Allow(EndTurn)
+		if !limiter.Exceeded() {
+			t.Error("Should exceed after repeated strikes")
+		}
+	})
+
+	t.Run("disconnects flooding client", func(t *testing.T) {
+		config := DefaultConfig()
+		config.RateLimits = RateLimits{
+			Overall:      RateLimit{Rate: 1, Burst: 1},
+			MaxStrikes:   3,
+			StrikeWindow: time.Minute,
+		}
+		server := NewServerWithConfig(config)
+
+		listener := httptest.NewServer(http.HandlerFunc(server.HandleConnection))
+		defer listener.Close()
+
+		socket, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(listener.URL, "http"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer socket.Close()
+
+		for i := 0; i < 5; i++ {
+			socket.WriteJSON(map[string]interface{}{"type": EndTurn, "payload": "not-an-id"})
+		}
+
+		// throttled events get an error before the connection is dropped
+		ReadResponse(t, socket, Error)
+
+		socket.SetReadDeadline(time.Now().Add(time.Second))
+		for {
+			if _, _, err := socket.ReadMessage(); err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+					t.Errorf("Expected close, got %v", err)
+				}
+				break
+			}
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package pkg
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// Rating of players who never finished a game
+	DEFAULT_RATING = 1500
+	// Most points a single game can move a rating
+	ELO_K = 32
+)
+
+// RatingStore keeps the Elo rating of each player, by session
+type RatingStore interface {
+	// DEFAULT_RATING for players without one
+	Rating(player uuid.UUID) (float64, error)
+	SetRatings(ratings map[uuid.UUID]float64) error
+}
+
+var defaultRatings = struct {
+	mutex   sync.RWMutex
+	ratings RatingStore
+}{ratings: NewMemoryStore()}
+
+// Ratings games update and matchmaking reads, unless managers are given
+// their own or join a cluster
+func DefaultRatings() RatingStore {
+	defaultRatings.mutex.RLock()
+	defer defaultRatings.mutex.RUnlock()
+
+	return defaultRatings.ratings
+}
+
+// Replaces the ratings used by managers created from now on
+func SetDefaultRatings(ratings RatingStore) {
+	defaultRatings.mutex.Lock()
+	defer defaultRatings.mutex.Unlock()
+
+	defaultRatings.ratings = ratings
+}
+
+// Chance of a player rated rating beating one rated opponent
+func ExpectedScore(rating, opponent float64) float64 {
+	return 1 / (1 + math.Pow(10, (opponent-rating)/400))
+}
+
+// Updates the ratings of a game's players, the winner beat every loser.
+// Points won are the ones the losers lose, based on ratings before the game
+func RecordResult(ratings RatingStore, winner uuid.UUID, losers []uuid.UUID) (map[uuid.UUID]float64, error) {
+	before, err := ratings.Rating(winner)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := map[uuid.UUID]float64{winner: before}
+	for _, loser := range losers {
+		rating, err := ratings.Rating(loser)
+		if err != nil {
+			return nil, err
+		}
+
+		points := ELO_K * (1 - ExpectedScore(before, rating))
+		updated[winner] += points
+		updated[loser] = rating - points
+	}
+	return updated, ratings.SetRatings(updated)
+}
+
+// MatchRule tells which players can be matched together, the rating
+// difference accepted grows the longer players wait
+type MatchRule struct {
+	Window    float64 // difference accepted right away
+	Growth    float64 // added to the window for every second waited
+	MaxWindow float64 // the window stops growing there, 0 for no limit
+}
+
+func NewMatchRule(config Config) MatchRule {
+	return MatchRule{
+		Window:    float64(config.RatingWindow),
+		Growth:    float64(config.RatingWindowGrowth),
+		MaxWindow: float64(config.MaxRatingWindow),
+	}
+}
+
+// Rating difference accepted after waiting for waited
+func (r MatchRule) WindowAfter(waited time.Duration) float64 {
+	window := r.Window + r.Growth*waited.Seconds()
+	if r.MaxWindow > 0 && window > r.MaxWindow {
+		return r.MaxWindow
+	}
+	return window
+}
+
+// Whether two queued players accept each other at now
+func (r MatchRule) Fits(a, b QueueEntry, now time.Time) bool {
+	difference := math.Abs(a.Rating - b.Rating)
+	return difference <= r.WindowAfter(now.Sub(a.Joined)) && difference <= r.WindowAfter(now.Sub(b.Joined))
+}
@@ -0,0 +1,129 @@
+package pkg
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func RatedEntry(rating float64, waited time.Duration) QueueEntry {
+	entry := QueueEntryFor("a")
+	entry.Rating = rating
+	entry.Joined = time.Now().Add(-waited)
+	return entry
+}
+
+func TestRating(t *testing.T) {
+	t.Run("expected score", func(t *testing.T) {
+		if score := ExpectedScore(1500, 1500); score != 0.5 {
+			t.Errorf("Expected %v, got %v", 0.5, score)
+		}
+		if score := ExpectedScore(1900, 1500); math.Abs(score-0.909) > 0.001 {
+			t.Errorf("Expected %v, got %v", 0.909, score)
+		}
+	})
+
+	t.Run("records results", func(t *testing.T) {
+		ratings := NewMemoryStore()
+		winner, loser := uuid.New(), uuid.New()
+
+		updated, err := RecordResult(ratings, winner, []uuid.UUID{loser})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated[winner] != DEFAULT_RATING+ELO_K/2 || updated[loser] != DEFAULT_RATING-ELO_K/2 {
+			t.Errorf("Expected %v and %v, got %v", DEFAULT_RATING+ELO_K/2, DEFAULT_RATING-ELO_K/2, updated)
+		}
+
+		// an upset is worth more than the first game
+		RecordResult(ratings, loser, []uuid.UUID{winner})
+		if rating, _ := ratings.Rating(loser); rating <= DEFAULT_RATING {
+			t.Errorf("Expected more than %v, got %v", DEFAULT_RATING, rating)
+		}
+	})
+
+	t.Run("window grows while waiting", func(t *testing.T) {
+		rule := MatchRule{Window: 100, Growth: 10, MaxWindow: 300}
+
+		for waited, expected := range map[time.Duration]float64{0: 100, 10 * time.Second: 200, time.Minute: 300} {
+			if window := rule.WindowAfter(waited); window != expected {
+				t.Errorf("Expected %v after %v, got %v", expected, waited, window)
+			}
+		}
+	})
+
+	t.Run("pairs close ratings", func(t *testing.T) {
+		store := NewMemoryStore()
+		rule := MatchRule{Window: 100}
+
+		first := RatedEntry(1500, 0)
+		store.Enqueue(first)
+		store.Enqueue(RatedEntry(2000, 0))
+		close := RatedEntry(1550, 0)
+		store.Enqueue(close)
+
+		entries, _ := store.TakeMatch(2, rule)
+		if len(entries) != 2 || entries[0].Socket.Id != first.Socket.Id || entries[1].Socket.Id != close.Socket.Id {
+			t.Errorf("Expected %v and %v, got %v", first.Rating, close.Rating, entries)
+		}
+
+		if entries, _ := store.TakeMatch(2, rule); entries != nil {
+			t.Errorf("Expected no match, got %v", entries)
+		}
+	})
+
+	t.Run("pairs distant ratings after waiting", func(t *testing.T) {
+		store := NewMemoryStore()
+		rule := MatchRule{Window: 100, Growth: 10}
+
+		store.Enqueue(RatedEntry(2000, time.Minute))
+		store.Enqueue(RatedEntry(1600, 0))
+
+		// both players have to accept each other
+		if entries, _ := store.TakeMatch(2, rule); entries != nil {
+			t.Errorf("Expected no match, got %v", entries)
+		}
+
+		store.Enqueue(RatedEntry(1650, time.Minute))
+		if entries, _ := store.TakeMatch(2, rule); len(entries) != 2 || entries[0].Rating != 2000 || entries[1].Rating != 1650 {
+			t.Errorf("Expected %v and %v, got %v", 2000, 1650, entries)
+		}
+	})
+
+	t.Run("updated when games end", func(t *testing.T) {
+		ratings := NewMemoryStore()
+		manager := NewGameManager(time.Second)
+		manager.SetRatings(ratings)
+
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+		game := manager.CreateGame([]*Socket{p1, p2})
+		game.End(game.GetPlayers()[p2].Id)
+
+		if rating, _ := ratings.Rating(p2.Session); rating <= DEFAULT_RATING {
+			t.Errorf("Expected winner above %v, got %v", DEFAULT_RATING, rating)
+		}
+		if rating, _ := ratings.Rating(p1.Session); rating >= DEFAULT_RATING {
+			t.Errorf("Expected loser below %v, got %v", DEFAULT_RATING, rating)
+		}
+	})
+
+	t.Run("shared between managers by default", func(t *testing.T) {
+		games := NewGameManager(time.Second)
+		queue := NewQueueManager()
+
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+		game := games.CreateGame([]*Socket{p1, p2})
+		game.End(game.GetPlayers()[p2].Id)
+
+		// the winner queues with the rating the game gave them
+		queue.AddToQueue(p2)
+		entries, _ := queue.store.Queued()
+		if len(entries) != 1 || entries[0].Rating <= DEFAULT_RATING {
+			t.Errorf("Expected rating above %v, got %v", DEFAULT_RATING, entries)
+		}
+	})
+}
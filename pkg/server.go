@@ -1,9 +1,11 @@
 package pkg
 
 import (
-	"log"
 	"net/http"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
@@ -15,48 +17,312 @@ func NewDisconnected(player *Socket) Event {
 }
 
 type Server struct {
-	handlers []EventHandler
-	upgrader websocket.Upgrader
+	bus        *EventBus
+	upgrader   websocket.Upgrader
+	sessions   *Sessions
+	admission  *Admission
+	config     SocketConfig
+	limits     RateLimits
+	metrics    *Metrics
+	received   *Counter
+	latency    *Histogram
+	checks     []namedCheck
+	adminToken string
+	started    time.Time
+	cluster    *Cluster
+
+	mutex     *sync.Mutex
+	listeners []*http.Server
+	sockets   map[*Socket]bool
+	draining  bool
+	retired   OutboxStats // outbox counts of sockets already gone
 }
 
 func NewServer() *Server {
-	return &Server{
-		handlers: make([]EventHandler, 0),
-		upgrader: websocket.Upgrader{},
+	return NewServerWithConfig(DefaultConfig())
+}
+
+func NewServerWithConfig(config Config) *Server {
+	admission := NewAdmission(config)
+
+	server := &Server{
+		bus:        NewEventBus(),
+		upgrader:   websocket.Upgrader{CheckOrigin: admission.CheckOrigin},
+		sessions:   NewSessions([]byte(config.SessionSecret), config.SessionTTL),
+		admission:  admission,
+		config:     config.Socket,
+		limits:     config.RateLimits,
+		mutex:      new(sync.Mutex),
+		sockets:    make(map[*Socket]bool),
+		metrics:    NewMetrics(),
+		received:   NewCounter("type"),
+		latency:    NewHistogram("type", LATENCY_BUCKETS),
+		checks:     []namedCheck{},
+		started:    time.Now(),
+		adminToken: config.AdminToken,
 	}
+
+	server.metrics.Register("card_server_connected_sockets", "Clients currently connected", GaugeFunc(func() float64 {
+		return float64(len(server.Sockets()))
+	}))
+	server.metrics.Register("card_server_events_total", "Events received from clients", server.received)
+	server.metrics.Register("card_server_event_duration_seconds", "Time handlers took with an event and the events it led to", server.latency)
+	server.metrics.Register("card_server_outbox_depth", "Messages waiting in client outboxes", GaugeFunc(func() float64 {
+		return float64(server.OutboxStats().Depth)
+	}))
+	server.metrics.Register("card_server_outbox_peak_depth", "Most messages a connected client had waiting at once", GaugeFunc(func() float64 {
+		return float64(server.OutboxStats().Peak)
+	}))
+	server.metrics.Register("card_server_outbox_dropped_total", "Messages dropped because clients read too slowly", CounterFunc(func() float64 {
+		return float64(server.OutboxStats().Dropped)
+	}))
+	server.metrics.Register("card_server_outbox_coalesced_total", "Updates replaced by newer ones before clients read them", CounterFunc(func() float64 {
+		return float64(server.OutboxStats().Coalesced)
+	}))
+
+	return server
 }
 
-func (s *Server) Listen(addr string) {
-	http.HandleFunc("/", s.HandleConnection)
-	log.Fatal(http.ListenAndServe(addr, nil))
+// Sets keepalive settings for connections accepted from now on
+func (s *Server) SetSocketConfig(config SocketConfig) {
+	s.config = config
 }
 
+// Serves connections until Shutdown is called, a graceful shutdown is not
+// reported as an error
+func (s *Server) Listen(addr string) error {
+	listener := s.listener(addr)
+	if err := listener.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Same as Listen but over TLS, so clients can connect with wss://
+func (s *Server) ListenTLS(addr string, certs *CertReloader) error {
+	listener := s.listener(addr)
+	listener.TLSConfig = certs.TLSConfig()
+
+	if err := listener.ListenAndServeTLS("", ""); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.HandleConnection)
+	mux.HandleFunc("/events", s.HandleStream)
+	mux.HandleFunc("/events/", s.HandlePost)
+	mux.Handle("/metrics", s.metrics)
+	mux.HandleFunc("/healthz", s.HandleHealth)
+	mux.HandleFunc("/readyz", s.HandleReady)
+	mux.HandleFunc(ADMIN_PREFIX, s.HandleAdmin)
+	return mux
+}
+
+func (s *Server) listener(addr string) *http.Server {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	listener := &http.Server{Addr: addr, Handler: s.Handler()}
+	s.listeners = append(s.listeners, listener)
+	return listener
+}
+
+// Handlers only get the events they route, every event if they don't
 func (s *Server) RegisterHandler(handler EventHandler) {
-	s.handlers = append(s.handlers, handler)
+	s.RegisterHandlerWithPriority(handler, 0)
+}
+
+// Same as RegisterHandler, higher priorities are offered events first
+func (s *Server) RegisterHandlerWithPriority(handler EventHandler, priority int) {
+	s.bus.Subscribe(handler, priority, HandledEvents(handler)...)
+
+	if source, ok := handler.(MetricsSource); ok {
+		source.RegisterMetrics(s.metrics)
+	}
+	if member, ok := handler.(ClusterMember); ok && s.cluster != nil {
+		member.SetCluster(s.cluster)
+	}
+}
+
+// Makes this server an instance of cluster, sharing its players with the
+// other instances. Should be called before serving connections
+func (s *Server) Join(cluster *Cluster) {
+	cluster.server = s
+	s.cluster = cluster
+
+	for _, handler := range s.bus.Handlers() {
+		if member, ok := handler.(ClusterMember); ok {
+			member.SetCluster(cluster)
+		}
+	}
+
+	s.AddReadinessCheck("store", func() (string, error) {
+		if _, err := cluster.Store().Owner(uuid.Nil); err != nil {
+			return "", err
+		}
+		return "instance " + cluster.Instance(), nil
+	})
+
+	go cluster.Run()
+}
+
+// Registry behind the /metrics endpoint
+func (s *Server) Metrics() *Metrics {
+	return s.metrics
+}
+
+// Wraps every handler's processing with middleware, in the given order
+func (s *Server) Use(middleware ...Middleware) {
+	s.bus.Use(middleware...)
+}
+
+// Connected sockets, in no particular order
+func (s *Server) Sockets() []*Socket {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sockets := []*Socket{}
+	for socket := range s.sockets {
+		sockets = append(sockets, socket)
+	}
+	return sockets
 }
 
 func (s *Server) HandleConnection(w http.ResponseWriter, r *http.Request) {
-	s.upgrader.CheckOrigin = func(r *http.Request) bool {
-		return true
+	// clients pick the wire format when connecting, json by default
+	codec, err := ParseCodec(r.URL.Query().Get("encoding"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+
+	sessionId, release, ok := s.admit(w, r)
+	if !ok {
+		return
+	}
+
 	conn, err := s.upgrader.Upgrade(w, r, nil)
 
 	if err != nil {
-		log.Println("Could not upgrade connection")
+		release()
+		DefaultLogger().With(Fields{"remote": r.RemoteAddr, "error": err}).Error("could not upgrade connection")
 		return
 	}
 
-	socket := NewSocket(conn)
+	transport := NewWebsocketTransport(conn, s.config, codec)
+	s.accept(NewTransportSocket(transport, s.config), sessionId, release)
+}
+
+// Checks whether a connection attempt can go on, writing the rejection if
+// not. The returned release must be called once the connection is closed
+func (s *Server) admit(w http.ResponseWriter, r *http.Request) (uuid.UUID, func(), bool) {
+	if s.Draining() {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return uuid.Nil, nil, false
+	}
+
+	// resume a previous session if the client has a token for it
+	sessionId := uuid.New()
+	if token := r.URL.Query().Get("token"); token != "" {
+		id, err := s.sessions.Verify(token)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return uuid.Nil, nil, false
+		}
+		sessionId = id
+	}
+
+	release, err := s.admission.Admit(r)
+	if err != nil {
+		rejection := err.(*AdmissionError)
+		http.Error(w, rejection.Message, rejection.Status)
+		return uuid.Nil, nil, false
+	}
+
+	return sessionId, release, true
+}
+
+// Registers a connected socket and feeds its events to the handlers until
+// it disconnects, whatever transport it uses
+func (s *Server) accept(socket *Socket, sessionId uuid.UUID, release func()) {
+	socket.Session = sessionId
+
+	s.mutex.Lock()
+	s.sockets[socket] = true
+	s.mutex.Unlock()
+
+	if s.cluster != nil {
+		s.cluster.Attach(socket)
+	}
+
+	socket.Send(SessionMessage(s.sessions.Issue(sessionId)))
+
+	logger := DefaultLogger().With(socket.Fields())
+	logger.Info("socket connected")
 
 	go func() {
-		defer conn.Close()
+		defer socket.transport.Close()
+		defer release()
+		defer s.forget(socket)
+
+		limiter := NewRateLimiter(s.limits)
 
 		for {
 			select {
 			case event := <-socket.Incoming:
 				event.Player = socket
+
+				// throttle floods before doing any work for them
+				if err := limiter.Allow(event.Type); err != nil {
+					logger.With(Fields{"event": event.Type}).Warn("rate limited")
+					if limiter.Exceeded() {
+						socket.Close(ErrorMessage(err))
+					} else {
+						event.Reply(ErrorMessage(err))
+					}
+					continue
+				}
+
+				if event.Type == Hello {
+					s.received.Inc(string(Hello))
+					s.Handshake(socket, event)
+					continue
+				}
+
+				// clients that skip the handshake speak the legacy protocol
+				if !socket.Negotiated() {
+					socket.SetProtocol(LEGACY_PROTOCOL_VERSION, nil)
+				}
+
+				// reject malformed events before any handler sees them,
+				// keeping the payload as sent in case it is forwarded
+				payload := event.Payload
+				event, err := DecodeEvent(event)
+				if err != nil {
+					event.Reply(ErrorMessage(err))
+					continue
+				}
+
+				// counted once known, so made up types can't flood the metrics
+				s.received.Inc(string(event.Type))
+
+				// no new games are matched while shutting down
+				if event.Type == QueueUp && s.Draining() {
+					event.Reply(ErrorMessage(NewProtocolError(ServerShuttingDown, "Server is shutting down")))
+					continue
+				}
+
+				// matches and games owned by another instance are played there
+				if s.cluster != nil && s.cluster.Forward(event, payload) {
+					continue
+				}
+
 				s.ProcessEvent(event)
 			case <-socket.Disconnect:
+				logger.Info("socket disconnected")
 				s.ProcessEvent(NewDisconnected(socket))
 				return
 			}
@@ -64,10 +330,45 @@ func (s *Server) HandleConnection(w http.ResponseWriter, r *http.Request) {
 	}()
 }
 
-func (s *Server) ProcessEvent(event Event) {
-	for _, handler := range s.handlers {
-		if recast := handler.Process(event); recast != nil {
-			s.ProcessEvent(*recast)
+func (s *Server) forget(socket *Socket) {
+	stats := socket.Stats()
+
+	s.mutex.Lock()
+
+	delete(s.sockets, socket)
+	s.retired.Sent += stats.Sent
+	s.retired.Dropped += stats.Dropped
+	s.retired.Coalesced += stats.Coalesced
+	s.mutex.Unlock()
+
+	if s.cluster != nil {
+		s.cluster.Detach(socket)
+	}
+}
+
+// Outbox stats of every client, counts include clients already gone while
+// depths only cover connected ones. Peak is the highest any of them reached
+func (s *Server) OutboxStats() OutboxStats {
+	s.mutex.Lock()
+	total := s.retired
+	s.mutex.Unlock()
+
+	for _, socket := range s.Sockets() {
+		stats := socket.Stats()
+		total.Depth += stats.Depth
+		total.Sent += stats.Sent
+		total.Dropped += stats.Dropped
+		total.Coalesced += stats.Coalesced
+		if stats.Peak > total.Peak {
+			total.Peak = stats.Peak
 		}
 	}
+	return total
+}
+
+// Hands event to the handlers, timed once for all of them
+func (s *Server) ProcessEvent(event Event) {
+	start := time.Now()
+	s.bus.Publish(event)
+	s.latency.ObserveDuration(string(event.Type), time.Since(start))
 }
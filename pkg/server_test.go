@@ -1,6 +1,10 @@
 package pkg
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -35,6 +39,19 @@ func (d *DisconnectHandler) Process(event Event) *Event {
 	return nil
 }
 
+// Reads messages until one of the given type arrives
+func ReadResponse(t *testing.T, socket *websocket.Conn, responseType ResponseType) map[string]interface{} {
+	for {
+		var response map[string]interface{}
+		if err := socket.ReadJSON(&response); err != nil {
+			t.Fatalf("Expected %v, got %v", responseType, err)
+		}
+		if response["type"] == string(responseType) {
+			return response
+		}
+	}
+}
+
 func TestServer(t *testing.T) {
 	t.Run("disconnect", func(t *testing.T) {
 		server := NewServer()
@@ -60,4 +77,319 @@ func TestServer(t *testing.T) {
 			t.Errorf("Expected %v count, got %v", 1, handler.GetCount())
 		}
 	})
+	t.Run("session", func(t *testing.T) {
+		server := NewServer()
+		handler := NewDisconnectHandler()
+		server.RegisterHandler(handler)
+
+		listener := httptest.NewServer(http.HandlerFunc(server.HandleConnection))
+		defer listener.Close()
+
+		url := "ws" + strings.TrimPrefix(listener.URL, "http")
+
+		// connect
+		socket, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// expect a session token
+		var response struct {
+			Type    ResponseType
+			Payload SessionPayload
+		}
+		if err := socket.ReadJSON(&response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Type != SessionStarted {
+			t.Errorf("Expected %v, got %v", SessionStarted, response.Type)
+		}
+		socket.Close()
+
+		// resume session with token
+		socket, _, err = websocket.DefaultDialer.Dial(url+"?token="+response.Payload.Token, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer socket.Close()
+
+		sessionId := response.Payload.SessionId
+		if err := socket.ReadJSON(&response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Payload.SessionId != sessionId {
+			t.Errorf("Expected %v session, got %v", sessionId, response.Payload.SessionId)
+		}
+
+		// reject forged tokens
+		_, res, err := websocket.DefaultDialer.Dial(url+"?token=forged.token", nil)
+		if err == nil {
+			t.Error("Expected forged token to be rejected")
+		}
+		if res == nil || res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected %v status, got %v", http.StatusUnauthorized, res)
+		}
+	})
+	t.Run("handshake", func(t *testing.T) {
+		server := NewServer()
+		listener := httptest.NewServer(http.HandlerFunc(server.HandleConnection))
+		defer listener.Close()
+
+		url := "ws" + strings.TrimPrefix(listener.URL, "http")
+
+		socket, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer socket.Close()
+
+		socket.WriteJSON(map[string]interface{}{
+			"type": Hello,
+			"payload": map[string]interface{}{
+				"version":  PROTOCOL_VERSION + 1,
+				"features": []string{string(SessionResume), "teleport"},
+			},
+		})
+
+		response := ReadResponse(t, socket, Welcome)
+		payload := response["payload"].(map[string]interface{})
+
+		if payload["version"] != float64(PROTOCOL_VERSION) {
+			t.Errorf("Expected %v version, got %v", PROTOCOL_VERSION, payload["version"])
+		}
+		if payload["build"] != Build {
+			t.Errorf("Expected %v build, got %v", Build, payload["build"])
+		}
+		features := payload["features"].([]interface{})
+		if len(features) != 1 || features[0] != string(SessionResume) {
+			t.Errorf("Expected %v features, got %v", []Feature{SessionResume}, features)
+		}
+	})
+
+	t.Run("rejects unsupported protocol", func(t *testing.T) {
+		server := NewServer()
+		listener := httptest.NewServer(http.HandlerFunc(server.HandleConnection))
+		defer listener.Close()
+
+		url := "ws" + strings.TrimPrefix(listener.URL, "http")
+
+		socket, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer socket.Close()
+
+		socket.WriteJSON(map[string]interface{}{
+			"type":    Hello,
+			"payload": map[string]interface{}{"version": MIN_PROTOCOL_VERSION - 1},
+		})
+
+		// refused when negotiating, not as a malformed hello
+		response := ReadResponse(t, socket, Error)
+		if message, _ := response["payload"].(string); !strings.HasPrefix(message, "Unsupported protocol version") {
+			t.Errorf("Expected unsupported protocol, got %v", response["payload"])
+		}
+
+		// expect connection to be closed
+		socket.SetReadDeadline(time.Now().Add(time.Second))
+		for {
+			var response Response
+			if err := socket.ReadJSON(&response); err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+					t.Errorf("Expected close, got %v", err)
+				}
+				break
+			}
+		}
+	})
+	t.Run("missed heartbeat", func(t *testing.T) {
+		server := NewServer()
+		config := DefaultSocketConfig()
+		config.PingInterval = 20 * time.Millisecond
+		config.PongWait = 50 * time.Millisecond
+		config.WriteWait = 50 * time.Millisecond
+		server.SetSocketConfig(config)
+		handler := NewDisconnectHandler()
+		server.RegisterHandler(handler)
+
+		listener := httptest.NewServer(http.HandlerFunc(server.HandleConnection))
+		defer listener.Close()
+
+		// connect but never read, so pings are never answered
+		socket, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(listener.URL, "http"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer socket.Close()
+
+		time.Sleep(200 * time.Millisecond)
+
+		if handler.GetCount() != 1 {
+			t.Errorf("Expected %v count, got %v", 1, handler.GetCount())
+		}
+	})
+
+	t.Run("heartbeat keeps connection alive", func(t *testing.T) {
+		server := NewServer()
+		config := DefaultSocketConfig()
+		config.PingInterval = 20 * time.Millisecond
+		config.PongWait = 50 * time.Millisecond
+		config.WriteWait = 50 * time.Millisecond
+		server.SetSocketConfig(config)
+		handler := NewDisconnectHandler()
+		server.RegisterHandler(handler)
+
+		listener := httptest.NewServer(http.HandlerFunc(server.HandleConnection))
+		defer listener.Close()
+
+		socket, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(listener.URL, "http"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer socket.Close()
+
+		// reading answers pings with pongs
+		go func() {
+			for {
+				if _, _, err := socket.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		time.Sleep(200 * time.Millisecond)
+
+		if handler.GetCount() != 0 {
+			t.Errorf("Expected %v count, got %v", 0, handler.GetCount())
+		}
+	})
+	t.Run("shutdown", func(t *testing.T) {
+		server := NewServer()
+		handler := NewDisconnectHandler()
+		server.RegisterHandler(handler)
+
+		listener := httptest.NewServer(http.HandlerFunc(server.HandleConnection))
+		defer listener.Close()
+
+		url := "ws" + strings.TrimPrefix(listener.URL, "http")
+
+		socket, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer socket.Close()
+
+		ReadResponse(t, socket, SessionStarted)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		done := make(chan error)
+		go func() {
+			done <- server.Shutdown(ctx)
+		}()
+
+		// expect a maintenance notice
+		response := ReadResponse(t, socket, ServerShutdown)
+		payload := response["payload"].(map[string]interface{})
+		if payload["reason"] != MAINTENANCE_SHUTDOWN {
+			t.Errorf("Expected %v, got %v", MAINTENANCE_SHUTDOWN, payload["reason"])
+		}
+
+		// expect connection to be closed
+		socket.SetReadDeadline(time.Now().Add(time.Second))
+		for {
+			if _, _, err := socket.ReadMessage(); err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+					t.Errorf("Expected close, got %v", err)
+				}
+				break
+			}
+		}
+
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+		if handler.GetCount() != 1 {
+			t.Errorf("Expected %v count, got %v", 1, handler.GetCount())
+		}
+
+		// reject new connections
+		_, res, err := websocket.DefaultDialer.Dial(url, nil)
+		if err == nil {
+			t.Error("Expected connection to be rejected")
+		}
+		if res == nil || res.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("Expected %v status, got %v", http.StatusServiceUnavailable, res)
+		}
+	})
+
+	t.Run("drains handlers together", func(t *testing.T) {
+		server := NewServer()
+		games := NewGameManager(time.Minute)
+		matches := NewMatchManager(time.Minute)
+		server.RegisterHandler(games)
+		server.RegisterHandler(matches)
+
+		// a running game keeps its manager draining until the deadline
+		seated := NewTestSocket()
+		game := games.CreateGame([]*Socket{seated, NewTestSocket()})
+		defer game.End(game.GetPlayers()[seated].Id)
+
+		player := NewTestSocket()
+		matches.CreateMatch([]*Socket{player, NewTestSocket()})
+		<-player.Outgoing // confirm match
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		go server.Shutdown(ctx)
+
+		select {
+		case response := <-player.Outgoing:
+			if response.Type != MatchCanceled {
+				t.Errorf("Expected %v, got %v", MatchCanceled, response.Type)
+			}
+		case <-time.After(500 * time.Millisecond):
+			t.Error("Expected match to be canceled while games drain")
+		}
+	})
+
+	t.Run("rejects queue while shutting down", func(t *testing.T) {
+		server := NewServer()
+		server.RegisterHandler(NewQueueManager())
+
+		listener := httptest.NewServer(http.HandlerFunc(server.HandleConnection))
+		defer listener.Close()
+
+		socket, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(listener.URL, "http"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer socket.Close()
+
+		ReadResponse(t, socket, SessionStarted)
+
+		socket.WriteJSON(map[string]interface{}{
+			"type": Hello,
+			"payload": map[string]interface{}{
+				"version":  PROTOCOL_VERSION,
+				"features": []string{string(ErrorCodes)},
+			},
+		})
+		ReadResponse(t, socket, Welcome)
+
+		server.mutex.Lock()
+		server.draining = true
+		server.mutex.Unlock()
+
+		socket.WriteJSON(map[string]interface{}{
+			"type": QueueUp,
+		})
+
+		response := ReadResponse(t, socket, Error)
+		payload := response["payload"].(map[string]interface{})
+		if payload["code"] != string(ServerShuttingDown) {
+			t.Errorf("Expected %v, got %v", ServerShuttingDown, payload["code"])
+		}
+	})
 }
@@ -0,0 +1,108 @@
+package pkg
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const SESSION_TTL = 24 * time.Hour
+
+var (
+	ErrInvalidToken = errors.New("Invalid session token")
+	ErrExpiredToken = errors.New("Session token expired")
+)
+
+type SessionPayload struct {
+	SessionId uuid.UUID `json:"session_id"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func SessionMessage(payload SessionPayload) Response {
+	return Response{
+		Type:    SessionStarted,
+		Payload: payload,
+	}
+}
+
+// Sessions issues and verifies signed tokens binding a connection to a
+// player identity, so only the original player can resume a seat
+type Sessions struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// Creates a session signer, if no secret is given a random one is
+// generated, which invalidates tokens on restart
+func NewSessions(secret []byte, ttl time.Duration) *Sessions {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			panic(err)
+		}
+	}
+	return &Sessions{
+		secret: secret,
+		ttl:    ttl,
+	}
+}
+
+func (s *Sessions) Issue(sessionId uuid.UUID) SessionPayload {
+	expiresAt := time.Now().Add(s.ttl)
+
+	data := make([]byte, 24)
+	copy(data, sessionId[:])
+	binary.BigEndian.PutUint64(data[16:], uint64(expiresAt.Unix()))
+
+	return SessionPayload{
+		SessionId: sessionId,
+		ExpiresAt: expiresAt,
+		Token: strings.Join([]string{
+			base64.RawURLEncoding.EncodeToString(data),
+			base64.RawURLEncoding.EncodeToString(s.sign(data)),
+		}, "."),
+	}
+}
+
+// Returns the session id a token was issued for
+func (s *Sessions) Verify(token string) (uuid.UUID, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return uuid.Nil, ErrInvalidToken
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || len(data) != 24 {
+		return uuid.Nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, s.sign(data)) {
+		return uuid.Nil, ErrInvalidToken
+	}
+
+	expiresAt := time.Unix(int64(binary.BigEndian.Uint64(data[16:])), 0)
+	if time.Now().After(expiresAt) {
+		return uuid.Nil, ErrExpiredToken
+	}
+
+	sessionId, err := uuid.FromBytes(data[:16])
+	if err != nil {
+		return uuid.Nil, ErrInvalidToken
+	}
+	return sessionId, nil
+}
+
+func (s *Sessions) sign(data []byte) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
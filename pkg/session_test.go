@@ -0,0 +1,66 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSessions(t *testing.T) {
+	t.Run("verifies issued token", func(t *testing.T) {
+		sessions := NewSessions(nil, time.Minute)
+		sessionId := uuid.New()
+
+		payload := sessions.Issue(sessionId)
+
+		got, err := sessions.Verify(payload.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != sessionId {
+			t.Errorf("Expected %v, got %v", sessionId, got)
+		}
+	})
+
+	t.Run("rejects tampered token", func(t *testing.T) {
+		sessions := NewSessions(nil, time.Minute)
+		token := sessions.Issue(uuid.New()).Token
+
+		forged := sessions.Issue(uuid.New()).Token
+		parts := strings.Split(token, ".")
+		tampered := strings.Split(forged, ".")[0] + "." + parts[1]
+
+		if _, err := sessions.Verify(tampered); err != ErrInvalidToken {
+			t.Errorf("Expected %v, got %v", ErrInvalidToken, err)
+		}
+	})
+
+	t.Run("rejects token from another secret", func(t *testing.T) {
+		token := NewSessions([]byte("secret"), time.Minute).Issue(uuid.New()).Token
+
+		if _, err := NewSessions([]byte("other"), time.Minute).Verify(token); err != ErrInvalidToken {
+			t.Errorf("Expected %v, got %v", ErrInvalidToken, err)
+		}
+	})
+
+	t.Run("rejects expired token", func(t *testing.T) {
+		sessions := NewSessions(nil, -time.Minute)
+		token := sessions.Issue(uuid.New()).Token
+
+		if _, err := sessions.Verify(token); err != ErrExpiredToken {
+			t.Errorf("Expected %v, got %v", ErrExpiredToken, err)
+		}
+	})
+
+	t.Run("rejects garbage", func(t *testing.T) {
+		sessions := NewSessions(nil, time.Minute)
+
+		for _, token := range []string{"", "abc", "a.b", "a.b.c"} {
+			if _, err := sessions.Verify(token); err != ErrInvalidToken {
+				t.Errorf("Expected %v for %q, got %v", ErrInvalidToken, token, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Reason sent to clients when the server is stopped for a deploy
+const MAINTENANCE_SHUTDOWN = "maintenance"
+
+type ShutdownPayload struct {
+	Reason   string    `json:"reason"`
+	Deadline time.Time `json:"deadline,omitempty"`
+}
+
+func ShutdownMessage(deadline time.Time) Response {
+	return Response{
+		Type: ServerShutdown,
+		Payload: ShutdownPayload{
+			Reason:   MAINTENANCE_SHUTDOWN,
+			Deadline: deadline,
+		},
+	}
+}
+
+// Drainer is implemented by handlers that hold state which must be wrapped
+// up before the server exits
+type Drainer interface {
+	Drain(ctx context.Context) error
+}
+
+// Stops accepting connections and queue entries, warns connected clients and
+// waits for handlers to drain until ctx is done, then closes every socket
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	s.draining = true
+	listeners := s.listeners
+	s.mutex.Unlock()
+
+	// listeners wait for open streams, which are only closed after draining,
+	// hijacked websockets are not tracked at all
+	stopped := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func(listener *http.Server) {
+			stopped <- listener.Shutdown(ctx)
+		}(listener)
+	}
+
+	var err error
+
+	deadline, _ := ctx.Deadline()
+	for _, socket := range s.Sockets() {
+		socket.Send(ShutdownMessage(deadline))
+	}
+
+	// drained together, one waiting on its games must not keep the others
+	// from refusing new work
+	drained := make(chan error)
+	drainers := 0
+	for _, handler := range s.bus.Handlers() {
+		if drainer, ok := handler.(Drainer); ok {
+			drainers++
+			go func(drainer Drainer) {
+				drained <- drainer.Drain(ctx)
+			}(drainer)
+		}
+	}
+	for ; drainers > 0; drainers-- {
+		if drainErr := <-drained; drainErr != nil && err == nil {
+			err = drainErr
+		}
+	}
+
+	for _, socket := range s.Sockets() {
+		socket.Close(ShutdownMessage(deadline))
+	}
+
+	// give sockets a chance to flush their close frames
+	timeout := time.After(s.config.WriteWait)
+	for flushing := true; flushing && len(s.Sockets()) != 0; {
+		select {
+		case <-timeout:
+			flushing = false
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	for range listeners {
+		if stopErr := <-stopped; stopErr != nil && err == nil {
+			err = stopErr
+		}
+	}
+
+	if s.cluster != nil {
+		s.cluster.Stop()
+	}
+
+	return err
+}
+
+func (s *Server) Draining() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.draining
+}
@@ -0,0 +1,63 @@
+package pkg
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GameSnapshot is the state of an unfinished game, persisted on shutdown so
+// it can be inspected or restored later
+type GameSnapshot struct {
+	Id       uuid.UUID        `json:"id"`
+	Current  uuid.UUID        `json:"current,omitempty"`
+	TurnLeft time.Duration    `json:"turn_left"`
+	Players  []PlayerSnapshot `json:"players"`
+}
+
+type PlayerSnapshot struct {
+	Id      uuid.UUID       `json:"id"`
+	Session uuid.UUID       `json:"session"`
+	Health  int             `json:"health"`
+	Mana    int             `json:"mana"`
+	MaxMana int             `json:"max_mana"`
+	Hand    []Card          `json:"hand"`
+	Board   []*ActiveMinion `json:"board"`
+}
+
+func (g *Game) Snapshot() GameSnapshot {
+	snapshot := GameSnapshot{
+		Id:      g.Id,
+		Players: []PlayerSnapshot{},
+	}
+
+	g.do(func() {
+		if g.current != -1 {
+			snapshot.Current = g.players[g.sockets[g.current]].Id
+			snapshot.TurnLeft = g.timer.Left()
+		}
+
+		for _, socket := range g.sockets {
+			snapshot.Players = append(snapshot.Players, g.players[socket].Snapshot())
+		}
+	})
+
+	return snapshot
+}
+
+func (p *Player) Snapshot() PlayerSnapshot {
+	board := []*ActiveMinion{}
+	for _, minion := range p.Board.Minions {
+		board = append(board, minion.Snapshot())
+	}
+
+	return PlayerSnapshot{
+		Id:      p.Id,
+		Session: p.session,
+		Health:  p.GetHealth(),
+		Mana:    p.GetMana(),
+		MaxMana: p.GetTotalMana(),
+		Hand:    SnapshotCards(p.Hand.GetCards()),
+		Board:   board,
+	}
+}
@@ -1,68 +1,240 @@
 package pkg
 
 import (
+	"sort"
+	"sync"
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
+// SocketConfig controls keepalives and outgoing buffering, a peer which
+// doesn't answer a ping within PongWait is considered gone
+type SocketConfig struct {
+	PingInterval time.Duration
+	PongWait     time.Duration
+	WriteWait    time.Duration
+	SendBuffer   int
+	SlowConsumer SlowConsumerPolicy
+}
+
+func DefaultSocketConfig() SocketConfig {
+	return SocketConfig{
+		PingInterval: 54 * time.Second,
+		PongWait:     60 * time.Second,
+		WriteWait:    10 * time.Second,
+		SendBuffer:   256,
+		SlowConsumer: DisconnectClient,
+	}
+}
+
 type Socket struct {
-	Id uuid.UUID
+	Id      uuid.UUID
+	Session uuid.UUID // player identity, survives reconnections
 
 	Outgoing   chan Response // messages to client
 	Incoming   chan Event    // messages from client
 	Disconnect chan bool
 
-	socket *websocket.Conn
+	mutex     *sync.Mutex
+	protocol  int
+	features  map[Feature]bool
+	closing   chan Response
+	done      chan struct{}
+	outbox    *Outbox
+	config    SocketConfig
+	transport Transport
 }
 
-func NewSocket(conn *websocket.Conn) *Socket {
+func NewSocket(conn *websocket.Conn, config SocketConfig) *Socket {
+	return NewTransportSocket(NewWebsocketTransport(conn, config, JSONCodec{}), config)
+}
+
+// Creates a socket for a client connected through transport
+func NewTransportSocket(transport Transport, config SocketConfig) *Socket {
 	socket := &Socket{
-		Id: uuid.New(),
+		Id:      uuid.New(),
+		Session: uuid.New(),
 
 		Incoming:   make(chan Event),
 		Outgoing:   make(chan Response),
 		Disconnect: make(chan bool),
 
-		socket: conn,
+		mutex:     new(sync.Mutex),
+		features:  make(map[Feature]bool),
+		closing:   make(chan Response, 1),
+		done:      make(chan struct{}),
+		outbox:    NewOutbox(config.SendBuffer, config.SlowConsumer),
+		config:    config,
+		transport: transport,
 	}
 
 	go socket.Read()
 	go socket.Write()
+	go socket.Pump()
 
 	return socket
 }
 
+// Test sockets speak the latest protocol with every feature enabled, except
+// state diffs, so games are followed through full messages
 func NewTestSocket() *Socket {
-	return &Socket{
-		Id: uuid.New(),
+	socket := &Socket{
+		Id:      uuid.New(),
+		Session: uuid.New(),
 
 		Incoming:   make(chan Event),
 		Outgoing:   make(chan Response),
 		Disconnect: make(chan bool),
+
+		mutex:    new(sync.Mutex),
+		features: make(map[Feature]bool),
+		closing:  make(chan Response, 1),
+		done:     make(chan struct{}),
+		config:   DefaultSocketConfig(),
 	}
+	socket.outbox = NewOutbox(socket.config.SendBuffer, socket.config.SlowConsumer)
+	socket.SetProtocol(PROTOCOL_VERSION, []Feature{SessionResume, RequestIds, ErrorCodes})
+
+	go socket.Pump()
+
+	return socket
 }
 
+// Queues a message to client without blocking, messages are delivered in
+// the order they were sent
 func (p *Socket) Send(message Response) {
-	p.Outgoing <- message
+	if !p.outbox.Push(p.Downgrade(message)) {
+		p.Close(ErrorMessage(NewProtocolError(SlowConsumer, "Too many pending messages")))
+	}
+}
+
+// Delivers queued messages to Outgoing, one at a time and in order
+func (s *Socket) Pump() {
+	for {
+		select {
+		case <-s.outbox.Ready():
+		case <-s.done:
+			return
+		}
+
+		for {
+			message, ok := s.outbox.Pop()
+			if !ok {
+				break
+			}
+			select {
+			case s.Outgoing <- message:
+			case <-s.done:
+				return
+			}
+		}
+	}
 }
 
+func (s *Socket) Stats() OutboxStats {
+	return s.outbox.Stats()
+}
+
+// Reshapes a message for clients that negotiated an older protocol
+func (s *Socket) Downgrade(message Response) Response {
+	if message.Type == Error && !s.Supports(ErrorCodes) {
+		if err, ok := message.Payload.(error); ok {
+			message.Payload = err.Error()
+		}
+	}
+	return message
+}
+
+// Sends a last message and closes the connection after writing it
+func (s *Socket) Close(message Response) {
+	select {
+	case s.closing <- s.Downgrade(message):
+	default:
+	}
+}
+
+func (s *Socket) SetProtocol(version int, features []Feature) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.protocol = version
+	for _, feature := range features {
+		s.features[feature] = true
+	}
+}
+
+func (s *Socket) Protocol() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.protocol
+}
+
+func (s *Socket) Negotiated() bool {
+	return s.Protocol() != 0
+}
+
+func (s *Socket) Supports(feature Feature) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.features[feature]
+}
+
+// Features enabled for this socket, sorted
+func (s *Socket) Features() []Feature {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	features := []Feature{}
+	for feature := range s.features {
+		features = append(features, feature)
+	}
+	sort.Slice(features, func(i, j int) bool { return features[i] < features[j] })
+	return features
+}
+
+// Reads client messages until the connection fails or the peer stops
+// answering pings, then notifies the disconnection
 func (s *Socket) Read() {
 	for {
-		var event Event
-		err := s.socket.ReadJSON(&event)
+		event, err := s.transport.ReadEvent()
 		if err != nil {
 			break
 		}
 		s.Incoming <- event
 	}
+
+	close(s.done)
 	s.Disconnect <- true
 }
 
+// Writes messages and pings to client, closing the connection on failure
+// so the reader notices it
 func (s *Socket) Write() {
+	ticker := time.NewTicker(s.config.PingInterval)
+	defer func() {
+		ticker.Stop()
+		s.transport.Close()
+	}()
+
 	for {
 		select {
 		case msg := <-s.Outgoing:
-			s.socket.WriteJSON(msg)
+			if err := s.transport.WriteResponse(msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := s.transport.Ping(); err != nil {
+				return
+			}
+		case msg := <-s.closing:
+			s.transport.CloseWith(msg)
+			return
+		case <-s.done:
+			return
 		}
 	}
 }
@@ -0,0 +1,238 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Largest event body accepted over HTTP
+const MAX_EVENT_SIZE = 64 * 1024
+
+var ErrTransportClosed = errors.New("Transport closed")
+
+// First message of a stream, telling the client where to post its events.
+// Posts must carry the session token sent next as a bearer token, the
+// socket id alone is not proof of owning the stream
+type StreamPayload struct {
+	SocketId uuid.UUID `json:"socket_id"`
+	Events   string    `json:"events"`
+}
+
+// SSETransport is a fallback for clients which cannot use websockets:
+// responses are streamed as server-sent events and events are posted
+type SSETransport struct {
+	mutex    *sync.Mutex
+	writer   http.ResponseWriter
+	flusher  http.Flusher
+	incoming chan Event
+	closed   chan struct{}
+}
+
+func NewSSETransport(w http.ResponseWriter) (*SSETransport, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("Streaming not supported")
+	}
+
+	return &SSETransport{
+		mutex:    new(sync.Mutex),
+		writer:   w,
+		flusher:  flusher,
+		incoming: make(chan Event),
+		closed:   make(chan struct{}),
+	}, nil
+}
+
+func (t *SSETransport) ReadEvent() (Event, error) {
+	select {
+	case event := <-t.incoming:
+		return event, nil
+	case <-t.closed:
+		return Event{}, ErrTransportClosed
+	}
+}
+
+// Hands an event posted by the client to the reader
+func (t *SSETransport) Deliver(event Event) error {
+	select {
+	case t.incoming <- event:
+		return nil
+	case <-t.closed:
+		return ErrTransportClosed
+	}
+}
+
+func (t *SSETransport) WriteResponse(response Response) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	return t.write(fmt.Sprintf("data: %s\n\n", data))
+}
+
+// Comments are ignored by clients but keep proxies from timing out
+func (t *SSETransport) Ping() error {
+	return t.write(": ping\n\n")
+}
+
+func (t *SSETransport) CloseWith(response Response) {
+	t.WriteResponse(response)
+	t.write("event: close\ndata: {}\n\n")
+	t.Close()
+}
+
+func (t *SSETransport) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	select {
+	case <-t.closed:
+	default:
+		close(t.closed)
+	}
+	return nil
+}
+
+// Closed once the stream is over, the request must be kept open until then
+func (t *SSETransport) Done() <-chan struct{} {
+	return t.closed
+}
+
+func (t *SSETransport) writeEvent(name string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return t.write(fmt.Sprintf("event: %v\ndata: %s\n\n", name, data))
+}
+
+// Writes are serialized with Close so nothing is written to the response
+// after its handler has returned
+func (t *SSETransport) write(frame string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	select {
+	case <-t.closed:
+		return ErrTransportClosed
+	default:
+	}
+
+	if _, err := t.writer.Write([]byte(frame)); err != nil {
+		return err
+	}
+	t.flusher.Flush()
+	return nil
+}
+
+// Opens a server-sent events stream of responses, the first event tells the
+// client where to post its events
+func (s *Server) HandleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// server-sent events are text only
+	if encoding := r.URL.Query().Get("encoding"); encoding != "" && encoding != JSON_ENCODING {
+		http.Error(w, fmt.Sprintf("Unsupported encoding %q for streams", encoding), http.StatusBadRequest)
+		return
+	}
+
+	sessionId, release, ok := s.admit(w, r)
+	if !ok {
+		return
+	}
+
+	transport, err := NewSSETransport(w)
+	if err != nil {
+		release()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	socket := NewTransportSocket(transport, s.config)
+	transport.writeEvent("socket", StreamPayload{
+		SocketId: socket.Id,
+		Events:   "/events/" + socket.Id.String(),
+	})
+
+	s.accept(socket, sessionId, release)
+
+	select {
+	case <-r.Context().Done():
+		transport.Close()
+	case <-transport.Done():
+	}
+}
+
+// Receives an event for a stream opened with HandleStream
+func (s *Server) HandlePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	socket := s.findStream(strings.TrimPrefix(r.URL.Path, "/events/"))
+	if socket == nil {
+		http.Error(w, "Stream not found", http.StatusNotFound)
+		return
+	}
+
+	// only the session the stream was opened for can post to it
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="events"`)
+		http.Error(w, "Session token required", http.StatusUnauthorized)
+		return
+	}
+	sessionId, err := s.sessions.Verify(strings.TrimPrefix(header, "Bearer "))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if sessionId != socket.Session {
+		http.Error(w, "Session does not own this stream", http.StatusForbidden)
+		return
+	}
+	transport := socket.transport.(*SSETransport)
+
+	var event Event
+	body := http.MaxBytesReader(w, r.Body, MAX_EVENT_SIZE)
+	if err := json.NewDecoder(body).Decode(&event); err != nil {
+		http.Error(w, "Invalid event", http.StatusBadRequest)
+		return
+	}
+
+	if err := transport.Deliver(event); err != nil {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Socket of a stream opened with HandleStream
+func (s *Server) findStream(id string) *Socket {
+	socketId, err := uuid.Parse(id)
+	if err != nil {
+		return nil
+	}
+
+	for _, socket := range s.Sockets() {
+		if _, ok := socket.transport.(*SSETransport); ok && socket.Id == socketId {
+			return socket
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type StreamEvent struct {
+	Name string
+	Data string
+}
+
+// Reads the next server-sent event, skipping comments
+func ReadStreamEvent(t *testing.T, reader *bufio.Reader) StreamEvent {
+	event := StreamEvent{Name: "message"}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Expected event, got %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+
+		switch {
+		case line == "" && event.Data != "":
+			return event
+		case strings.HasPrefix(line, "event: "):
+			event.Name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.Data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+// Reads stream messages until a response of the given type arrives
+func ReadStreamResponse(t *testing.T, reader *bufio.Reader, responseType ResponseType) map[string]interface{} {
+	for {
+		var response map[string]interface{}
+		event := ReadStreamEvent(t, reader)
+		if err := json.Unmarshal([]byte(event.Data), &response); err != nil {
+			t.Fatal(err)
+		}
+		if response["type"] == string(responseType) {
+			return response
+		}
+	}
+}
+
+// Posts event to a stream as the session the token was issued for
+func PostEvent(t *testing.T, url, token string, event map[string]interface{}) *http.Response {
+	body, _ := json.Marshal(event)
+	request, _ := http.NewRequest("POST", url, strings.NewReader(string(body)))
+	request.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res
+}
+
+func TestSSE(t *testing.T) {
+	t.Run("streams responses and accepts posted events", func(t *testing.T) {
+		server := NewServer()
+		server.RegisterHandler(NewQueueManager())
+		handler := NewDisconnectHandler()
+		server.RegisterHandler(handler)
+
+		listener := httptest.NewServer(server.Handler())
+		defer listener.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		request, _ := http.NewRequestWithContext(ctx, "GET", listener.URL+"/events", nil)
+		res, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if res.Header.Get("Content-Type") != "text/event-stream" {
+			t.Errorf("Expected %v, got %v", "text/event-stream", res.Header.Get("Content-Type"))
+		}
+
+		reader := bufio.NewReader(res.Body)
+
+		// first event tells where to post
+		event := ReadStreamEvent(t, reader)
+		if event.Name != "socket" {
+			t.Fatalf("Expected %v event, got %v", "socket", event.Name)
+		}
+		var stream StreamPayload
+		json.Unmarshal([]byte(event.Data), &stream)
+
+		session := ReadStreamResponse(t, reader, SessionStarted)
+		token := session["payload"].(map[string]interface{})["token"].(string)
+
+		res = PostEvent(t, listener.URL+stream.Events, token, map[string]interface{}{
+			"type":    Hello,
+			"payload": map[string]interface{}{"version": PROTOCOL_VERSION},
+		})
+		if res.StatusCode != http.StatusAccepted {
+			t.Errorf("Expected %v, got %v", http.StatusAccepted, res.StatusCode)
+		}
+		ReadStreamResponse(t, reader, Welcome)
+
+		// existing handlers work unchanged
+		PostEvent(t, listener.URL+stream.Events, token, map[string]interface{}{"type": QueueUp})
+		ReadStreamResponse(t, reader, WaitForMatch)
+
+		// closing the stream disconnects the socket
+		cancel()
+		time.Sleep(50 * time.Millisecond)
+
+		if handler.GetCount() != 1 {
+			t.Errorf("Expected %v count, got %v", 1, handler.GetCount())
+		}
+
+		res = PostEvent(t, listener.URL+stream.Events, token, map[string]interface{}{"type": QueueUp})
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected %v, got %v", http.StatusNotFound, res.StatusCode)
+		}
+	})
+
+	t.Run("rejects unknown streams", func(t *testing.T) {
+		server := NewServer()
+		listener := httptest.NewServer(server.Handler())
+		defer listener.Close()
+
+		res := PostEvent(t, listener.URL+"/events/not-a-stream", "", map[string]interface{}{"type": QueueUp})
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected %v, got %v", http.StatusNotFound, res.StatusCode)
+		}
+	})
+
+	t.Run("rejects posts from other sessions", func(t *testing.T) {
+		server := NewServer()
+		listener := httptest.NewServer(server.Handler())
+		defer listener.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		request, _ := http.NewRequestWithContext(ctx, "GET", listener.URL+"/events", nil)
+		res, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		reader := bufio.NewReader(res.Body)
+		var stream StreamPayload
+		json.Unmarshal([]byte(ReadStreamEvent(t, reader).Data), &stream)
+
+		hello := map[string]interface{}{
+			"type":    Hello,
+			"payload": map[string]interface{}{"version": PROTOCOL_VERSION},
+		}
+
+		res = PostEvent(t, listener.URL+stream.Events, "", hello)
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected %v, got %v", http.StatusUnauthorized, res.StatusCode)
+		}
+
+		res = PostEvent(t, listener.URL+stream.Events, "forged", hello)
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected %v, got %v", http.StatusUnauthorized, res.StatusCode)
+		}
+
+		// a valid token of someone else
+		other := server.sessions.Issue(uuid.New())
+		res = PostEvent(t, listener.URL+stream.Events, other.Token, hello)
+		if res.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected %v, got %v", http.StatusForbidden, res.StatusCode)
+		}
+	})
+
+	t.Run("closes stream on shutdown", func(t *testing.T) {
+		server := NewServer()
+		listener := httptest.NewServer(server.Handler())
+		defer listener.Close()
+
+		res, err := http.Get(listener.URL + "/events")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		reader := bufio.NewReader(res.Body)
+		ReadStreamResponse(t, reader, SessionStarted)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		go server.Shutdown(ctx)
+
+		ReadStreamResponse(t, reader, ServerShutdown)
+		for {
+			if event := ReadStreamEvent(t, reader); event.Name == "close" {
+				break
+			}
+		}
+	})
+}
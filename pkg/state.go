@@ -0,0 +1,275 @@
+package pkg
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+type ChangeType string
+
+const (
+	PlayerChanged ChangeType = "player_changed"
+	MinionAdded   ChangeType = "minion_added"
+	MinionChanged ChangeType = "minion_changed"
+	MinionRemoved ChangeType = "minion_removed"
+	CardAdded     ChangeType = "card_added"
+	CardRemoved   ChangeType = "card_removed"
+)
+
+// MinionView is what players see of a minion on board
+type MinionView struct {
+	Id     uuid.UUID `json:"id"`
+	Name   string    `json:"name"`
+	Mana   int       `json:"mana"`
+	Damage int       `json:"damage"`
+	Health int       `json:"health"`
+	State  string    `json:"state"`
+}
+
+// PlayerStats are the counters of a player everyone in the game can see
+type PlayerStats struct {
+	Health      int `json:"health"`
+	Mana        int `json:"mana"`
+	MaxMana     int `json:"max_mana"`
+	CardsInHand int `json:"cards_in_hand"`
+}
+
+type PlayerView struct {
+	Id    uuid.UUID                `json:"id"`
+	Stats PlayerStats              `json:"stats"`
+	Hand  map[uuid.UUID]Card       `json:"hand,omitempty"` // only sent to its owner
+	Board map[uuid.UUID]MinionView `json:"board"`
+}
+
+// StateView is a game as one of its players sees it
+type StateView struct {
+	Players []PlayerView `json:"players"`
+}
+
+// Change is a single difference between two views, only the fields
+// relevant to its type are set
+type Change struct {
+	Type     ChangeType   `json:"type"`
+	PlayerId uuid.UUID    `json:"player_id"`
+	Stats    *PlayerStats `json:"stats,omitempty"`
+	Minion   *MinionView  `json:"minion,omitempty"`
+	Card     Card         `json:"card,omitempty"`
+	Id       *uuid.UUID   `json:"id,omitempty"` // removed minion or card
+}
+
+// Versions are counted per player, a diff applies on top of the state with
+// the previous version, so a skipped version means the client is out of sync
+type StateDiffPayload struct {
+	GameId  uuid.UUID `json:"game_id"`
+	Version int       `json:"version"`
+	Changes []Change  `json:"changes"`
+}
+
+type StatePayload struct {
+	GameId  uuid.UUID `json:"game_id"`
+	Version int       `json:"version"`
+	State   StateView `json:"state"`
+}
+
+// StateTracker remembers the last state a player was sent, so only what
+// changed since has to be sent next
+type StateTracker struct {
+	mutex   *sync.Mutex
+	gameId  uuid.UUID
+	viewer  *Player
+	players []*Player
+	version int
+	view    StateView
+}
+
+func NewStateTracker(gameId uuid.UUID, viewer *Player, players []*Player) *StateTracker {
+	return &StateTracker{
+		mutex:   new(sync.Mutex),
+		gameId:  gameId,
+		viewer:  viewer,
+		players: players,
+		view:    StateView{Players: []PlayerView{}},
+	}
+}
+
+func (t *StateTracker) Version() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.version
+}
+
+// Sends the changes since the last message, if any. Sending happens with
+// the lock held so messages go out in version order
+func (t *StateTracker) Sync(send func(Response)) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	current := t.current()
+	changes := DiffState(t.view, current)
+	if len(changes) == 0 {
+		return
+	}
+
+	t.version++
+	t.view = current
+
+	send(Response{
+		Type: StateDiff,
+		Payload: StateDiffPayload{
+			GameId:  t.gameId,
+			Version: t.version,
+			Changes: changes,
+		},
+	})
+}
+
+// Sends the whole state, for clients that lost track of it
+func (t *StateTracker) Resync(send func(Response)) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.version++
+	t.view = t.current()
+
+	send(Response{
+		Type: FullState,
+		Payload: StatePayload{
+			GameId:  t.gameId,
+			Version: t.version,
+			State:   t.view,
+		},
+	})
+}
+
+func (t *StateTracker) current() StateView {
+	view := StateView{Players: []PlayerView{}}
+	for _, player := range t.players {
+		view.Players = append(view.Players, player.View(player == t.viewer))
+	}
+	return view
+}
+
+// Describes the game as seen by others, unless it's seen by the player
+// itself, which also knows the cards in hand
+func (p *Player) View(own bool) PlayerView {
+	cards := p.Hand.GetCards()
+
+	view := PlayerView{
+		Id: p.Id,
+		Stats: PlayerStats{
+			Health:      p.GetHealth(),
+			Mana:        p.GetMana(),
+			MaxMana:     p.GetTotalMana(),
+			CardsInHand: len(cards),
+		},
+		Board: make(map[uuid.UUID]MinionView),
+	}
+
+	if own {
+		view.Hand = make(map[uuid.UUID]Card)
+		for _, card := range cards {
+			view.Hand[card.GetId()] = card
+		}
+	}
+
+	for id, minion := range p.Board.Minions {
+		view.Board[id] = MinionView{
+			Id:     minion.Id,
+			Name:   minion.Name,
+			Mana:   minion.GetMana(),
+			Damage: minion.GetDamage(),
+			Health: minion.GetHealth(),
+			State:  minion.State,
+		}
+	}
+
+	return view
+}
+
+// Lists what changed from one view to the other, in a stable order
+func DiffState(from, to StateView) []Change {
+	changes := []Change{}
+
+	previous := make(map[uuid.UUID]PlayerView)
+	for _, player := range from.Players {
+		previous[player.Id] = player
+	}
+
+	for _, player := range to.Players {
+		before, known := previous[player.Id]
+
+		if !known || before.Stats != player.Stats {
+			stats := player.Stats
+			changes = append(changes, Change{Type: PlayerChanged, PlayerId: player.Id, Stats: &stats})
+		}
+
+		for _, id := range sortedIds(minionIds(before.Board, player.Board)) {
+			old, existed := before.Board[id]
+			minion, exists := player.Board[id]
+
+			switch {
+			case !exists:
+				changes = append(changes, Change{Type: MinionRemoved, PlayerId: player.Id, Id: copyId(id)})
+			case !existed:
+				changes = append(changes, Change{Type: MinionAdded, PlayerId: player.Id, Minion: &minion})
+			case old != minion:
+				changes = append(changes, Change{Type: MinionChanged, PlayerId: player.Id, Minion: &minion})
+			}
+		}
+
+		for _, id := range sortedIds(cardIds(before.Hand, player.Hand)) {
+			_, existed := before.Hand[id]
+			card, exists := player.Hand[id]
+
+			// cards don't change while in hand, only come and go
+			switch {
+			case !exists:
+				changes = append(changes, Change{Type: CardRemoved, PlayerId: player.Id, Id: copyId(id)})
+			case !existed:
+				changes = append(changes, Change{Type: CardAdded, PlayerId: player.Id, Card: card})
+			}
+		}
+	}
+
+	return changes
+}
+
+func minionIds(from, to map[uuid.UUID]MinionView) []uuid.UUID {
+	ids := []uuid.UUID{}
+	for id := range from {
+		ids = append(ids, id)
+	}
+	for id := range to {
+		if _, ok := from[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func cardIds(from, to map[uuid.UUID]Card) []uuid.UUID {
+	ids := []uuid.UUID{}
+	for id := range from {
+		ids = append(ids, id)
+	}
+	for id := range to {
+		if _, ok := from[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func sortedIds(ids []uuid.UUID) []uuid.UUID {
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].String() < ids[j].String()
+	})
+	return ids
+}
+
+func copyId(id uuid.UUID) *uuid.UUID {
+	return &id
+}
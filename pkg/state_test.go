@@ -0,0 +1,201 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Reads the next message, expecting it to be of the given type
+func ReadOutgoing(t *testing.T, socket *Socket, responseType ResponseType) Response {
+	select {
+	case response := <-socket.Outgoing:
+		if response.Type != responseType {
+			t.Fatalf("Expected %v, got %v", responseType, response.Type)
+		}
+		return response
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("Expected %v, got nothing", responseType)
+	}
+	return Response{}
+}
+
+func CountChanges(changes []Change, changeType ChangeType) int {
+	count := 0
+	for _, change := range changes {
+		if change.Type == changeType {
+			count++
+		}
+	}
+	return count
+}
+
+func TestState(t *testing.T) {
+	t.Run("diff", func(t *testing.T) {
+		player := NewPlayer(NewTestSocket())
+		card := NewCard("Card", 1, 1, 1)
+		player.Hand.Add(card)
+
+		minion := NewMinion(NewCard("Minion", 1, 2, 2))
+		player.Board.Place(minion)
+
+		first := StateView{Players: []PlayerView{player.View(true)}}
+		changes := DiffState(StateView{}, first)
+
+		if len(changes) != 3 {
+			t.Fatalf("Expected %v changes, got %v", 3, changes)
+		}
+		if CountChanges(changes, PlayerChanged) != 1 || CountChanges(changes, MinionAdded) != 1 || CountChanges(changes, CardAdded) != 1 {
+			t.Errorf("Expected player, minion and card, got %v", changes)
+		}
+
+		// nothing changed
+		if changes := DiffState(first, StateView{Players: []PlayerView{player.View(true)}}); len(changes) != 0 {
+			t.Errorf("Expected no changes, got %v", changes)
+		}
+
+		minion.RemoveHealth(1)
+		player.Discard(card.Id)
+		player.ReduceHealth(5)
+
+		changes = DiffState(first, StateView{Players: []PlayerView{player.View(true)}})
+		if len(changes) != 3 {
+			t.Fatalf("Expected %v changes, got %v", 3, changes)
+		}
+
+		if changes[0].Type != PlayerChanged || changes[0].Stats.Health != MAX_HEALTH-5 || changes[0].Stats.CardsInHand != 0 {
+			t.Errorf("Expected %v, got %v", PlayerChanged, changes[0])
+		}
+		if changes[1].Type != MinionChanged || changes[1].Minion.Health != 1 {
+			t.Errorf("Expected %v, got %v", MinionChanged, changes[1])
+		}
+		if changes[2].Type != CardRemoved || *changes[2].Id != card.Id {
+			t.Errorf("Expected %v, got %v", CardRemoved, changes[2])
+		}
+
+		player.Board.Remove(minion)
+		changes = DiffState(first, StateView{Players: []PlayerView{player.View(true)}})
+		if CountChanges(changes, MinionRemoved) != 1 {
+			t.Errorf("Expected %v, got %v", MinionRemoved, changes)
+		}
+	})
+
+	t.Run("hides opponent hand", func(t *testing.T) {
+		player := NewPlayer(NewTestSocket())
+		player.Hand.Add(NewCard("Card", 1, 1, 1))
+
+		view := player.View(false)
+		if view.Hand != nil {
+			t.Errorf("Expected hidden hand, got %v", view.Hand)
+		}
+		if view.Stats.CardsInHand != 1 {
+			t.Errorf("Expected %v, got %v", 1, view.Stats.CardsInHand)
+		}
+	})
+
+	t.Run("sends versioned diffs", func(t *testing.T) {
+		manager := NewGameManager(time.Second)
+
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+		p1.SetProtocol(PROTOCOL_VERSION, []Feature{StateDiffs})
+		p2.SetProtocol(PROTOCOL_VERSION, []Feature{StateDiffs})
+
+		game := manager.CreateGame([]*Socket{p1, p2})
+		card := NewCard("Minion", 1, 1, 1)
+		game.players[p1].Hand.Add(card)
+
+		game.StartTurn()
+
+		// board and hand are left out of turn messages
+		turn := ReadOutgoing(t, p1, StartTurn).Payload.(TurnPayload)
+		if turn.Board != nil || turn.Cards != nil {
+			t.Errorf("Expected no board nor cards, got %v", turn)
+		}
+
+		diff := ReadOutgoing(t, p1, StateDiff).Payload.(StateDiffPayload)
+		if diff.Version != 1 || diff.GameId != game.Id {
+			t.Errorf("Expected version %v of %v, got %v of %v", 1, game.Id, diff.Version, diff.GameId)
+		}
+		if CountChanges(diff.Changes, CardAdded) != 2 {
+			t.Errorf("Expected %v cards added, got %v", 2, diff.Changes)
+		}
+
+		ReadOutgoing(t, p2, WaitTurn)
+		diff = ReadOutgoing(t, p2, StateDiff).Payload.(StateDiffPayload)
+		if CountChanges(diff.Changes, CardAdded) != 0 {
+			t.Errorf("Expected opponent cards to be hidden, got %v", diff.Changes)
+		}
+
+		if err := game.PlayCard(card.Id, p1); err != nil {
+			t.Fatal(err)
+		}
+
+		ReadOutgoing(t, p1, CardPlayed)
+		diff = ReadOutgoing(t, p1, StateDiff).Payload.(StateDiffPayload)
+		if diff.Version != 2 {
+			t.Errorf("Expected version %v, got %v", 2, diff.Version)
+		}
+		if CountChanges(diff.Changes, MinionAdded) != 1 || CountChanges(diff.Changes, CardRemoved) != 1 {
+			t.Errorf("Expected minion added and card removed, got %v", diff.Changes)
+		}
+
+		ReadOutgoing(t, p2, CardPlayed)
+		diff = ReadOutgoing(t, p2, StateDiff).Payload.(StateDiffPayload)
+		if CountChanges(diff.Changes, MinionAdded) != 1 || CountChanges(diff.Changes, CardRemoved) != 0 {
+			t.Errorf("Expected minion added, got %v", diff.Changes)
+		}
+
+		// client asks for everything after noticing a gap
+		manager.Process(Event{Type: RequestState, Player: p1, Payload: IdPayload(game.Id.String())})
+
+		state := ReadOutgoing(t, p1, FullState).Payload.(StatePayload)
+		if state.Version != 3 {
+			t.Errorf("Expected version %v, got %v", 3, state.Version)
+		}
+		if len(state.State.Players) != 2 {
+			t.Fatalf("Expected %v players, got %v", 2, len(state.State.Players))
+		}
+		if len(state.State.Players[0].Board) != 1 || state.State.Players[1].Hand != nil {
+			t.Errorf("Expected own board and hidden opponent hand, got %v", state.State)
+		}
+	})
+
+	t.Run("legacy clients get full messages", func(t *testing.T) {
+		manager := NewGameManager(time.Second)
+
+		p1 := NewTestSocket()
+		p2 := NewTestSocket()
+
+		game := manager.CreateGame([]*Socket{p1, p2})
+		game.StartTurn()
+
+		turn := ReadOutgoing(t, p1, StartTurn).Payload.(TurnPayload)
+		if turn.Board == nil || len(turn.Cards) != 1 {
+			t.Errorf("Expected board and cards, got %v", turn)
+		}
+
+		select {
+		case response := <-p1.Outgoing:
+			t.Errorf("Expected no diff, got %v", response.Type)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+
+	t.Run("rejects state requests from outsiders", func(t *testing.T) {
+		manager := NewGameManager(time.Second)
+		game := manager.CreateGame([]*Socket{NewTestSocket(), NewTestSocket()})
+
+		outsider := NewTestSocket()
+		if err := game.SendState(outsider); ErrorCodeOf(err) != NotInGame {
+			t.Errorf("Expected %v, got %v", NotInGame, err)
+		}
+
+		manager.Process(Event{Type: RequestState, Player: outsider, Payload: IdPayload(uuid.New().String())})
+		response := ReadOutgoing(t, outsider, Error)
+		if payload := response.Payload.(*ProtocolError); payload.Code != GameNotFound {
+			t.Errorf("Expected %v, got %v", GameNotFound, payload.Code)
+		}
+	})
+}
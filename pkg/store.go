@@ -0,0 +1,301 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MEMORY_STORE = "memory"
+	FILE_STORE   = "file"
+)
+
+// Instances empty their mailbox every poll, one nobody took messages from
+// for this long belongs to an instance that is gone
+const MAILBOX_TTL = time.Minute
+
+// A player waiting for a match, known by the socket it is connected through
+// and the instance that socket lives on
+type QueueEntry struct {
+	Socket RemoteSocket `json:"socket"`
+	Joined time.Time    `json:"joined"`
+	Rating float64      `json:"rating"`
+}
+
+// QueueStore is the matchmaking pool, shared by every instance using it
+type QueueStore interface {
+	// Adds entry at the end, fails if its socket is already queued
+	Enqueue(entry QueueEntry) error
+	// Removes socketId from the pool, fails if it isn't queued
+	Dequeue(socketId uuid.UUID) error
+	// Entries in the order they joined
+	Queued() ([]QueueEntry, error)
+	// Takes size entries accepting each other under rule at once, none if
+	// there aren't enough. Those waiting longer are matched first
+	TakeMatch(size int, rule MatchRule) ([]QueueEntry, error)
+}
+
+// OwnerStore records which instance owns each match and game, so events
+// about them can be sent there
+type OwnerStore interface {
+	Claim(id uuid.UUID, instance string) error
+	// Instance owning id, empty if nobody claimed it
+	Owner(id uuid.UUID) (string, error)
+	Release(id uuid.UUID) error
+}
+
+// Mailbox carries envelopes between instances
+type Mailbox interface {
+	// Leaves envelope for instance, mailboxes left alone for MAILBOX_TTL
+	// are dropped
+	Post(instance string, envelope Envelope) error
+	// Envelopes sent to instance since the last call, oldest first
+	Receive(instance string) ([]Envelope, error)
+}
+
+// Store is everything instances share to work as a single server
+type Store interface {
+	QueueStore
+	OwnerStore
+	Mailbox
+	RatingStore
+}
+
+// Opens the store configured, instances sharing it share their players
+func OpenStore(config Config) (Store, error) {
+	switch config.Store {
+	case "", MEMORY_STORE:
+		return NewMemoryStore(), nil
+	case FILE_STORE:
+		return NewFileStore(config.StoreDir)
+	}
+	return nil, fmt.Errorf("unknown store %q", config.Store)
+}
+
+// The state kept by stores, shared by the implementations
+type storeState struct {
+	Queue     []QueueEntry          `json:"queue"`
+	Owners    map[uuid.UUID]string  `json:"owners"`
+	Mailboxes map[string][]Envelope `json:"mailboxes"`
+	Ratings   map[uuid.UUID]float64 `json:"ratings"`
+}
+
+func newStoreState() *storeState {
+	return &storeState{
+		Queue:     []QueueEntry{},
+		Owners:    make(map[uuid.UUID]string),
+		Mailboxes: make(map[string][]Envelope),
+		Ratings:   make(map[uuid.UUID]float64),
+	}
+}
+
+func (s *storeState) enqueue(entry QueueEntry) error {
+	for _, queued := range s.Queue {
+		if queued.Socket.Id == entry.Socket.Id {
+			return NewProtocolError(AlreadyQueued, "Already in queue")
+		}
+	}
+
+	// entries queued again go back to where they joined
+	at := len(s.Queue)
+	for at > 0 && s.Queue[at-1].Joined.After(entry.Joined) {
+		at--
+	}
+	s.Queue = append(s.Queue[:at], append([]QueueEntry{entry}, s.Queue[at:]...)...)
+	return nil
+}
+
+func (s *storeState) dequeue(socketId uuid.UUID) error {
+	for i, queued := range s.Queue {
+		if queued.Socket.Id == socketId {
+			s.Queue = append(s.Queue[:i], s.Queue[i+1:]...)
+			return nil
+		}
+	}
+	return NewProtocolError(NotQueued, "Not in queue")
+}
+
+// Matches the longest waiting player who has enough players within their
+// window with the closest of them, must be called at now
+func (s *storeState) takeMatch(size int, rule MatchRule, now time.Time) []QueueEntry {
+	for i, anchor := range s.Queue {
+		candidates := []int{}
+		for j, other := range s.Queue {
+			if i != j && rule.Fits(anchor, other, now) {
+				candidates = append(candidates, j)
+			}
+		}
+		if len(candidates) < size-1 {
+			continue
+		}
+
+		sort.SliceStable(candidates, func(a, b int) bool {
+			return math.Abs(s.Queue[candidates[a]].Rating-anchor.Rating) < math.Abs(s.Queue[candidates[b]].Rating-anchor.Rating)
+		})
+		picked := append([]int{i}, candidates[:size-1]...)
+		sort.Ints(picked)
+
+		taken := []QueueEntry{}
+		remaining := []QueueEntry{}
+		for j, entry := range s.Queue {
+			if len(picked) > 0 && picked[0] == j {
+				taken = append(taken, entry)
+				picked = picked[1:]
+			} else {
+				remaining = append(remaining, entry)
+			}
+		}
+		s.Queue = remaining
+		return taken
+	}
+	return nil
+}
+
+func (s *storeState) rating(player uuid.UUID) float64 {
+	if rating, ok := s.Ratings[player]; ok {
+		return rating
+	}
+	return DEFAULT_RATING
+}
+
+func (s *storeState) setRatings(ratings map[uuid.UUID]float64) {
+	for player, rating := range ratings {
+		s.Ratings[player] = rating
+	}
+}
+
+// Drops mailboxes of instances that are gone before posting
+func (s *storeState) post(instance string, envelope Envelope, now time.Time) {
+	for other, envelopes := range s.Mailboxes {
+		if len(envelopes) > 0 && now.Sub(envelopes[0].Posted) > MAILBOX_TTL {
+			delete(s.Mailboxes, other)
+		}
+	}
+
+	envelope.Posted = now
+	s.Mailboxes[instance] = append(s.Mailboxes[instance], envelope)
+}
+
+func (s *storeState) receive(instance string) []Envelope {
+	envelopes := s.Mailboxes[instance]
+	delete(s.Mailboxes, instance)
+	return envelopes
+}
+
+// MemoryStore keeps everything in process, instances must share the same
+// store value to see each other
+type MemoryStore struct {
+	mutex *sync.Mutex
+	state *storeState
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		mutex: new(sync.Mutex),
+		state: newStoreState(),
+	}
+}
+
+func (m *MemoryStore) Enqueue(entry QueueEntry) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.state.enqueue(entry)
+}
+
+func (m *MemoryStore) Dequeue(socketId uuid.UUID) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.state.dequeue(socketId)
+}
+
+func (m *MemoryStore) Queued() ([]QueueEntry, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return append([]QueueEntry{}, m.state.Queue...), nil
+}
+
+func (m *MemoryStore) TakeMatch(size int, rule MatchRule) ([]QueueEntry, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.state.takeMatch(size, rule, time.Now()), nil
+}
+
+func (m *MemoryStore) Claim(id uuid.UUID, instance string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.state.Owners[id] = instance
+	return nil
+}
+
+func (m *MemoryStore) Owner(id uuid.UUID) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.state.Owners[id], nil
+}
+
+func (m *MemoryStore) Release(id uuid.UUID) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.state.Owners, id)
+	return nil
+}
+
+func (m *MemoryStore) Post(instance string, envelope Envelope) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.state.post(instance, envelope, time.Now())
+	return nil
+}
+
+func (m *MemoryStore) Receive(instance string) ([]Envelope, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.state.receive(instance), nil
+}
+
+func (m *MemoryStore) Rating(player uuid.UUID) (float64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.state.rating(player), nil
+}
+
+func (m *MemoryStore) SetRatings(ratings map[uuid.UUID]float64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.state.setRatings(ratings)
+	return nil
+}
+
+type EnvelopeKind string
+
+const (
+	ForwardedEvent  EnvelopeKind = "event"    // client event for the owner of its game or match
+	RelayedResponse EnvelopeKind = "response" // message for a client connected elsewhere
+	ClosedSocket    EnvelopeKind = "close"    // last message before closing a client elsewhere
+)
+
+// Envelope is a message between instances about one client socket
+type Envelope struct {
+	Kind   EnvelopeKind    `json:"kind"`
+	From   string          `json:"from"`
+	Socket RemoteSocket    `json:"socket"`
+	Data   json.RawMessage `json:"data"`
+	Posted time.Time       `json:"posted"`
+}
@@ -0,0 +1,183 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func QueueEntryFor(instance string) QueueEntry {
+	return QueueEntry{
+		Socket: RemoteSocket{Id: uuid.New(), Session: uuid.New(), Instance: instance},
+		Joined: time.Now(),
+	}
+}
+
+// Stores under test, each call returns an empty one
+func NewTestStores(t *testing.T) map[string]func() Store {
+	return map[string]func() Store{
+		MEMORY_STORE: func() Store {
+			return NewMemoryStore()
+		},
+		FILE_STORE: func() Store {
+			store, err := NewFileStore(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return store
+		},
+	}
+}
+
+func TestStore(t *testing.T) {
+	for name, open := range NewTestStores(t) {
+		t.Run(name+" queue", func(t *testing.T) {
+			store := open()
+			first := QueueEntryFor("a")
+			second := QueueEntryFor("b")
+
+			store.Enqueue(first)
+			if err := store.Enqueue(first); ErrorCodeOf(err) != AlreadyQueued {
+				t.Errorf("Expected %v, got %v", AlreadyQueued, err)
+			}
+
+			if entries, _ := store.TakeMatch(2, MatchRule{}); entries != nil {
+				t.Errorf("Expected no match, got %v", entries)
+			}
+
+			store.Enqueue(second)
+			entries, err := store.TakeMatch(2, MatchRule{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 2 || entries[0].Socket.Id != first.Socket.Id || entries[1].Socket.Instance != "b" {
+				t.Errorf("Expected %v then %v, got %v", first, second, entries)
+			}
+
+			if queued, _ := store.Queued(); len(queued) != 0 {
+				t.Errorf("Expected empty queue, got %v", queued)
+			}
+			if err := store.Dequeue(first.Socket.Id); ErrorCodeOf(err) != NotQueued {
+				t.Errorf("Expected %v, got %v", NotQueued, err)
+			}
+		})
+
+		t.Run(name+" owners", func(t *testing.T) {
+			store := open()
+			id := uuid.New()
+
+			if owner, _ := store.Owner(id); owner != "" {
+				t.Errorf("Expected no owner, got %v", owner)
+			}
+
+			store.Claim(id, "a")
+			if owner, _ := store.Owner(id); owner != "a" {
+				t.Errorf("Expected %v, got %v", "a", owner)
+			}
+
+			store.Release(id)
+			if owner, _ := store.Owner(id); owner != "" {
+				t.Errorf("Expected no owner, got %v", owner)
+			}
+		})
+
+		t.Run(name+" mailboxes", func(t *testing.T) {
+			store := open()
+
+			store.Post("a", Envelope{Kind: ForwardedEvent, From: "b"})
+			store.Post("a", Envelope{Kind: RelayedResponse, From: "c"})
+			store.Post("b", Envelope{Kind: ClosedSocket, From: "a"})
+
+			envelopes, err := store.Receive("a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(envelopes) != 2 || envelopes[0].From != "b" || envelopes[1].From != "c" {
+				t.Errorf("Expected envelopes from b then c, got %v", envelopes)
+			}
+
+			if envelopes, _ := store.Receive("a"); len(envelopes) != 0 {
+				t.Errorf("Expected empty mailbox, got %v", envelopes)
+			}
+		})
+	}
+
+	t.Run("expires abandoned mailboxes", func(t *testing.T) {
+		state := newStoreState()
+		now := time.Now()
+
+		state.post("gone", Envelope{Kind: RelayedResponse}, now.Add(-2*MAILBOX_TTL))
+		state.post("live", Envelope{Kind: RelayedResponse}, now.Add(-time.Second))
+		state.post("a", Envelope{Kind: ForwardedEvent}, now)
+
+		if _, ok := state.Mailboxes["gone"]; ok {
+			t.Error("Expected mailbox of a gone instance to be dropped")
+		}
+		if len(state.Mailboxes["live"]) != 1 || len(state.Mailboxes["a"]) != 1 {
+			t.Errorf("Expected recent mailboxes to be kept, got %v", state.Mailboxes)
+		}
+	})
+
+	t.Run("file store polls without writing", func(t *testing.T) {
+		dir := t.TempDir()
+		store, _ := NewFileStore(dir)
+
+		if envelopes, err := store.Receive("a"); err != nil || len(envelopes) != 0 {
+			t.Fatalf("Expected empty mailbox, got %v %v", envelopes, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, STORE_STATE_FILE)); !os.IsNotExist(err) {
+			t.Errorf("Expected no state written, got %v", err)
+		}
+	})
+
+	t.Run("file store is shared", func(t *testing.T) {
+		dir := t.TempDir()
+		a, _ := NewFileStore(dir)
+		b, _ := NewFileStore(dir)
+
+		entry := QueueEntryFor("a")
+		a.Enqueue(entry)
+
+		queued, err := b.Queued()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(queued) != 1 || queued[0].Socket.Id != entry.Socket.Id {
+			t.Errorf("Expected %v, got %v", entry, queued)
+		}
+	})
+
+	t.Run("breaks stale locks", func(t *testing.T) {
+		dir := t.TempDir()
+		store, _ := NewFileStore(dir)
+
+		lock := filepath.Join(dir, STORE_LOCK_FILE)
+		os.WriteFile(lock, nil, 0o644)
+		stale := time.Now().Add(-2 * STALE_LOCK)
+		os.Chtimes(lock, stale, stale)
+
+		if err := store.Claim(uuid.New(), "a"); err != nil {
+			t.Errorf("Expected stale lock to be broken, got %v", err)
+		}
+	})
+
+	t.Run("opens configured store", func(t *testing.T) {
+		config := DefaultConfig()
+		if store, err := OpenStore(config); err != nil {
+			t.Error(err)
+		} else if _, ok := store.(*MemoryStore); !ok {
+			t.Errorf("Expected memory store, got %T", store)
+		}
+
+		config.Store = FILE_STORE
+		config.StoreDir = t.TempDir()
+		if store, err := OpenStore(config); err != nil {
+			t.Error(err)
+		} else if _, ok := store.(*FileStore); !ok {
+			t.Errorf("Expected file store, got %T", store)
+		}
+	})
+}
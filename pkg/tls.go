@@ -0,0 +1,87 @@
+package pkg
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+)
+
+// How often certificate files are checked for changes
+const CERT_RELOAD_INTERVAL = time.Minute
+
+// CertReloader serves a certificate from disk, reloading it when the files
+// are rotated so renewals don't need a restart
+type CertReloader struct {
+	mutex    *sync.Mutex
+	certFile string
+	keyFile  string
+	interval time.Duration
+	checked  time.Time
+	modified time.Time
+	cert     *tls.Certificate
+}
+
+// Loads the key pair, failing if it cannot be used at all
+func NewCertReloader(certFile, keyFile string, interval time.Duration) (*CertReloader, error) {
+	reloader := &CertReloader{
+		mutex:    new(sync.Mutex),
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+	}
+
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// Used as tls.Config.GetCertificate, a failed reload keeps serving the last
+// good certificate
+func (c *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if time.Since(c.checked) >= c.interval {
+		c.checked = time.Now()
+		if c.changed() {
+			c.load()
+		}
+	}
+	return c.cert, nil
+}
+
+func (c *CertReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: c.GetCertificate,
+	}
+}
+
+func (c *CertReloader) changed() bool {
+	return c.lastModified().After(c.modified)
+}
+
+func (c *CertReloader) lastModified() time.Time {
+	var modified time.Time
+	for _, filename := range []string{c.certFile, c.keyFile} {
+		if info, err := os.Stat(filename); err == nil && info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+	}
+	return modified
+}
+
+func (c *CertReloader) load() error {
+	modified := c.lastModified()
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.cert = &cert
+	c.modified = modified
+	return nil
+}
@@ -0,0 +1,156 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Writes a self-signed certificate for localhost, returning the cert in DER
+func WriteSelfSigned(t *testing.T, certFile, keyFile string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"localhost"},
+
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+
+	if err := os.WriteFile(certFile, certPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestTLS(t *testing.T) {
+	t.Run("serves wss", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile := filepath.Join(dir, "cert.pem")
+		keyFile := filepath.Join(dir, "key.pem")
+		der := WriteSelfSigned(t, certFile, keyFile)
+
+		certs, err := NewCertReloader(certFile, keyFile, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		server := NewServer()
+		go server.ListenTLS("127.0.0.1:8443", certs)
+		defer server.Shutdown(context.Background())
+
+		time.Sleep(10 * time.Millisecond)
+
+		cert, _ := x509.ParseCertificate(der)
+		roots := x509.NewCertPool()
+		roots.AddCert(cert)
+
+		dialer := websocket.Dialer{TLSClientConfig: &tls.Config{RootCAs: roots}}
+		socket, _, err := dialer.Dial("wss://127.0.0.1:8443", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer socket.Close()
+
+		ReadResponse(t, socket, SessionStarted)
+	})
+
+	t.Run("reloads rotated certificate", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile := filepath.Join(dir, "cert.pem")
+		keyFile := filepath.Join(dir, "key.pem")
+		first := WriteSelfSigned(t, certFile, keyFile)
+
+		certs, err := NewCertReloader(certFile, keyFile, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cert, _ := certs.GetCertificate(nil)
+		if !bytes.Equal(cert.Certificate[0], first) {
+			t.Error("Expected first certificate")
+		}
+
+		// rotate files, making sure modification time moves forward
+		second := WriteSelfSigned(t, certFile, keyFile)
+		later := time.Now().Add(time.Minute)
+		os.Chtimes(certFile, later, later)
+		os.Chtimes(keyFile, later, later)
+
+		cert, _ = certs.GetCertificate(nil)
+		if !bytes.Equal(cert.Certificate[0], second) {
+			t.Error("Expected rotated certificate")
+		}
+	})
+
+	t.Run("keeps last good certificate", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile := filepath.Join(dir, "cert.pem")
+		keyFile := filepath.Join(dir, "key.pem")
+		first := WriteSelfSigned(t, certFile, keyFile)
+
+		certs, err := NewCertReloader(certFile, keyFile, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// half written rotation
+		os.WriteFile(keyFile, []byte("garbage"), 0600)
+		later := time.Now().Add(time.Minute)
+		os.Chtimes(keyFile, later, later)
+
+		cert, err := certs.GetCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(cert.Certificate[0], first) {
+			t.Error("Expected last good certificate")
+		}
+	})
+
+	t.Run("rejects missing files", func(t *testing.T) {
+		if _, err := NewCertReloader("missing.pem", "missing.key", time.Minute); err == nil {
+			t.Error("Expected error for missing files")
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Transport carries events and responses between a socket and its client,
+// so sockets work the same no matter how clients are connected
+type Transport interface {
+	// Blocks until the client sends an event, fails once the client is gone
+	ReadEvent() (Event, error)
+	WriteResponse(response Response) error
+	// Keeps the connection alive and detects dead peers
+	Ping() error
+	// Writes a last message and tells the client the connection is over
+	CloseWith(response Response)
+	// Closes the connection, safe to call more than once
+	Close() error
+}
+
+type WebsocketTransport struct {
+	conn   *websocket.Conn
+	config SocketConfig
+	codec  Codec
+	once   *sync.Once
+}
+
+func NewWebsocketTransport(conn *websocket.Conn, config SocketConfig, codec Codec) *WebsocketTransport {
+	conn.SetReadDeadline(time.Now().Add(config.PongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(config.PongWait))
+	})
+
+	return &WebsocketTransport{
+		conn:   conn,
+		config: config,
+		codec:  codec,
+		once:   new(sync.Once),
+	}
+}
+
+func (t *WebsocketTransport) ReadEvent() (Event, error) {
+	var event Event
+	_, data, err := t.conn.ReadMessage()
+	if err != nil {
+		return event, err
+	}
+	t.conn.SetReadDeadline(time.Now().Add(t.config.PongWait))
+	return event, t.codec.Unmarshal(data, &event)
+}
+
+func (t *WebsocketTransport) WriteResponse(response Response) error {
+	data, err := t.codec.Marshal(response)
+	if err != nil {
+		return err
+	}
+	t.conn.SetWriteDeadline(time.Now().Add(t.config.WriteWait))
+	return t.conn.WriteMessage(t.codec.MessageType(), data)
+}
+
+func (t *WebsocketTransport) Ping() error {
+	deadline := time.Now().Add(t.config.WriteWait)
+	return t.conn.WriteControl(websocket.PingMessage, nil, deadline)
+}
+
+func (t *WebsocketTransport) CloseWith(response Response) {
+	t.WriteResponse(response)
+	t.conn.WriteMessage(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+	)
+}
+
+func (t *WebsocketTransport) Close() error {
+	var err error
+	t.once.Do(func() {
+		err = t.conn.Close()
+	})
+	return err
+}